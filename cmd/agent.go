@@ -0,0 +1,180 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/mixanemca/ssh-keys/internal/agents"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentCmd represents the agent command
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Work with keys in ssh-agent",
+}
+
+var agentListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List keys in ssh-agents, the keys of smartcards are listed separately",
+	Args:  cobra.NoArgs,
+	RunE:  runAgentList,
+}
+
+var agentAddProviderCmd = &cobra.Command{
+	Use:          "add-provider <pkcs11-library>",
+	Short:        "Add the keys of a PKCS#11 provider to ssh-agent, like ssh-add -s",
+	Args:         cobra.ExactArgs(1),
+	RunE:         runAgentAddProvider,
+	SilenceUsage: true,
+}
+
+var agentRemoveProviderCmd = &cobra.Command{
+	Use:          "remove-provider <pkcs11-library>",
+	Short:        "Remove the keys of a PKCS#11 provider from ssh-agent, like ssh-add -e",
+	Args:         cobra.ExactArgs(1),
+	RunE:         runAgentRemoveProvider,
+	SilenceUsage: true,
+}
+
+func init() {
+	agentCmd.AddCommand(agentListCmd, agentAddProviderCmd, agentRemoveProviderCmd)
+	rootCmd.AddCommand(agentCmd)
+}
+
+// smartcardProvider returns the provider of SSH agent which loads keys of
+// PKCS#11 providers.
+func smartcardProvider() (agents.SmartcardProvider, error) {
+	sp, ok := agentProvider().(agents.SmartcardProvider)
+	if !ok {
+		return nil, fmt.Errorf("ssh-agent does not support PKCS#11 providers")
+	}
+
+	return sp, nil
+}
+
+func runAgentList(cmd *cobra.Command, args []string) error {
+	list, err := listKeys()
+	if err != nil {
+		return err
+	}
+
+	endpoints := agentEndpoints()
+	var others []string
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AGENT\tNAME\tTYPE\tFINGERPRINT\tCOMMENT")
+	for _, e := range endpoints {
+		identities, err := listAgent(e)
+		if err != nil {
+			if len(endpoints) == 1 {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Skip ssh-agent %s: %v\n", e.Name, err)
+			continue
+		}
+		for _, id := range identities {
+			name := "-"
+			if k := findAgentKey(list, id.Blob); k != nil {
+				name = k.Name
+			}
+			line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", e.Name, name, id.Type(), ssh.FingerprintSHA256(id), id.Comment)
+			if name == "-" {
+				others = append(others, line)
+				continue
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	if err := w.Flush(); err != nil || len(others) == 0 {
+		return err
+	}
+
+	fmt.Println("\nSmartcard and other keys:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AGENT\tNAME\tTYPE\tFINGERPRINT\tCOMMENT")
+	for _, line := range others {
+		fmt.Fprintln(w, line)
+	}
+
+	return w.Flush()
+}
+
+// listAgent returns the keys of SSH agent.
+func listAgent(e agents.Endpoint) ([]*agent.Key, error) {
+	client, err := e.Provider.Connect()
+	if err != nil {
+		return nil, err
+	}
+	identities, err := client.List()
+	if err != nil {
+		return nil, fmt.Errorf("get list of ssh keys from agent %s: %w", e.Name, err)
+	}
+
+	return identities, nil
+}
+
+// findAgentKey returns the key which public key or certificate is the blob
+// listed by agent, nil if none.
+func findAgentKey(list []*models.Key, blob []byte) *models.Key {
+	i := slices.IndexFunc(list, func(k *models.Key) bool {
+		return bytes.Equal(k.Public.Marshal(), blob) ||
+			k.Certificate != nil && bytes.Equal(k.Certificate.Marshal(), blob)
+	})
+	if i < 0 {
+		return nil
+	}
+
+	return list[i]
+}
+
+func runAgentAddProvider(cmd *cobra.Command, args []string) error {
+	sp, err := smartcardProvider()
+	if err != nil {
+		return err
+	}
+	pin, err := promptSecret("Enter PIN for " + args[0] + ": ")
+	if err != nil {
+		return err
+	}
+	if err := sp.AddSmartcardKey(args[0], string(pin)); err != nil {
+		return fmt.Errorf("add PKCS#11 provider: %w", err)
+	}
+	fmt.Printf("Keys of %s added to ssh-agent\n", args[0])
+
+	return nil
+}
+
+func runAgentRemoveProvider(cmd *cobra.Command, args []string) error {
+	sp, err := smartcardProvider()
+	if err != nil {
+		return err
+	}
+	if err := sp.RemoveSmartcardKey(args[0]); err != nil {
+		return fmt.Errorf("remove PKCS#11 provider: %w", err)
+	}
+	fmt.Printf("Keys of %s removed from ssh-agent\n", args[0])
+
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/metadata"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "List keys overdue for rotation",
+	Long: `List keys older than the rotation period or past their expiry date set
+in metadata. The command fails when there are overdue keys, so it can be
+used in compliance checks.
+
+The key age is counted from the modification time of the key file, unless
+the creation date is set with "ssh-keys meta <name> --created".`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runAudit,
+}
+
+// auditMaxAge is the rotation period of keys.
+var auditMaxAge string
+
+func init() {
+	auditCmd.Flags().StringVar(&auditMaxAge, "max-age", "365d", "rotation period like 365d or 26w")
+
+	rootCmd.AddCommand(auditCmd)
+}
+
+func runAudit(cmd *cobra.Command, args []string) error {
+	period, err := parseDuration(auditMaxAge)
+	if err != nil {
+		return err
+	}
+	list, err := listKeys()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tFINGERPRINT\tCREATED\tAGE\tREASON")
+	var overdue int
+	for _, k := range list {
+		var reasons []string
+		if keys.Overdue(k, period, now) {
+			reasons = append(reasons, "older than "+keys.FormatAge(period))
+		}
+		if k.Metadata.Expired(now) {
+			reasons = append(reasons, "expired "+k.Metadata.Expires.Format(metadata.DateLayout))
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+		overdue++
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", k.Name, k.Format, ssh.FingerprintSHA256(k.Public),
+			k.Created.Format(metadata.DateLayout), keys.FormatAge(k.Age(now)), strings.Join(reasons, ", "))
+	}
+	if overdue == 0 {
+		fmt.Println("No keys are overdue for rotation")
+		return nil
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%d of %d keys are overdue for rotation", overdue, len(list))
+}
@@ -0,0 +1,170 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/authorized"
+	"github.com/mixanemca/ssh-keys/internal/dirs"
+	"github.com/spf13/cobra"
+)
+
+// authorizedCmd represents the authorized command
+var authorizedCmd = &cobra.Command{
+	Use:   "authorized",
+	Short: "Manage authorized_keys file",
+}
+
+var authorizedListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List authorized keys with their options",
+	Args:  cobra.NoArgs,
+	RunE:  runAuthorizedList,
+}
+
+var authorizedAddCmd = &cobra.Command{
+	Use:   "add <key>",
+	Short: "Authorize a public key from the keys directory",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runAuthorizedAdd,
+}
+
+var authorizedRemoveCmd = &cobra.Command{
+	Use:   "remove <fingerprint>",
+	Short: "Remove all entries of the key with the SHA256 fingerprint",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runAuthorizedRemove,
+}
+
+var (
+	// authorizedFile is the path of authorized_keys file.
+	authorizedFile string
+	// authorizedOptions are the options of the added key.
+	authorizedOptions []string
+)
+
+func init() {
+	authorizedCmd.PersistentFlags().StringVar(&authorizedFile, "file", "", "path of authorized_keys file (default ~/.ssh/authorized_keys)")
+	authorizedAddCmd.Flags().StringArrayVarP(&authorizedOptions, "option", "O", nil, `key option like restrict, from="10.0.0.0/8" or expiry-time="20301231"`)
+
+	authorizedCmd.AddCommand(authorizedListCmd, authorizedAddCmd, authorizedRemoveCmd)
+	rootCmd.AddCommand(authorizedCmd)
+}
+
+// authorizedPath returns the path of authorized_keys file.
+func authorizedPath() (string, error) {
+	if authorizedFile != "" {
+		return authorizedFile, nil
+	}
+	dir, err := dirs.SSHDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "authorized_keys"), nil
+}
+
+// loadAuthorized reads authorized_keys file.
+func loadAuthorized() (*authorized.File, error) {
+	path, err := authorizedPath()
+	if err != nil {
+		return nil, err
+	}
+
+	return authorized.Load(path)
+}
+
+func runAuthorizedList(cmd *cobra.Command, args []string) error {
+	f, err := loadAuthorized()
+	if err != nil {
+		return err
+	}
+
+	duplicates := map[*authorized.Entry]bool{}
+	for _, group := range f.Duplicates() {
+		for _, e := range group {
+			duplicates[e] = true
+		}
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tTYPE\tFINGERPRINT\tCOMMENT\tOPTIONS\tSTATUS")
+	for _, e := range f.Entries() {
+		var status []string
+		if duplicates[e] {
+			status = append(status, "duplicate")
+		}
+		if e.Expired(now) {
+			status = append(status, "expired")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", e.Line, e.Key.Type(), e.Fingerprint(), e.Comment,
+			strings.Join(e.Options, ","), strings.Join(status, ","))
+	}
+
+	return w.Flush()
+}
+
+func runAuthorizedAdd(cmd *cobra.Command, args []string) error {
+	store, err := keyStore()
+	if err != nil {
+		return err
+	}
+	key, err := store.Get(args[0])
+	if err != nil {
+		return err
+	}
+	f, err := loadAuthorized()
+	if err != nil {
+		return err
+	}
+
+	e, err := f.Add(key.Public, key.Comment, authorizedOptions)
+	if err != nil {
+		return err
+	}
+	if err := f.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Authorized %s %s in %s\n", key.Name, e.Fingerprint(), f.Path())
+
+	return nil
+}
+
+func runAuthorizedRemove(cmd *cobra.Command, args []string) error {
+	f, err := loadAuthorized()
+	if err != nil {
+		return err
+	}
+
+	removed := f.Remove(args[0])
+	if removed == 0 {
+		return fmt.Errorf("no entries with fingerprint %s in %s", args[0], f.Path())
+	}
+	if err := f.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d entries from %s\n", removed, f.Path())
+
+	return nil
+}
@@ -0,0 +1,198 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mixanemca/ssh-keys/internal/ca"
+	"github.com/mixanemca/ssh-keys/internal/dirs"
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// caCmd represents the ca command
+var caCmd = &cobra.Command{
+	Use:   "ca",
+	Short: "Issue SSH certificates with a local certificate authority",
+	Long: `The certificate authority key is kept in $XDG_DATA_HOME/ssh-keys/ca. Add the
+public key printed by "ssh-keys ca show" to TrustedUserCAKeys of sshd_config(5)
+or as @cert-authority line to known_hosts(5).`,
+}
+
+var caInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Generate a new certificate authority key",
+	Args:  cobra.NoArgs,
+	RunE:  runCAInit,
+}
+
+var caShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the certificate authority public key",
+	Args:  cobra.NoArgs,
+	RunE:  runCAShow,
+}
+
+var caSignCmd = &cobra.Command{
+	Use:   "sign <key>",
+	Short: "Sign a public key, writing the certificate next to the key",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runCASign,
+}
+
+var (
+	caKeyType      string
+	caPrincipals   []string
+	caValidity     string
+	caHost         bool
+	caUser         bool
+	caKeyID        string
+	caSerial       uint64
+	caOptions      []string
+	caExtensions   []string
+	caNoExtensions bool
+)
+
+func init() {
+	caInitCmd.Flags().StringVarP(&caKeyType, "type", "t", ssh.KeyAlgoED25519, "type of the CA key")
+
+	caSignCmd.Flags().StringSliceVarP(&caPrincipals, "principals", "n", nil, "user or host names the certificate is valid for")
+	caSignCmd.Flags().StringVarP(&caValidity, "validity", "V", "", "validity period like 8h or 30d (default forever)")
+	caSignCmd.Flags().BoolVar(&caHost, "host", false, "issue a host certificate")
+	caSignCmd.Flags().BoolVar(&caUser, "user", false, "issue a user certificate (default)")
+	caSignCmd.Flags().StringVarP(&caKeyID, "key-id", "I", "", "certificate key ID (default key name)")
+	caSignCmd.Flags().Uint64Var(&caSerial, "serial", 0, "certificate serial number (default random)")
+	caSignCmd.Flags().StringArrayVarP(&caOptions, "option", "O", nil, "critical option like force-command=CMD or source-address=CIDR")
+	caSignCmd.Flags().StringArrayVar(&caExtensions, "extension", nil, "extension like permit-pty, replaces the defaults of user certificates")
+	caSignCmd.Flags().BoolVar(&caNoExtensions, "no-extensions", false, "issue a user certificate without extensions")
+	caSignCmd.MarkFlagsMutuallyExclusive("host", "user")
+
+	caCmd.AddCommand(caInitCmd, caShowCmd, caSignCmd)
+	rootCmd.AddCommand(caCmd)
+}
+
+// caStore returns the store of the certificate authority key.
+func caStore() (*keys.FSStore, error) {
+	dir, err := dirs.DataFile("ca")
+	if err != nil {
+		return nil, err
+	}
+
+	return keys.NewFSStore(dir), nil
+}
+
+func runCAInit(cmd *cobra.Command, args []string) error {
+	store, err := caStore()
+	if err != nil {
+		return err
+	}
+	authority, err := ca.Init(store, caKeyType, "ssh-keys CA")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created certificate authority %s\n", authority.Key.Path)
+	fmt.Print(string(keys.MarshalPublicKey(authority.Key.Public, authority.Key.Comment)))
+
+	return nil
+}
+
+func runCAShow(cmd *cobra.Command, args []string) error {
+	store, err := caStore()
+	if err != nil {
+		return err
+	}
+	authority, err := ca.Load(store)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(keys.MarshalPublicKey(authority.Key.Public, authority.Key.Comment)))
+
+	return nil
+}
+
+func runCASign(cmd *cobra.Command, args []string) error {
+	cStore, err := caStore()
+	if err != nil {
+		return err
+	}
+	authority, err := ca.Load(cStore)
+	if err != nil {
+		return err
+	}
+	store, err := keyStore()
+	if err != nil {
+		return err
+	}
+	key, err := store.Get(args[0])
+	if err != nil {
+		return err
+	}
+
+	opts := ca.Options{
+		CertType:        ssh.UserCert,
+		KeyID:           caKeyID,
+		Principals:      caPrincipals,
+		Serial:          caSerial,
+		CriticalOptions: map[string]string{},
+		Extensions:      ca.DefaultUserExtensions(),
+	}
+	if opts.KeyID == "" {
+		opts.KeyID = key.Name
+	}
+	if caHost {
+		opts.CertType = ssh.HostCert
+		opts.Extensions = map[string]string{}
+	}
+	if caNoExtensions || len(caExtensions) > 0 {
+		opts.Extensions = map[string]string{}
+	}
+	for _, ext := range caExtensions {
+		name, value, _ := strings.Cut(ext, "=")
+		opts.Extensions[name] = value
+	}
+	for _, opt := range caOptions {
+		name, value, ok := strings.Cut(opt, "=")
+		if !ok {
+			return fmt.Errorf("invalid critical option %q, expected name=value", opt)
+		}
+		opts.CriticalOptions[name] = value
+	}
+	// Only the unset flag means forever, a zero or negative validity would
+	// silently issue a certificate which never expires.
+	if caValidity != "" {
+		if opts.Validity, err = parseDuration(caValidity); err != nil {
+			return err
+		}
+		if opts.Validity <= 0 {
+			return fmt.Errorf("invalid validity %q, it must be positive", caValidity)
+		}
+	}
+
+	cert, err := authority.SignKey(key, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Signed %s, certificate written to %s\n", key.Name, key.Path+keys.CertSuffix)
+	for _, line := range keys.DescribeCertificate(cert) {
+		fmt.Println("  " + line)
+	}
+
+	return nil
+}
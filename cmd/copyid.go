@@ -0,0 +1,83 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/mixanemca/ssh-keys/internal/remote"
+	"github.com/mixanemca/ssh-keys/internal/usage"
+	"github.com/spf13/cobra"
+)
+
+// copyIDCmd represents the copy-id command
+var copyIDCmd = &cobra.Command{
+	Use:   "copy-id <name> <user@host[:port]>",
+	Short: "Add the public key to authorized_keys on a remote host",
+	Long: `Add the public key to authorized_keys on a remote host, like ssh-copy-id.
+
+The connection is authenticated with the keys of ssh-agent, the password is
+asked when none of them is accepted. The key is not added again when it is
+already authorized, permissions of the remote ~/.ssh are fixed.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runCopyID,
+}
+
+func init() {
+	copyIDCmd.Flags().StringVar(&knownHostsFile, "known-hosts", "", "path of known_hosts file (default ~/.ssh/known_hosts)")
+	copyIDCmd.Flags().BoolVar(&acceptNewHostKey, "accept-new", false, "add keys of unknown hosts to known_hosts file")
+
+	rootCmd.AddCommand(copyIDCmd)
+}
+
+func runCopyID(cmd *cobra.Command, args []string) error {
+	store, err := keyStore()
+	if err != nil {
+		return err
+	}
+	key, err := store.Get(args[0])
+	if err != nil {
+		return err
+	}
+	target, err := remote.ParseTarget(args[1])
+	if err != nil {
+		return err
+	}
+
+	d, closeAgent, err := newDialer(agentProvider(), true)
+	if err != nil {
+		return err
+	}
+	defer closeAgent()
+	client, err := d.Dial(target)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	added, err := remote.CopyID(client, key.Public, key.Comment)
+	if err != nil {
+		return err
+	}
+	if added {
+		fmt.Printf("Key %s was added to %s\n", key.Name, target)
+	} else {
+		fmt.Printf("Key %s is already authorized on %s\n", key.Name, target)
+	}
+
+	return recordUsage(key.Public, usage.ActionCopyID, target.String())
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/spf13/cobra"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export <name>",
+	Short: "Export a private key to PKCS#8, PEM, PuTTY .ppk or OpenSSH format",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runExport,
+}
+
+var (
+	// exportEncoding is the encoding of the exported key.
+	exportEncoding string
+	// exportPassphrase enables encryption of the exported key.
+	exportPassphrase bool
+	// exportOutput is the file to write the exported key to.
+	exportOutput string
+)
+
+func init() {
+	exportCmd.Flags().StringVarP(&exportEncoding, "format", "f", keys.EncodingPKCS8, "output format: "+strings.Join(keys.Encodings, ", "))
+	exportCmd.Flags().BoolVarP(&exportPassphrase, "passphrase", "p", false, "ask for a passphrase to encrypt the exported key")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "write the key to the file instead of stdout")
+
+	rootCmd.AddCommand(exportCmd)
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	if !slices.Contains(keys.Encodings, exportEncoding) {
+		return fmt.Errorf("unsupported format %q, use one of: %s", exportEncoding, strings.Join(keys.Encodings, ", "))
+	}
+	store, err := keyStore()
+	if err != nil {
+		return err
+	}
+	key, err := store.Get(args[0])
+	if err != nil {
+		return err
+	}
+
+	var passphrase []byte
+	if exportPassphrase {
+		if passphrase, err = promptNewSecret("passphrase"); err != nil {
+			return err
+		}
+	}
+
+	data, err := keys.EncodePrivateKey(key, exportEncoding, passphrase)
+	if err != nil {
+		return err
+	}
+	if exportOutput == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(exportOutput, data, 0600); err != nil {
+		return fmt.Errorf("write key file: %v", err)
+	}
+
+	return nil
+}
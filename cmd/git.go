@@ -0,0 +1,110 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mixanemca/ssh-keys/internal/gitconfig"
+	"github.com/mixanemca/ssh-keys/internal/signers"
+	"github.com/spf13/cobra"
+)
+
+// gitCmd represents the git command
+var gitCmd = &cobra.Command{
+	Use:   "git",
+	Short: "Configure git to sign commits with SSH keys",
+}
+
+var gitSetupCmd = &cobra.Command{
+	Use:   "setup <key>",
+	Short: "Configure git to sign commits with the key",
+	Long: `Configure git to sign commits with the key.
+
+Sets gpg.format=ssh, user.signingkey and gpg.ssh.allowedSignersFile in the
+chosen scope of git config. The key is also allowed to sign as the principal
+in the allowed signers file, so the own commits are verified.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runGitSetup,
+}
+
+var (
+	// gitScope is the git config scope to write to.
+	gitScope string
+	// gitPrincipal is the principal of the key in allowed_signers file.
+	gitPrincipal string
+)
+
+func init() {
+	gitSetupCmd.Flags().StringVar(&gitScope, "scope", gitconfig.ScopeGlobal, "git config scope: "+strings.Join(gitconfig.Scopes, ", "))
+	gitSetupCmd.Flags().StringVarP(&gitPrincipal, "principal", "p", "", "principal of the key in allowed signers file (default git user.email)")
+	gitSetupCmd.Flags().StringVar(&allowedSignersFile, "allowed-signers", "", "path of allowed_signers file (default ~/.ssh/allowed_signers)")
+
+	gitCmd.AddCommand(gitSetupCmd)
+	rootCmd.AddCommand(gitCmd)
+}
+
+func runGitSetup(cmd *cobra.Command, args []string) error {
+	if !slices.Contains(gitconfig.Scopes, gitScope) {
+		return fmt.Errorf("unsupported scope %q, use one of: %s", gitScope, strings.Join(gitconfig.Scopes, ", "))
+	}
+	store, err := keyStore()
+	if err != nil {
+		return err
+	}
+	key, err := store.Get(args[0])
+	if err != nil {
+		return err
+	}
+	f, err := loadAllowedSigners()
+	if err != nil {
+		return err
+	}
+
+	g := &gitconfig.Git{}
+	if err := g.Setup(gitScope, key, f.Path()); err != nil {
+		return err
+	}
+	fmt.Printf("Git signs commits with %s in %s scope\n", key.Name, gitScope)
+
+	principal := gitPrincipal
+	if principal == "" {
+		if principal, err = g.Get(gitconfig.ScopeDefault, "user.email"); err != nil {
+			return err
+		}
+	}
+	if principal == "" {
+		fmt.Println("Set user.email or use --principal to allow the key in allowed signers file")
+		return nil
+	}
+	_, err = f.Add([]string{principal}, key.Public, []string{"git"}, key.Comment)
+	if errors.Is(err, signers.ErrDuplicate) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := f.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Allowed %s to sign as %s in %s\n", key.Name, principal, f.Path())
+
+	return nil
+}
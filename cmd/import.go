@@ -0,0 +1,95 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import a private key from PEM, PKCS#8, PuTTY .ppk or OpenSSH file",
+	Long: `Import detects the format of the private key file, parses it and writes
+a normalized OpenSSH private key with the .pub companion to the keys directory.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImport,
+}
+
+var (
+	// importName is the name of the imported key in the keys directory.
+	importName string
+	// importComment overrides the comment of the imported key.
+	importComment string
+)
+
+func init() {
+	importCmd.Flags().StringVar(&importName, "name", "", "name of the key in the keys directory (default file name without extension)")
+	importCmd.Flags().StringVar(&importComment, "comment", "", "comment of the key")
+
+	rootCmd.AddCommand(importCmd)
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	store, err := keyStore()
+	if err != nil {
+		return err
+	}
+	path := args[0]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read key file: %v", err)
+	}
+
+	name := importName
+	if name == "" {
+		name = filepath.Base(path)
+		switch ext := filepath.Ext(name); ext {
+		case ".ppk", ".pem", ".key", ".p8":
+			name = strings.TrimSuffix(name, ext)
+		}
+	}
+	comment := importComment
+	if comment == "" {
+		if pub, err := os.ReadFile(path + ".pub"); err == nil {
+			_, comment, _, _, _ = ssh.ParseAuthorizedKey(pub)
+		}
+	}
+
+	key, err := keys.ImportKey(store, name, comment, data, nil)
+	if errors.Is(err, keys.ErrPassphraseRequired) {
+		var passphrase []byte
+		if passphrase, err = promptSecret("Key passphrase: "); err != nil {
+			return err
+		}
+		key, err = keys.ImportKey(store, name, comment, data, passphrase)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %s key %s to %s\n", key.Format, ssh.FingerprintSHA256(key.Public), key.Path)
+
+	return nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mixanemca/ssh-keys/internal/dirs"
+	"github.com/mixanemca/ssh-keys/internal/hosts"
+	"github.com/spf13/cobra"
+)
+
+// knownHostsCmd represents the known-hosts command
+var knownHostsCmd = &cobra.Command{
+	Use:   "known-hosts",
+	Short: "View and edit known_hosts file",
+}
+
+var knownHostsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List known host keys",
+	Args:  cobra.NoArgs,
+	RunE:  runKnownHostsList,
+}
+
+var knownHostsSearchCmd = &cobra.Command{
+	Use:   "search <host[:port]>",
+	Short: "Find keys of the host, including hashed entries",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runKnownHostsSearch,
+}
+
+var knownHostsRemoveCmd = &cobra.Command{
+	Use:   "remove [host[:port]]",
+	Short: "Remove keys of the host, e.g. after the host rekey",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runKnownHostsRemove,
+}
+
+var (
+	// knownHostsFile is the path of known_hosts file.
+	knownHostsFile string
+	// knownHostsLine is the line number of the entry to remove.
+	knownHostsLine int
+)
+
+func init() {
+	knownHostsCmd.PersistentFlags().StringVar(&knownHostsFile, "file", "", "path of known_hosts file (default ~/.ssh/known_hosts)")
+	knownHostsRemoveCmd.Flags().IntVar(&knownHostsLine, "line", 0, "remove the entry at the line number instead of by host")
+
+	knownHostsCmd.AddCommand(knownHostsListCmd, knownHostsSearchCmd, knownHostsRemoveCmd)
+	rootCmd.AddCommand(knownHostsCmd)
+}
+
+// knownHostsPath returns the path of known_hosts file.
+func knownHostsPath() (string, error) {
+	if knownHostsFile != "" {
+		return knownHostsFile, nil
+	}
+	dir, err := dirs.SSHDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "known_hosts"), nil
+}
+
+// loadKnownHosts reads known_hosts file.
+func loadKnownHosts() (*hosts.File, error) {
+	path, err := knownHostsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	return hosts.Load(path)
+}
+
+// printKnownHosts prints the entries as a table.
+func printKnownHosts(entries []*hosts.Entry) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tMARKER\tHOSTS\tTYPE\tFINGERPRINT")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", e.Line, e.Marker, hostsString(e), e.Key.Type(), e.Fingerprint())
+	}
+
+	return w.Flush()
+}
+
+// hostsString formats the host names of the entry, hiding hashes.
+func hostsString(e *hosts.Entry) string {
+	if e.Hashed() {
+		return "(hashed)"
+	}
+
+	return strings.Join(e.Hosts, ",")
+}
+
+func runKnownHostsList(cmd *cobra.Command, args []string) error {
+	f, err := loadKnownHosts()
+	if err != nil {
+		return err
+	}
+
+	return printKnownHosts(f.Entries())
+}
+
+func runKnownHostsSearch(cmd *cobra.Command, args []string) error {
+	f, err := loadKnownHosts()
+	if err != nil {
+		return err
+	}
+	found := f.Search(args[0])
+	if len(found) == 0 {
+		return fmt.Errorf("host %s is not found in %s", args[0], f.Path())
+	}
+
+	return printKnownHosts(found)
+}
+
+func runKnownHostsRemove(cmd *cobra.Command, args []string) error {
+	if (len(args) == 0) == (knownHostsLine == 0) {
+		return fmt.Errorf("either host or --line is required")
+	}
+	f, err := loadKnownHosts()
+	if err != nil {
+		return err
+	}
+
+	var removed int
+	if knownHostsLine != 0 {
+		if f.RemoveLine(knownHostsLine) {
+			removed = 1
+		}
+	} else {
+		removed = f.RemoveHost(args[0])
+	}
+	if removed == 0 {
+		return fmt.Errorf("nothing to remove in %s", f.Path())
+	}
+	if err := f.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d entries from %s\n", removed, f.Path())
+
+	return nil
+}
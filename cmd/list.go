@@ -0,0 +1,128 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/dirs"
+	"github.com/mixanemca/ssh-keys/internal/metadata"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List private keys with their metadata",
+	Args:  cobra.NoArgs,
+	RunE:  runList,
+}
+
+var (
+	// listTags keeps only the keys with all the tags.
+	listTags []string
+	// listOwner keeps only the keys of the owner.
+	listOwner string
+	// listExpired keeps only the keys past their intended expiry date.
+	listExpired bool
+)
+
+func init() {
+	listCmd.Flags().StringArrayVarP(&listTags, "tag", "t", nil, "show keys with the tag, may be repeated")
+	listCmd.Flags().StringVar(&listOwner, "owner", "", "show keys of the owner")
+	listCmd.Flags().BoolVar(&listExpired, "expired", false, "show keys past their expiry date")
+
+	rootCmd.AddCommand(listCmd)
+}
+
+// loadMetadata reads the metadata file in the data directory.
+func loadMetadata() (*metadata.Store, error) {
+	path, err := metadataPath()
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata.Load(path)
+}
+
+// metadataPath returns the path of the metadata file.
+func metadataPath() (string, error) {
+	return dirs.DataFile("metadata.json")
+}
+
+// listKeys returns the keys of the store with their metadata.
+func listKeys() ([]*models.Key, error) {
+	store, err := keyStore()
+	if err != nil {
+		return nil, err
+	}
+	list, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	md, err := loadMetadata()
+	if err != nil {
+		return nil, err
+	}
+	md.Apply(list)
+
+	return list, nil
+}
+
+// matchList reports whether the key passes the filters of list command.
+func matchList(k *models.Key, now time.Time) bool {
+	for _, tag := range listTags {
+		if !k.Metadata.HasTag(tag) {
+			return false
+		}
+	}
+	if listOwner != "" && k.Metadata.Owner != listOwner {
+		return false
+	}
+
+	return !listExpired || k.Metadata.Expired(now)
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	list, err := listKeys()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tFINGERPRINT\tTAGS\tOWNER\tEXPIRES")
+	for _, k := range list {
+		if !matchList(k, now) {
+			continue
+		}
+		var expires string
+		if !k.Metadata.Expires.IsZero() {
+			expires = k.Metadata.Expires.Format(metadata.DateLayout)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", k.Name, k.Format, ssh.FingerprintSHA256(k.Public),
+			strings.Join(k.Metadata.Tags, ","), k.Metadata.Owner, expires)
+	}
+
+	return w.Flush()
+}
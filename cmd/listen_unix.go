@@ -0,0 +1,34 @@
+//go:build unix
+
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenPrivate listens on the UNIX socket accessible only to the user. The
+// socket is created with the restrictive umask, so there is no moment when
+// others may connect to it.
+func listenPrivate(path string) (net.Listener, error) {
+	mask := syscall.Umask(0177)
+	defer syscall.Umask(mask)
+
+	return net.Listen("unix", path)
+}
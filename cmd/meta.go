@@ -0,0 +1,129 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/metadata"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// metaCmd represents the meta command
+var metaCmd = &cobra.Command{
+	Use:   "meta <name>",
+	Short: "Show or edit metadata of a key",
+	Long: `Show or edit metadata of a key: tags, owner, purpose, notes, the date the
+key is intended to be replaced at and the creation date.
+
+The metadata is kept in $XDG_DATA_HOME/ssh-keys/metadata.json by the key
+fingerprint, so it stays with the key when it is renamed. An empty value
+clears the field.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runMeta,
+}
+
+var (
+	// metaTags are the comma separated tags of the key.
+	metaTags string
+	// metaOwner is the owner of the key.
+	metaOwner string
+	// metaPurpose is the purpose of the key.
+	metaPurpose string
+	// metaNotes are the notes about the key.
+	metaNotes string
+	// metaExpires is the expiry date or the duration from now.
+	metaExpires string
+	// metaCreated is the creation date of the key.
+	metaCreated string
+)
+
+func init() {
+	metaCmd.Flags().StringVar(&metaTags, "tags", "", "comma separated tags")
+	metaCmd.Flags().StringVar(&metaOwner, "owner", "", "person or team responsible for the key")
+	metaCmd.Flags().StringVar(&metaPurpose, "purpose", "", "what the key is used for")
+	metaCmd.Flags().StringVar(&metaNotes, "notes", "", "free form notes")
+	metaCmd.Flags().StringVar(&metaExpires, "expires", "", "intended expiry date as YYYY-MM-DD or duration from now like 90d")
+	metaCmd.Flags().StringVar(&metaCreated, "created", "", "creation date as YYYY-MM-DD, when the key file time is wrong")
+
+	rootCmd.AddCommand(metaCmd)
+}
+
+// parseExpires parses the expiry date or the duration from now.
+func parseExpires(s string) (time.Time, error) {
+	if d, err := parseDuration(s); err == nil {
+		return time.Now().Add(d), nil
+	}
+
+	return metadata.ParseDate(s)
+}
+
+func runMeta(cmd *cobra.Command, args []string) error {
+	store, err := keyStore()
+	if err != nil {
+		return err
+	}
+	key, err := store.Get(args[0])
+	if err != nil {
+		return err
+	}
+	s, err := loadMetadata()
+	if err != nil {
+		return err
+	}
+	fp := ssh.FingerprintSHA256(key.Public)
+	md := s.Get(fp)
+
+	flags := cmd.Flags()
+	if flags.Changed("tags") {
+		md.Tags = metadata.ParseTags(metaTags)
+	}
+	if flags.Changed("owner") {
+		md.Owner = metaOwner
+	}
+	if flags.Changed("purpose") {
+		md.Purpose = metaPurpose
+	}
+	if flags.Changed("notes") {
+		md.Notes = metaNotes
+	}
+	if flags.Changed("expires") {
+		if md.Expires, err = parseExpires(metaExpires); err != nil {
+			return err
+		}
+	}
+	if flags.Changed("created") {
+		if md.Created, err = metadata.ParseDate(metaCreated); err != nil {
+			return err
+		}
+	}
+	if flags.NFlag() > 0 {
+		s.Set(fp, md)
+		if err := s.Save(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Name: %s\nFingerprint: %s\n", key.Name, fp)
+	for _, line := range metadata.Describe(md) {
+		fmt.Println(line)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// passphraseEnv is the environment variable to pass the vault passphrase
+// non-interactively, e.g. in scripts.
+const passphraseEnv = "SSH_KEYS_VAULT_PASSPHRASE"
+
+// stdin is shared by all prompts, so buffered lines are not lost between them.
+var stdin = bufio.NewReader(os.Stdin)
+
+// readPassphrase reads the vault passphrase from the environment or asks the
+// user for it on the terminal.
+func readPassphrase(prompt string) ([]byte, error) {
+	if p, ok := os.LookupEnv(passphraseEnv); ok {
+		return []byte(p), nil
+	}
+
+	return promptSecret(prompt)
+}
+
+// readNewPassphrase asks the user for a new vault passphrase twice.
+func readNewPassphrase() ([]byte, error) {
+	if p, ok := os.LookupEnv(passphraseEnv); ok {
+		return []byte(p), nil
+	}
+
+	return promptNewSecret("vault passphrase")
+}
+
+// promptNewSecret asks the user for a new secret twice.
+func promptNewSecret(what string) ([]byte, error) {
+	first, err := promptSecret("New " + what + ": ")
+	if err != nil {
+		return nil, err
+	}
+	second, err := promptSecret("Repeat " + what + ": ")
+	if err != nil {
+		return nil, err
+	}
+	if string(first) != string(second) {
+		return nil, fmt.Errorf("%ss do not match", what)
+	}
+
+	return first, nil
+}
+
+// promptSecret prints the prompt to stderr and reads a secret without echo.
+// When stdin is not a terminal, the secret is read as a line.
+func promptSecret(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		secret, err := term.ReadPassword(fd)
+		if err != nil {
+			return nil, fmt.Errorf("read secret: %v", err)
+		}
+		return secret, nil
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return nil, fmt.Errorf("read secret: %v", err)
+	}
+
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
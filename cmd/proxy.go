@@ -0,0 +1,127 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/mixanemca/ssh-keys/internal/agents"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// agentProxyCmd represents the agent proxy command
+var agentProxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Serve an ssh-agent proxy which logs every request",
+	Long: `Serve an ssh-agent proxy which logs every request.
+
+The proxy listens on the --listen socket and forwards the requests to the
+--upstream agent. Listing, signing, adding and removing keys are logged as
+JSON lines with the key fingerprints, the signature flags and the purpose of
+signing. Point SSH_AUTH_SOCK of a program to the socket to see how it uses
+the agent. With --confirm, every signing is asked for on the terminal.`,
+	Args:         cobra.NoArgs,
+	RunE:         runAgentProxy,
+	SilenceUsage: true,
+}
+
+var (
+	// proxyUpstream is the socket of the agent the requests are forwarded to.
+	proxyUpstream string
+	// proxyListen is the socket the proxy listens on.
+	proxyListen string
+	// proxyLog is the path of the log file, stderr if empty.
+	proxyLog string
+	// proxyConfirm asks before each signing.
+	proxyConfirm bool
+)
+
+func init() {
+	agentProxyCmd.Flags().StringVar(&proxyUpstream, "upstream", os.Getenv("SSH_AUTH_SOCK"), "socket of the agent to forward the requests to")
+	agentProxyCmd.Flags().StringVar(&proxyListen, "listen", "", "socket to listen on")
+	agentProxyCmd.Flags().StringVar(&proxyLog, "log", "", "file to append the log to (default stderr)")
+	agentProxyCmd.Flags().BoolVar(&proxyConfirm, "confirm", false, "ask before each signing")
+	_ = agentProxyCmd.MarkFlagRequired("listen")
+
+	agentCmd.AddCommand(agentProxyCmd)
+}
+
+func runAgentProxy(cmd *cobra.Command, args []string) error {
+	if proxyUpstream == "" {
+		return fmt.Errorf("upstream agent socket is not set, use --upstream or SSH_AUTH_SOCK")
+	}
+
+	out := os.Stderr
+	if proxyLog != "" {
+		f, err := os.OpenFile(proxyLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("open log file: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	p := &agents.Proxy{
+		Upstream: agents.NewSocketProvider(proxyUpstream),
+		Log:      slog.New(slog.NewJSONHandler(out, nil)),
+	}
+	if proxyConfirm {
+		p.Confirm = confirmSign
+	}
+
+	// The socket gives the access to the agent keys.
+	l, err := listenPrivate(proxyListen)
+	if err != nil {
+		return fmt.Errorf("listen: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// Closing removes the socket.
+		l.Close()
+	}()
+
+	fmt.Printf("SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", proxyListen)
+	p.Log.Info("proxy started", "listen", proxyListen, "upstream", proxyUpstream)
+	if err := p.Serve(l); err != nil {
+		return fmt.Errorf("serve: %v", err)
+	}
+	p.Log.Info("proxy stopped")
+
+	return nil
+}
+
+// confirmSign asks on the terminal whether to sign with the key.
+func confirmSign(req agents.SignRequest) bool {
+	fmt.Fprintf(os.Stderr, "Sign with %s %s for %s? [y/N]: ", req.Key.Type(), ssh.FingerprintSHA256(req.Key), req.Purpose)
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+
+	return answer == "y" || answer == "yes"
+}
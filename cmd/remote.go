@@ -0,0 +1,135 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/agents"
+	"github.com/mixanemca/ssh-keys/internal/remote"
+	"github.com/mixanemca/ssh-keys/internal/sshconfig"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// dialTimeout limits the time of connecting to remote hosts.
+const dialTimeout = 30 * time.Second
+
+// acceptNewHostKey adds keys of unknown hosts to known_hosts file.
+var acceptNewHostKey bool
+
+// newDialer creates a dialer which authenticates with the keys of SSH agent
+// and verifies host keys with known_hosts file. With interactive set, the
+// password is asked when the keys are not accepted. The dialer connects to
+// the agent once, on the first use, and the returned function closes the
+// connection.
+func newDialer(provider agents.Provider, interactive bool) (*remote.Dialer, func(), error) {
+	path, err := knownHostsPath()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		mu     sync.Mutex
+		client agent.ExtendedAgent
+	)
+	d := &remote.Dialer{
+		Signers: func() ([]ssh.Signer, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if client == nil {
+				c, err := provider.Connect()
+				if err != nil {
+					// Without agent, the password is the only way.
+					return nil, nil
+				}
+				client = c
+			}
+			return client.Signers()
+		},
+		HostKeyCallback: remote.KnownHostsCallback(path, acceptNewHostKey),
+		Timeout:         dialTimeout,
+	}
+	if interactive {
+		d.Password = func(t remote.Target) (string, error) {
+			password, err := promptSecret(t.String() + "'s password: ")
+			return string(password), err
+		}
+	}
+
+	closeAgent := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if c, ok := client.(io.Closer); ok {
+			c.Close()
+		}
+		client = nil
+	}
+
+	return d, closeAgent, nil
+}
+
+// agentProvider returns the provider of the first SSH agent, the one at
+// $SSH_AUTH_SOCK when it is set.
+func agentProvider() agents.Provider {
+	return agentEndpoints()[0].Provider
+}
+
+// agentEndpoints returns the SSH agents: the one at $SSH_AUTH_SOCK, the ones
+// of --agent-socket flags and the existing sockets of IdentityAgent options
+// in ~/.ssh/config. There is at least one agent, even if it is unreachable.
+func agentEndpoints() []agents.Endpoint {
+	var (
+		endpoints []agents.Endpoint
+		paths     []string
+	)
+	add := func(e agents.Endpoint) {
+		path := e.Provider.(*agents.SocketProvider).Path
+		if !slices.Contains(paths, path) {
+			endpoints = append(endpoints, e)
+			paths = append(paths, path)
+		}
+	}
+
+	// ssh-agent(1) provides a UNIX socket at $SSH_AUTH_SOCK.
+	if os.Getenv("SSH_AUTH_SOCK") != "" {
+		add(agents.DefaultEndpoint())
+	}
+	for _, s := range agentSockets {
+		add(agents.ParseEndpoint(s))
+	}
+	if path, err := sshConfigPath(); err == nil {
+		if cfg, err := sshconfig.Load(path); err == nil {
+			sockets, _ := cfg.IdentityAgents()
+			for _, socket := range sockets {
+				if _, err := os.Stat(socket); err == nil {
+					add(agents.ParseEndpoint(socket))
+				}
+			}
+		}
+	}
+	if len(endpoints) == 0 {
+		// Report the missing agent on use.
+		add(agents.DefaultEndpoint())
+	}
+
+	return endpoints
+}
@@ -20,11 +20,19 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mixanemca/ssh-keys/internal/dirs"
+	"github.com/mixanemca/ssh-keys/internal/gitconfig"
+	"github.com/mixanemca/ssh-keys/internal/keys"
 	"github.com/mixanemca/ssh-keys/internal/ui"
+	"github.com/mixanemca/ssh-keys/internal/usage"
+	"github.com/mixanemca/ssh-keys/internal/vault"
 	"github.com/spf13/cobra"
 	"github.com/version-go/ldflags"
+	"golang.org/x/crypto/ssh"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -37,10 +45,86 @@ var rootCmd = &cobra.Command{
 	Run:           run,
 }
 
+var (
+	// keysDir is the directory with private keys.
+	keysDir string
+	// vaultFile is the path of the encrypted vault.
+	vaultFile string
+	// withVault enables the vault section in TUI.
+	withVault bool
+	// certLifetime limits lifetime of certificates in agent by their validity.
+	certLifetime bool
+	// maxAge is the rotation period of keys.
+	maxAge string
+	// usageLog enables recording of key usage.
+	usageLog bool
+	// agentSockets are the sockets of additional SSH agents as NAME=PATH
+	// or PATH.
+	agentSockets []string
+)
+
 func init() {
 	build := ldflags.Build()
 	vt := rootCmd.VersionTemplate()
 	rootCmd.SetVersionTemplate(vt[:len(vt)-1] + " (" + build + ")\n")
+
+	rootCmd.PersistentFlags().StringVar(&keysDir, "keys-dir", "", "directory with private keys (default ~/.ssh)")
+	rootCmd.PersistentFlags().StringVar(&vaultFile, "vault-file", "", "path of the encrypted vault (default $XDG_DATA_HOME/ssh-keys/vault)")
+	rootCmd.PersistentFlags().BoolVar(&usageLog, "usage-log", false, "record use of keys to $XDG_DATA_HOME/ssh-keys/usage.log")
+	rootCmd.PersistentFlags().StringArrayVar(&agentSockets, "agent-socket", nil, "socket of another ssh-agent as NAME=PATH or PATH, may be repeated")
+	rootCmd.Flags().BoolVar(&withVault, "vault", false, "show keys from the encrypted vault")
+	rootCmd.Flags().BoolVar(&certLifetime, "cert-lifetime", false, "limit lifetime of certificates in ssh-agent by their validity")
+	rootCmd.Flags().StringVar(&maxAge, "max-age", "365d", "rotation period, older keys are highlighted, 0 disables")
+}
+
+// keyStore returns the store of private keys in the keys directory.
+func keyStore() (*keys.FSStore, error) {
+	dir := keysDir
+	if dir == "" {
+		var err error
+		if dir, err = dirs.SSHDir(); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys.NewFSStore(dir), nil
+}
+
+// vaultPath returns the path of the encrypted vault.
+func vaultPath() (string, error) {
+	if vaultFile != "" {
+		return vaultFile, nil
+	}
+
+	return dirs.DataFile("vault")
+}
+
+// openVault asks for the master passphrase and opens the vault.
+func openVault() (*vault.Vault, error) {
+	path, err := vaultPath()
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := readPassphrase("Vault passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+
+	return vault.Open(path, passphrase)
+}
+
+// recordUsage appends the use of the key to the usage log when it is
+// enabled by --usage-log.
+func recordUsage(key ssh.PublicKey, action, host string) error {
+	if !usageLog {
+		return nil
+	}
+	path, err := dirs.DataFile("usage.log")
+	if err != nil {
+		return err
+	}
+
+	return usage.Append(path, usage.NewEvent(time.Now(), key, action, host))
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -53,8 +137,60 @@ func Execute() {
 }
 
 func run(cmd *cobra.Command, args []string) {
+	store, err := keyStore()
+	if err != nil {
+		fmt.Printf("Failed to find keys dir: %v\n", err)
+		os.Exit(1)
+	}
+	endpoints := agentEndpoints()
+	provider := endpoints[0].Provider
+
+	period, err := parseDuration(maxAge)
+	if err != nil {
+		fmt.Printf("Invalid --max-age: %v\n", err)
+		os.Exit(1)
+	}
+	opts := []ui.Option{ui.WithMaxAge(period), ui.WithAgents(endpoints...)}
+	if path, err := authorizedPath(); err == nil {
+		opts = append(opts, ui.WithAuthorizedKeys(path))
+	}
+	if path, err := knownHostsPath(); err == nil {
+		opts = append(opts, ui.WithKnownHosts(path))
+	}
+	if path, err := allowedSignersPath(); err == nil {
+		opts = append(opts, ui.WithAllowedSigners(path))
+	}
+	// The password can not be asked while TUI is running. The TUI replaces
+	// the signers with the ones of the selected agent.
+	if d, closeAgent, err := newDialer(provider, false); err == nil {
+		defer closeAgent()
+		opts = append(opts, ui.WithDialer(d))
+	}
+	if _, err := exec.LookPath("git"); err == nil {
+		opts = append(opts, ui.WithGit(&gitconfig.Git{}))
+	}
+	if path, err := metadataPath(); err == nil {
+		opts = append(opts, ui.WithMetadata(path))
+	}
+	if usageLog {
+		if path, err := dirs.DataFile("usage.log"); err == nil {
+			opts = append(opts, ui.WithUsageLog(path))
+		}
+	}
+	if certLifetime {
+		opts = append(opts, ui.WithCertificateLifetime())
+	}
+	if withVault {
+		v, err := openVault()
+		if err != nil {
+			fmt.Printf("Failed to open vault: %v\n", err)
+			os.Exit(1)
+		}
+		opts = append(opts, ui.WithVault(v))
+	}
+
 	// Create a new TUI model which will be rendered in Bubbletea.
-	state, err := ui.NewModel()
+	state, err := ui.NewModel(store, provider, opts...)
 	if err != nil {
 		fmt.Printf("Error starting init command: %v\n", err)
 		os.Exit(1)
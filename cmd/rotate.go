@@ -0,0 +1,238 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/dirs"
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/mixanemca/ssh-keys/internal/remote"
+	"github.com/mixanemca/ssh-keys/internal/rotate"
+	"github.com/mixanemca/ssh-keys/internal/sshconfig"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// rotateCmd represents the rotate command
+var rotateCmd = &cobra.Command{
+	Use:   "rotate <name>",
+	Short: "Replace the key with a new one on all hosts using it",
+	Long: `Replace the key with a new one of the same type on all hosts using it.
+
+The hosts are the ones with the key as IdentityFile in ~/.ssh/config. For
+every host the new key is deployed, the login with it is verified and the
+old key is removed from authorized_keys. Then the old key is archived and
+the new key takes its name.
+
+The progress is saved after every step. When some hosts fail, fix them and
+run the command again to resume.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRotate,
+}
+
+var (
+	// rotateDryRun only shows the plan of the rotation.
+	rotateDryRun bool
+	// sshConfigFile is the path of ssh_config file.
+	sshConfigFile string
+)
+
+func init() {
+	rotateCmd.Flags().BoolVarP(&rotateDryRun, "dry-run", "n", false, "show what would be done without changing anything")
+	rotateCmd.Flags().StringVar(&sshConfigFile, "ssh-config", "", "path of ssh_config file (default ~/.ssh/config)")
+	rotateCmd.Flags().StringVar(&knownHostsFile, "known-hosts", "", "path of known_hosts file (default ~/.ssh/known_hosts)")
+	rotateCmd.Flags().BoolVar(&acceptNewHostKey, "accept-new", false, "add keys of unknown hosts to known_hosts file")
+
+	rootCmd.AddCommand(rotateCmd)
+}
+
+// sshConfigPath returns the path of ssh_config file.
+func sshConfigPath() (string, error) {
+	if sshConfigFile != "" {
+		return sshConfigFile, nil
+	}
+	dir, err := dirs.SSHDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "config"), nil
+}
+
+// configTarget returns the account the host alias of ssh_config logs in to.
+func configTarget(cfg *sshconfig.Config, alias string) (remote.Target, error) {
+	host := strings.ReplaceAll(cfg.Get(alias, "hostname"), "%h", alias)
+	if host == "" {
+		host = alias
+	}
+	t, err := remote.ParseTarget(cfg.Get(alias, "user") + "@" + host)
+	if err != nil {
+		return remote.Target{}, err
+	}
+	if port := cfg.Get(alias, "port"); port != "" {
+		if t.Port, err = strconv.Atoi(port); err != nil {
+			return remote.Target{}, fmt.Errorf("invalid port of %s: %s", alias, port)
+		}
+	}
+
+	return t, nil
+}
+
+// configHosts returns the hosts of ssh_config which use the key.
+func configHosts(key string) ([]*rotate.Host, error) {
+	path, err := sshConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := sshconfig.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := cfg.HostsWithIdentity(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []*rotate.Host
+	for _, alias := range aliases {
+		t, err := configTarget(cfg, alias)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, &rotate.Host{Alias: alias, Target: t})
+	}
+
+	return hosts, nil
+}
+
+// newRotator creates a rotator keeping its state in the data directory. The
+// returned function closes the connection of the dialer to SSH agent.
+func newRotator(store keys.KeyStore) (*rotate.Rotator, func(), error) {
+	dataDir, err := dirs.DataDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	d, closeAgent, err := newDialer(agentProvider(), true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &rotate.Rotator{
+		Store:    store,
+		Archive:  keys.NewFSStore(filepath.Join(dataDir, "archive")),
+		Dialer:   d,
+		StateDir: filepath.Join(dataDir, "rotate"),
+		Output:   os.Stdout,
+	}, closeAgent, nil
+}
+
+func runRotate(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	store, err := keyStore()
+	if err != nil {
+		return err
+	}
+	r, closeAgent, err := newRotator(store)
+	if err != nil {
+		return err
+	}
+	defer closeAgent()
+
+	// The hosts of an unfinished rotation come from its state, so the key
+	// may be missing in the store when it was already archived.
+	var hosts []*rotate.Host
+	if key, err := store.Get(name); err == nil {
+		if hosts, err = configHosts(key.Path); err != nil {
+			return err
+		}
+	}
+	state, err := r.Plan(name, hosts)
+	if err != nil {
+		return err
+	}
+	if len(state.Hosts) == 0 {
+		return fmt.Errorf("no hosts use key %s in ssh config", name)
+	}
+
+	if rotateDryRun {
+		return printRotationPlan(state)
+	}
+
+	if err := r.Run(name, hosts); err != nil {
+		return err
+	}
+
+	return moveMetadata(store, name, state.OldFingerprint)
+}
+
+// moveMetadata passes the metadata of the old key to the new one with the
+// name, except the expiry date as the new key starts its own lifetime.
+func moveMetadata(store keys.KeyStore, name, oldFingerprint string) error {
+	key, err := store.Get(name)
+	if err != nil {
+		return err
+	}
+	s, err := loadMetadata()
+	if err != nil {
+		return err
+	}
+	md := s.Get(oldFingerprint)
+	if md.IsZero() {
+		return nil
+	}
+	md.Expires = time.Time{}
+	s.Set(ssh.FingerprintSHA256(key.Public), md)
+	s.Set(oldFingerprint, models.Metadata{})
+
+	return s.Save()
+}
+
+// printRotationPlan prints what the rotation is going to do.
+func printRotationPlan(state *rotate.State) error {
+	newName := state.Name + rotate.NewSuffix
+	if state.NewFingerprint == "" {
+		fmt.Printf("Generate key %s to replace %s (%s)\n", newName, state.Name, state.OldFingerprint)
+	} else {
+		fmt.Printf("Resume rotation of %s (%s) started at %s with key %s (%s)\n",
+			state.Name, state.OldFingerprint, state.Started.Format("2006-01-02 15:04:05"), newName, state.NewFingerprint)
+	}
+
+	fmt.Println("Deploy the new key, verify login and remove the old key on hosts:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tTARGET\tSTAGE")
+	for _, h := range state.Hosts {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", h.Alias, h.Target, h.Stage)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if !state.Archived {
+		fmt.Printf("Archive the old key %s\n", state.Name)
+	}
+	fmt.Printf("Rename %s to %s\n", newName, state.Name)
+
+	return nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/mixanemca/ssh-keys/internal/agents"
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/mixanemca/ssh-keys/internal/sshsig"
+	"github.com/mixanemca/ssh-keys/internal/usage"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// signCmd represents the sign command
+var signCmd = &cobra.Command{
+	Use:   "sign <name> <file>...",
+	Short: "Sign files with a key, like ssh-keygen -Y sign",
+	Long: `Sign files with a key, like ssh-keygen -Y sign.
+
+The signature of every file is written in SSHSIG format next to it, with
+.sig suffix. With "-" as the file, stdin is signed and the signature is
+written to stdout. The key signs through ssh-agent when it is loaded there.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runSign,
+}
+
+// signNamespace is the namespace of signatures.
+var signNamespace string
+
+func init() {
+	signCmd.Flags().StringVarP(&signNamespace, "namespace", "n", sshsig.DefaultNamespace, "signature namespace, like file or git")
+
+	rootCmd.AddCommand(signCmd)
+}
+
+func runSign(cmd *cobra.Command, args []string) error {
+	store, err := keyStore()
+	if err != nil {
+		return err
+	}
+	key, err := store.Get(args[0])
+	if err != nil {
+		return err
+	}
+	signer, err := keySigner(key, agentProvider())
+	if err != nil {
+		return err
+	}
+
+	for _, name := range args[1:] {
+		if err := signFile(signer, name); err != nil {
+			return err
+		}
+	}
+
+	return recordUsage(key.Public, usage.ActionSign, "")
+}
+
+// signFile writes the signature of the file to the .sig file, or to stdout
+// when the file is "-".
+func signFile(signer ssh.Signer, name string) error {
+	if name == "-" {
+		sig, err := sshsig.Sign(signer, stdin, signNamespace)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(sig.Armor())
+		return err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sig, err := sshsig.Sign(signer, f, signNamespace)
+	if err != nil {
+		return fmt.Errorf("sign %s: %w", name, err)
+	}
+	if err := os.WriteFile(name+".sig", sig.Armor(), 0644); err != nil {
+		return fmt.Errorf("write signature: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Signature of %s was written to %s.sig\n", name, name)
+
+	return nil
+}
+
+// keySigner returns the signer of the key. The key signs through SSH agent
+// when it is loaded there, and directly otherwise. Security keys sign only
+// through the agent, which talks to the token.
+func keySigner(key *models.Key, provider agents.Provider) (ssh.Signer, error) {
+	if client, err := provider.Connect(); err == nil {
+		if loaded, err := client.List(); err == nil {
+			blob := key.Public.Marshal()
+			for _, k := range loaded {
+				if bytes.Equal(k.Blob, blob) {
+					return agents.NewSigner(client, key.Public), nil
+				}
+			}
+		}
+	}
+
+	return keys.NewSigner(key)
+}
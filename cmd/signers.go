@@ -0,0 +1,209 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/dirs"
+	"github.com/mixanemca/ssh-keys/internal/signers"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// signersCmd represents the allowed-signers command
+var signersCmd = &cobra.Command{
+	Use:   "allowed-signers",
+	Short: "Manage allowed_signers file for verification of SSH signatures",
+	Long: `Manage allowed_signers file for verification of SSH signatures.
+
+The file lists the keys trusted to sign as the principals, usually emails.
+Git uses it to verify SSH commit signatures, see gpg.ssh.allowedSignersFile.`,
+}
+
+var signersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List allowed signers",
+	Args:  cobra.NoArgs,
+	RunE:  runSignersList,
+}
+
+var signersAddCmd = &cobra.Command{
+	Use:   "add <key>",
+	Short: "Allow a key from the keys directory to sign as the principal",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSignersAdd,
+}
+
+var signersRemoveCmd = &cobra.Command{
+	Use:   "remove <fingerprint>",
+	Short: "Remove all entries of the key with the SHA256 fingerprint",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSignersRemove,
+}
+
+var signersValidateCmd = &cobra.Command{
+	Use:          "validate",
+	Short:        "Check the file for broken, expired and repeated entries",
+	Args:         cobra.NoArgs,
+	RunE:         runSignersValidate,
+	SilenceUsage: true,
+}
+
+var (
+	// allowedSignersFile is the path of allowed_signers file.
+	allowedSignersFile string
+	// signerPrincipals are the principals of the added key.
+	signerPrincipals []string
+	// signerNamespaces are the namespaces the added key may sign in.
+	signerNamespaces []string
+)
+
+func init() {
+	signersCmd.PersistentFlags().StringVar(&allowedSignersFile, "file", "", "path of allowed_signers file (default ~/.ssh/allowed_signers)")
+	signersAddCmd.Flags().StringSliceVarP(&signerPrincipals, "principal", "p", nil, "principal to sign as, like the email of git commits")
+	signersAddCmd.Flags().StringSliceVarP(&signerNamespaces, "namespace", "n", nil, "namespace the key may sign in, like git (default any)")
+	_ = signersAddCmd.MarkFlagRequired("principal")
+
+	signersCmd.AddCommand(signersListCmd, signersAddCmd, signersRemoveCmd, signersValidateCmd)
+	rootCmd.AddCommand(signersCmd)
+}
+
+// allowedSignersPath returns the path of allowed_signers file.
+func allowedSignersPath() (string, error) {
+	if allowedSignersFile != "" {
+		return allowedSignersFile, nil
+	}
+	dir, err := dirs.SSHDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "allowed_signers"), nil
+}
+
+// loadAllowedSigners reads allowed_signers file.
+func loadAllowedSigners() (*signers.File, error) {
+	path, err := allowedSignersPath()
+	if err != nil {
+		return nil, err
+	}
+
+	return signers.Load(path)
+}
+
+func runSignersList(cmd *cobra.Command, args []string) error {
+	f, err := loadAllowedSigners()
+	if err != nil {
+		return err
+	}
+	// Show names of the local keys, it is easier to recognize them.
+	names := map[string]string{}
+	if found, err := listKeys(); err == nil {
+		for _, k := range found {
+			names[ssh.FingerprintSHA256(k.Public)] = k.Name
+		}
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tPRINCIPALS\tTYPE\tFINGERPRINT\tKEY\tNAMESPACES\tSTATUS")
+	for _, e := range f.Entries() {
+		namespaces := strings.Join(e.Namespaces(), ",")
+		if namespaces == "" {
+			namespaces = "*"
+		}
+		var status []string
+		if e.CertAuthority() {
+			status = append(status, "cert-authority")
+		}
+		if !e.Valid(now) {
+			status = append(status, "invalid now")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Line, strings.Join(e.Principals, ","), e.Key.Type(),
+			e.Fingerprint(), names[e.Fingerprint()], namespaces, strings.Join(status, ","))
+	}
+
+	return w.Flush()
+}
+
+func runSignersAdd(cmd *cobra.Command, args []string) error {
+	store, err := keyStore()
+	if err != nil {
+		return err
+	}
+	key, err := store.Get(args[0])
+	if err != nil {
+		return err
+	}
+	f, err := loadAllowedSigners()
+	if err != nil {
+		return err
+	}
+
+	e, err := f.Add(signerPrincipals, key.Public, signerNamespaces, key.Comment)
+	if err != nil {
+		return err
+	}
+	if err := f.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Allowed %s %s to sign as %s in %s\n", key.Name, e.Fingerprint(), strings.Join(e.Principals, ","), f.Path())
+
+	return nil
+}
+
+func runSignersRemove(cmd *cobra.Command, args []string) error {
+	f, err := loadAllowedSigners()
+	if err != nil {
+		return err
+	}
+
+	removed := f.Remove(args[0])
+	if removed == 0 {
+		return fmt.Errorf("no entries with fingerprint %s in %s", args[0], f.Path())
+	}
+	if err := f.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d entries from %s\n", removed, f.Path())
+
+	return nil
+}
+
+func runSignersValidate(cmd *cobra.Command, args []string) error {
+	f, err := loadAllowedSigners()
+	if err != nil {
+		return err
+	}
+
+	problems := f.Validate(time.Now())
+	for _, p := range problems {
+		fmt.Printf("%s:%d: %s\n", f.Path(), p.Line, p.Text)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found in %s", len(problems), f.Path())
+	}
+	fmt.Printf("%s is valid, %d entries\n", f.Path(), len(f.Entries()))
+
+	return nil
+}
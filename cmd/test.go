@@ -0,0 +1,90 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/remote"
+	"github.com/mixanemca/ssh-keys/internal/usage"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// testCmd represents the test command
+var testCmd = &cobra.Command{
+	Use:   "test <name> <user@host[:port]>",
+	Short: "Check whether a host accepts the key",
+	Long: `Check whether a host accepts the key.
+
+Only the key is offered to the server, neither ssh-agent nor password is
+used. The host key fingerprint and the authentication methods offered by
+the server are shown too. The command fails when the key is not accepted.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runTest,
+}
+
+func init() {
+	testCmd.Flags().StringVar(&knownHostsFile, "known-hosts", "", "path of known_hosts file (default ~/.ssh/known_hosts)")
+	testCmd.Flags().BoolVar(&acceptNewHostKey, "accept-new", false, "add keys of unknown hosts to known_hosts file")
+
+	rootCmd.AddCommand(testCmd)
+}
+
+func runTest(cmd *cobra.Command, args []string) error {
+	store, err := keyStore()
+	if err != nil {
+		return err
+	}
+	key, err := store.Get(args[0])
+	if err != nil {
+		return err
+	}
+	signer, err := keys.NewSigner(key)
+	if err != nil {
+		return err
+	}
+	target, err := remote.ParseTarget(args[1])
+	if err != nil {
+		return err
+	}
+	d, closeAgent, err := newDialer(agentProvider(), false)
+	if err != nil {
+		return err
+	}
+	defer closeAgent()
+
+	result, err := d.TestKey(target, signer)
+	if result.HostKey != nil {
+		fmt.Printf("Host key: %s %s\n", result.HostKey.Type(), ssh.FingerprintSHA256(result.HostKey))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Offered methods: %s\n", strings.Join(result.Methods, ", "))
+	if err := recordUsage(key.Public, usage.ActionTest, target.String()); err != nil {
+		return err
+	}
+	if !result.Accepted {
+		return fmt.Errorf("key %s is not accepted by %s", key.Name, target)
+	}
+	fmt.Printf("Key %s is accepted by %s\n", key.Name, target)
+
+	return nil
+}
@@ -0,0 +1,178 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/mixanemca/ssh-keys/internal/vault"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// vaultCmd represents the vault command
+var vaultCmd = &cobra.Command{
+	Use:   "vault",
+	Short: "Keep private keys in the encrypted vault",
+	Long: `The vault is a single file encrypted with a master passphrase which holds many
+private keys. The passphrase may be passed in the SSH_KEYS_VAULT_PASSPHRASE
+environment variable.`,
+}
+
+var vaultInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a new empty vault",
+	Args:  cobra.NoArgs,
+	RunE:  runVaultInit,
+}
+
+var vaultImportCmd = &cobra.Command{
+	Use:   "import <name>...",
+	Short: "Import private keys from the keys directory to the vault",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runVaultImport,
+}
+
+var vaultExportCmd = &cobra.Command{
+	Use:   "export <name>...",
+	Short: "Export private keys from the vault to the keys directory",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runVaultExport,
+}
+
+var vaultListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List keys in the vault",
+	Args:  cobra.NoArgs,
+	RunE:  runVaultList,
+}
+
+// vaultRemoveSource removes the plaintext key files after import.
+var vaultRemoveSource bool
+
+func init() {
+	vaultImportCmd.Flags().BoolVar(&vaultRemoveSource, "remove", false, "remove the plaintext key files after import")
+
+	vaultCmd.AddCommand(vaultInitCmd, vaultImportCmd, vaultExportCmd, vaultListCmd)
+	rootCmd.AddCommand(vaultCmd)
+}
+
+func runVaultInit(cmd *cobra.Command, args []string) error {
+	path, err := vaultPath()
+	if err != nil {
+		return err
+	}
+	passphrase, err := readNewPassphrase()
+	if err != nil {
+		return err
+	}
+	if _, err := vault.Create(path, passphrase); err != nil {
+		return err
+	}
+	fmt.Printf("Created vault %s\n", path)
+
+	return nil
+}
+
+func runVaultImport(cmd *cobra.Command, args []string) error {
+	store, err := keyStore()
+	if err != nil {
+		return err
+	}
+	path, err := vaultPath()
+	if err != nil {
+		return err
+	}
+
+	// Create the vault on the first import.
+	var v *vault.Vault
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		passphrase, err := readNewPassphrase()
+		if err != nil {
+			return err
+		}
+		if v, err = vault.Create(path, passphrase); err != nil {
+			return err
+		}
+	} else if v, err = openVault(); err != nil {
+		return err
+	}
+
+	for _, name := range args {
+		key, err := store.Get(name)
+		if err != nil {
+			return err
+		}
+		if err := v.Create(key); err != nil {
+			return err
+		}
+		if vaultRemoveSource {
+			if err := store.Delete(name); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Imported %s\n", name)
+	}
+
+	return nil
+}
+
+func runVaultExport(cmd *cobra.Command, args []string) error {
+	store, err := keyStore()
+	if err != nil {
+		return err
+	}
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range args {
+		key, err := v.Get(name)
+		if err != nil {
+			return err
+		}
+		if err := store.Create(key); err != nil {
+			return err
+		}
+		fmt.Printf("Exported %s to %s\n", name, key.Path)
+	}
+
+	return nil
+}
+
+func runVaultList(cmd *cobra.Command, args []string) error {
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	list, err := v.List()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tFINGERPRINT\tCOMMENT")
+	for _, k := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", k.Name, k.Format, ssh.FingerprintSHA256(k.Public), k.Comment)
+	}
+
+	return w.Flush()
+}
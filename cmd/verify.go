@@ -0,0 +1,121 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/sshsig"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify <file>",
+	Short: "Verify a signature of a file, like ssh-keygen -Y verify",
+	Long: `Verify a signature of a file, like ssh-keygen -Y verify.
+
+The signature is read from the file with .sig suffix unless --signature is
+given. The signing key must be allowed for the principal and the namespace
+in the allowed signers file. Without --principal, any allowed principal is
+accepted and reported. With "-" as the file, stdin is verified.`,
+	Args:         cobra.ExactArgs(1),
+	RunE:         runVerify,
+	SilenceUsage: true,
+}
+
+var (
+	// verifyPrincipal is the expected signer identity.
+	verifyPrincipal string
+	// verifySignature is the path of the signature file.
+	verifySignature string
+)
+
+func init() {
+	verifyCmd.Flags().StringVar(&allowedSignersFile, "allowed-signers", "", "path of allowed_signers file (default ~/.ssh/allowed_signers)")
+	verifyCmd.Flags().StringVarP(&verifyPrincipal, "principal", "I", "", "identity of the expected signer")
+	verifyCmd.Flags().StringVarP(&signNamespace, "namespace", "n", sshsig.DefaultNamespace, "signature namespace, like file or git")
+	verifyCmd.Flags().StringVarP(&verifySignature, "signature", "s", "", "path of the signature (default <file>.sig)")
+
+	rootCmd.AddCommand(verifyCmd)
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	sigPath := verifySignature
+	if sigPath == "" {
+		if name == "-" {
+			return fmt.Errorf("--signature is required to verify stdin")
+		}
+		sigPath = name + ".sig"
+	}
+	data, err := os.ReadFile(sigPath)
+	if err != nil {
+		return fmt.Errorf("read signature: %v", err)
+	}
+	sig, err := sshsig.Parse(data)
+	if err != nil {
+		return err
+	}
+	allowed, err := loadAllowedSigners()
+	if err != nil {
+		return err
+	}
+
+	var message io.Reader = stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		message = f
+	}
+	if err := sshsig.Verify(sig, message, signNamespace); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var principals []string
+	switch {
+	case verifyPrincipal == "":
+		principals = allowed.Principals(sig.PublicKey, signNamespace, now)
+	case allowed.Allowed(verifyPrincipal, sig.PublicKey, signNamespace, now):
+		principals = []string{verifyPrincipal}
+	}
+	if len(principals) == 0 {
+		return fmt.Errorf("key %s is not allowed to sign in namespace %q%s", ssh.FingerprintSHA256(sig.PublicKey), signNamespace, forPrincipal(verifyPrincipal))
+	}
+	fmt.Printf("Good %q signature for %s with %s key %s\n", signNamespace, strings.Join(principals, ", "), sig.PublicKey.Type(), ssh.FingerprintSHA256(sig.PublicKey))
+
+	return nil
+}
+
+// forPrincipal returns the " for principal" suffix of messages, if the
+// principal is given.
+func forPrincipal(principal string) string {
+	if principal == "" {
+		return ""
+	}
+
+	return " for " + principal
+}
@@ -0,0 +1,69 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agents
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Provider provides a connection to SSH agent.
+type Provider interface {
+	// Connect returns a client of SSH agent.
+	Connect() (agent.ExtendedAgent, error)
+}
+
+// SocketProvider connects to SSH agent listening on a UNIX socket.
+type SocketProvider struct {
+	// Path is a path to the agent socket, like $SSH_AUTH_SOCK.
+	Path string
+}
+
+// NewSocketProvider creates a new provider for the agent socket path.
+func NewSocketProvider(path string) *SocketProvider {
+	return &SocketProvider{Path: path}
+}
+
+// Connect implements Provider interface
+func (p *SocketProvider) Connect() (agent.ExtendedAgent, error) {
+	if p.Path == "" {
+		return nil, fmt.Errorf("agent socket path is empty")
+	}
+	conn, err := net.Dial("unix", p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("open agent socket %s: %w", p.Path, err)
+	}
+
+	return &socketClient{ExtendedAgent: agent.NewClient(conn), path: p.Path, conn: conn}, nil
+}
+
+// KeyringProvider provides an in-memory SSH agent. It is useful for testing.
+type KeyringProvider struct {
+	keyring agent.ExtendedAgent
+}
+
+// NewKeyringProvider creates a new provider with an empty in-memory agent.
+func NewKeyringProvider() *KeyringProvider {
+	return &KeyringProvider{keyring: agent.NewKeyring().(agent.ExtendedAgent)}
+}
+
+// Connect implements Provider interface
+func (p *KeyringProvider) Connect() (agent.ExtendedAgent, error) {
+	return p.keyring, nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agents
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Endpoint is a named SSH agent, like the local agent, the agent forwarded
+// over SSH or the SSH socket of gpg-agent.
+type Endpoint struct {
+	// Name identifies the agent for the user.
+	Name string
+	// Provider connects to the agent.
+	Provider Provider
+}
+
+// ParseEndpoint parses the agent socket given as NAME=PATH or PATH. The
+// name is derived from the path when it is omitted.
+func ParseEndpoint(s string) Endpoint {
+	name, path, ok := strings.Cut(s, "=")
+	if !ok {
+		name, path = "", s
+	}
+	if name == "" {
+		name = SocketName(path)
+	}
+
+	return Endpoint{Name: name, Provider: NewSocketProvider(path)}
+}
+
+// SocketName returns the name of the agent socket path. The sockets of
+// gpg-agent are recognized, other sockets are named by the file name.
+func SocketName(path string) string {
+	base := filepath.Base(path)
+	if strings.HasPrefix(base, "S.gpg-agent") {
+		return "gpg-agent"
+	}
+
+	return base
+}
+
+// DefaultEndpoint returns the agent at $SSH_AUTH_SOCK. It is named
+// "forwarded" inside SSH sessions, where sshd(8) sets the variable to the
+// socket of the forwarded agent, and "local" otherwise.
+func DefaultEndpoint() Endpoint {
+	name := "local"
+	if os.Getenv("SSH_CONNECTION") != "" {
+		name = "forwarded"
+	}
+
+	return Endpoint{Name: name, Provider: NewSocketProvider(os.Getenv("SSH_AUTH_SOCK"))}
+}
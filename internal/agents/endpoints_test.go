@@ -0,0 +1,52 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agents
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		in   string
+		name string
+		path string
+	}{
+		{"work=/tmp/work.sock", "work", "/tmp/work.sock"},
+		{"/run/user/1000/gnupg/S.gpg-agent.ssh", "gpg-agent", "/run/user/1000/gnupg/S.gpg-agent.ssh"},
+		{"/tmp/ssh-XXXXabcd/agent.1234", "agent.1234", "/tmp/ssh-XXXXabcd/agent.1234"},
+		{"=/tmp/agent.sock", "agent.sock", "/tmp/agent.sock"},
+	}
+	for _, tt := range tests {
+		e := ParseEndpoint(tt.in)
+		assert.Equal(t, tt.name, e.Name, tt.in)
+		assert.Equal(t, tt.path, e.Provider.(*SocketProvider).Path, tt.in)
+	}
+}
+
+func TestDefaultEndpoint(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+	t.Setenv("SSH_CONNECTION", "")
+	e := DefaultEndpoint()
+	assert.Equal(t, "local", e.Name)
+	assert.Equal(t, "/tmp/agent.sock", e.Provider.(*SocketProvider).Path)
+
+	t.Setenv("SSH_CONNECTION", "192.0.2.1 52000 192.0.2.2 22")
+	assert.Equal(t, "forwarded", DefaultEndpoint().Name)
+}
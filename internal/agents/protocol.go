@@ -0,0 +1,163 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agents
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// The messages of SSH agent protocol, which x/crypto/ssh/agent does not
+// implement. See draft-miller-ssh-agent.
+const (
+	agentFailure            = 5
+	agentSuccess            = 6
+	agentAddIdentity        = 17
+	agentAddSmartcardKey    = 20
+	agentRemoveSmartcardKey = 21
+	agentAddIDConstrained   = 25
+	agentConstrainExtension = 255
+)
+
+// maxAgentReply limits the size of agent replies.
+const maxAgentReply = 16 << 10
+
+// errAgentFailure is returned when the agent replies with failure.
+var errAgentFailure = errors.New("agent failure")
+
+// call sends the request to the agent at the socket path over a new
+// connection, so it does not interleave with requests of agent clients.
+func call(path string, req []byte) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return fmt.Errorf("open agent socket %s: %w", path, err)
+	}
+	defer conn.Close()
+
+	msg := binary.BigEndian.AppendUint32(nil, uint32(len(req)))
+	if _, err := conn.Write(append(msg, req...)); err != nil {
+		return fmt.Errorf("write to agent: %v", err)
+	}
+
+	var length [4]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return fmt.Errorf("read from agent: %v", err)
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n == 0 || n > maxAgentReply {
+		return fmt.Errorf("invalid agent reply length %d", n)
+	}
+	reply := make([]byte, n)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("read from agent: %v", err)
+	}
+
+	switch reply[0] {
+	case agentSuccess:
+		return nil
+	case agentFailure:
+		return errAgentFailure
+	default:
+		return fmt.Errorf("unexpected agent reply %d", reply[0])
+	}
+}
+
+// socketClient is a client of the agent at the socket path. It sends the
+// constraint extensions of added keys, which agent.Client ignores.
+type socketClient struct {
+	agent.ExtendedAgent
+	path string
+	conn net.Conn
+}
+
+// Close closes the connection to the agent.
+func (c *socketClient) Close() error {
+	return c.conn.Close()
+}
+
+// Add implements agent.Agent interface
+func (c *socketClient) Add(key agent.AddedKey) error {
+	if len(key.ConstraintExtensions) == 0 {
+		return c.ExtendedAgent.Add(key)
+	}
+
+	req, err := encodeAddedKey(key)
+	if err != nil {
+		return err
+	}
+	if err := call(c.path, req); err != nil {
+		if errors.Is(err, errAgentFailure) {
+			return fmt.Errorf("agent refused the key constraints: %w", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// encodeAddedKey returns the add request of the key with the constraint
+// extensions. The key is encoded by agent.Client, the request of which is
+// captured, and the extensions are appended to its constraints.
+func encodeAddedKey(key agent.AddedKey) ([]byte, error) {
+	extensions := key.ConstraintExtensions
+	key.ConstraintExtensions = nil
+
+	rec := &recorder{reply: bytes.NewReader([]byte{0, 0, 0, 1, agentSuccess})}
+	if err := agent.NewClient(rec).Add(key); err != nil {
+		return nil, err
+	}
+	if rec.request.Len() < 5 {
+		return nil, fmt.Errorf("encode added key: short request")
+	}
+	req := rec.request.Bytes()[4:]
+	if req[0] == agentAddIdentity {
+		req[0] = agentAddIDConstrained
+	}
+
+	for _, e := range extensions {
+		req = append(req, agentConstrainExtension)
+		req = append(req, ssh.Marshal(struct {
+			Name    string
+			Details []byte `ssh:"rest"`
+		}{e.ExtensionName, e.ExtensionDetails})...)
+	}
+
+	return req, nil
+}
+
+// recorder captures the request of agent.Client and replies with success.
+type recorder struct {
+	request bytes.Buffer
+	reply   *bytes.Reader
+}
+
+// Read implements io.Reader interface
+func (r *recorder) Read(p []byte) (int, error) {
+	return r.reply.Read(p)
+}
+
+// Write implements io.Writer interface
+func (r *recorder) Write(p []byte) (int, error) {
+	return r.request.Write(p)
+}
@@ -0,0 +1,274 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agents
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ErrSignDenied is returned by Proxy when signing was not confirmed.
+var ErrSignDenied = errors.New("signing denied")
+
+// SignRequest is a request to sign data with an agent key.
+type SignRequest struct {
+	Key   ssh.PublicKey
+	Flags agent.SignatureFlags
+	// Purpose is what the data is signed for, see SignPurpose.
+	Purpose string
+}
+
+// Proxy is an SSH agent which forwards the requests to the upstream agent
+// and logs them. It helps to find out which programs use the agent keys and
+// how.
+type Proxy struct {
+	// Upstream provides the agent the requests are forwarded to.
+	Upstream Provider
+	// Log receives a record of every request.
+	Log *slog.Logger
+	// Confirm asks whether to sign the data, if set. The calls are
+	// serialized.
+	Confirm func(req SignRequest) bool
+
+	mu sync.Mutex
+}
+
+// Serve accepts the connections of agent clients on the listener and
+// serves each of them with a new connection to the upstream agent, until
+// the listener is closed.
+func (p *Proxy) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go p.serveConn(conn)
+	}
+}
+
+// serveConn forwards the requests of the client connection.
+func (p *Proxy) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	upstream, err := p.Upstream.Connect()
+	if err != nil {
+		p.Log.Error("connect to upstream agent", "error", err)
+		return
+	}
+	if c, ok := upstream.(interface{ Close() error }); ok {
+		defer c.Close()
+	}
+
+	p.Log.Debug("client connected")
+	_ = agent.ServeAgent(&proxyAgent{proxy: p, upstream: upstream}, conn)
+	p.Log.Debug("client disconnected")
+}
+
+// confirm asks whether to sign, one request at a time.
+func (p *Proxy) confirm(req SignRequest) bool {
+	if p.Confirm == nil {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.Confirm(req)
+}
+
+// proxyAgent forwards the requests of a client to the upstream agent.
+type proxyAgent struct {
+	proxy    *Proxy
+	upstream agent.ExtendedAgent
+}
+
+// Ensure that proxyAgent fulfils the agent.ExtendedAgent interface at
+// compile time.
+var _ agent.ExtendedAgent = (*proxyAgent)(nil)
+
+// log records the request with its result.
+func (a *proxyAgent) log(op string, err error, attrs ...any) {
+	if err != nil {
+		a.proxy.Log.Warn(op, append(attrs, "error", err)...)
+		return
+	}
+	a.proxy.Log.Info(op, attrs...)
+}
+
+// List implements agent.Agent interface
+func (a *proxyAgent) List() ([]*agent.Key, error) {
+	keys, err := a.upstream.List()
+	a.log("list", err, "keys", len(keys))
+
+	return keys, err
+}
+
+// Sign implements agent.Agent interface
+func (a *proxyAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(key, data, 0)
+}
+
+// SignWithFlags implements agent.ExtendedAgent interface
+func (a *proxyAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	req := SignRequest{Key: key, Flags: flags, Purpose: SignPurpose(data)}
+	attrs := []any{
+		"fingerprint", ssh.FingerprintSHA256(key),
+		"type", key.Type(),
+		"flags", FormatSignatureFlags(flags),
+		"purpose", req.Purpose,
+		"bytes", len(data),
+	}
+	if !a.proxy.confirm(req) {
+		a.log("sign", ErrSignDenied, attrs...)
+		return nil, ErrSignDenied
+	}
+
+	sig, err := a.upstream.SignWithFlags(key, data, flags)
+	if sig != nil {
+		attrs = append(attrs, "format", sig.Format)
+	}
+	a.log("sign", err, attrs...)
+
+	return sig, err
+}
+
+// Add implements agent.Agent interface
+func (a *proxyAgent) Add(key agent.AddedKey) error {
+	attrs := []any{"comment", key.Comment}
+	if signer, err := ssh.NewSignerFromKey(key.PrivateKey); err == nil {
+		attrs = append(attrs, "fingerprint", ssh.FingerprintSHA256(signer.PublicKey()), "type", signer.PublicKey().Type())
+	}
+	if key.Certificate != nil {
+		attrs = append(attrs, "certificate", key.Certificate.KeyId)
+	}
+	if key.LifetimeSecs > 0 {
+		attrs = append(attrs, "lifetime", key.LifetimeSecs)
+	}
+	if key.ConfirmBeforeUse {
+		attrs = append(attrs, "confirm", true)
+	}
+	for _, e := range key.ConstraintExtensions {
+		attrs = append(attrs, "constraint", e.ExtensionName)
+	}
+
+	err := a.upstream.Add(key)
+	a.log("add", err, attrs...)
+
+	return err
+}
+
+// Remove implements agent.Agent interface
+func (a *proxyAgent) Remove(key ssh.PublicKey) error {
+	err := a.upstream.Remove(key)
+	a.log("remove", err, "fingerprint", ssh.FingerprintSHA256(key), "type", key.Type())
+
+	return err
+}
+
+// RemoveAll implements agent.Agent interface
+func (a *proxyAgent) RemoveAll() error {
+	err := a.upstream.RemoveAll()
+	a.log("remove-all", err)
+
+	return err
+}
+
+// Lock implements agent.Agent interface
+func (a *proxyAgent) Lock(passphrase []byte) error {
+	err := a.upstream.Lock(passphrase)
+	a.log("lock", err)
+
+	return err
+}
+
+// Unlock implements agent.Agent interface
+func (a *proxyAgent) Unlock(passphrase []byte) error {
+	err := a.upstream.Unlock(passphrase)
+	a.log("unlock", err)
+
+	return err
+}
+
+// Signers implements agent.Agent interface
+func (a *proxyAgent) Signers() ([]ssh.Signer, error) {
+	return a.upstream.Signers()
+}
+
+// Extension implements agent.ExtendedAgent interface
+func (a *proxyAgent) Extension(extensionType string, contents []byte) ([]byte, error) {
+	reply, err := a.upstream.Extension(extensionType, contents)
+	if errors.Is(err, agent.ErrExtensionUnsupported) {
+		a.log("extension", nil, "extension", extensionType, "supported", false)
+		return reply, err
+	}
+	a.log("extension", err, "extension", extensionType)
+
+	return reply, err
+}
+
+// FormatSignatureFlags returns the names of the signature flags, like
+// rsa-sha2-256.
+func FormatSignatureFlags(flags agent.SignatureFlags) string {
+	var names []string
+	if flags&agent.SignatureFlagRsaSha256 != 0 {
+		names = append(names, ssh.KeyAlgoRSASHA256)
+	}
+	if flags&agent.SignatureFlagRsaSha512 != 0 {
+		names = append(names, ssh.KeyAlgoRSASHA512)
+	}
+
+	return strings.Join(names, ",")
+}
+
+// SignPurpose describes what the data is signed for: "ssh-userauth as USER"
+// for SSH public key authentication, "sshsig NAMESPACE" for SSH signatures
+// like git commits, and "unknown" otherwise.
+func SignPurpose(data []byte) string {
+	if ns, ok := bytes.CutPrefix(data, []byte("SSHSIG")); ok {
+		var msg struct {
+			Namespace string
+			Rest      []byte `ssh:"rest"`
+		}
+		if ssh.Unmarshal(ns, &msg) == nil {
+			return "sshsig " + msg.Namespace
+		}
+	}
+
+	// See RFC 4252, section 7.
+	var userauth struct {
+		SessionID []byte
+		Type      byte
+		User      string
+		Service   string
+		Method    string
+		Rest      []byte `ssh:"rest"`
+	}
+	if ssh.Unmarshal(data, &userauth) == nil && userauth.Type == 50 && userauth.Method == "publickey" {
+		return "ssh-userauth as " + userauth.User
+	}
+
+	return "unknown"
+}
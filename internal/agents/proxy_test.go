@@ -0,0 +1,155 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agents
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// syncBuffer is a buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write implements io.Writer interface
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records returns the decoded JSON log records.
+func (b *syncBuffer) records(t *testing.T) []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]any
+	dec := json.NewDecoder(bytes.NewReader(b.buf.Bytes()))
+	for dec.More() {
+		var r map[string]any
+		require.NoError(t, dec.Decode(&r))
+		records = append(records, r)
+	}
+	return records
+}
+
+// startProxy serves the proxy of upstream on a temporary socket and returns
+// a client connected to it.
+func startProxy(t *testing.T, p *Proxy) agent.ExtendedAgent {
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "proxy.sock"))
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go p.Serve(l)
+
+	conn, err := net.Dial("unix", l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return agent.NewClient(conn)
+}
+
+func TestProxy(t *testing.T) {
+	var logs syncBuffer
+	var asked []SignRequest
+	p := &Proxy{
+		Upstream: NewKeyringProvider(),
+		Log:      slog.New(slog.NewJSONHandler(&logs, nil)),
+		Confirm: func(req SignRequest) bool {
+			asked = append(asked, req)
+			return len(asked) == 1
+		},
+	}
+	client := startProxy(t, p)
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	pub := signer.PublicKey()
+	fp := ssh.FingerprintSHA256(pub)
+
+	require.NoError(t, client.Add(agent.AddedKey{PrivateKey: priv, Comment: "me", LifetimeSecs: 60}))
+	keys, err := client.List()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+
+	sig, err := client.SignWithFlags(pub, []byte("data"), 0)
+	require.NoError(t, err)
+	require.NoError(t, pub.Verify([]byte("data"), sig))
+	_, err = client.Sign(pub, []byte("data"))
+	assert.Error(t, err, "second signing is denied")
+	require.Len(t, asked, 2)
+	assert.Equal(t, fp, ssh.FingerprintSHA256(asked[0].Key))
+
+	require.NoError(t, client.Remove(pub))
+
+	records := logs.records(t)
+	require.Len(t, records, 5)
+	assert.Equal(t, "add", records[0]["msg"])
+	assert.Equal(t, fp, records[0]["fingerprint"])
+	assert.Equal(t, "me", records[0]["comment"])
+	assert.EqualValues(t, 60, records[0]["lifetime"])
+	assert.Equal(t, "list", records[1]["msg"])
+	assert.EqualValues(t, 1, records[1]["keys"])
+	assert.Equal(t, "sign", records[2]["msg"])
+	assert.Equal(t, "INFO", records[2]["level"])
+	assert.Equal(t, fp, records[2]["fingerprint"])
+	assert.Equal(t, "unknown", records[2]["purpose"])
+	assert.Equal(t, "sign", records[3]["msg"])
+	assert.Equal(t, "WARN", records[3]["level"])
+	assert.Equal(t, ErrSignDenied.Error(), records[3]["error"])
+	assert.Equal(t, "remove", records[4]["msg"])
+}
+
+func TestSignPurpose(t *testing.T) {
+	userauth := ssh.Marshal(struct {
+		SessionID []byte
+		Type      byte
+		User      string
+		Service   string
+		Method    string
+		HasSig    bool
+		Algo      string
+		PubKey    []byte
+	}{[]byte("session"), 50, "git", "ssh-connection", "publickey", true, ssh.KeyAlgoED25519, []byte("key")})
+	assert.Equal(t, "ssh-userauth as git", SignPurpose(userauth))
+
+	sshsig := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace string
+		Reserved  string
+		Hash      string
+		Message   []byte
+	}{"git", "", "sha512", []byte("hash")})...)
+	assert.Equal(t, "sshsig git", SignPurpose(sshsig))
+
+	assert.Equal(t, "unknown", SignPurpose([]byte("data")))
+	assert.Empty(t, FormatSignatureFlags(0))
+	assert.Equal(t, "rsa-sha2-256,rsa-sha2-512", FormatSignatureFlags(agent.SignatureFlagRsaSha256|agent.SignatureFlagRsaSha512))
+}
@@ -0,0 +1,162 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agents
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// RestrictDestinationExtension is the key constraint of OpenSSH 8.9+ which
+// limits the hosts a key added to agent may be used for, see PROTOCOL.agent.
+const RestrictDestinationExtension = "restrict-destination-v00@openssh.com"
+
+// HostKey is a key identifying a host.
+type HostKey struct {
+	Key ssh.PublicKey
+	// CA is set when Key is the authority of the host certificates.
+	CA bool
+}
+
+// Hop is a host on the path the agent key is used along.
+type Hop struct {
+	// User is the user on the host, empty for any.
+	User string
+	// Host is the host name, empty for the host the agent runs on.
+	Host string
+	// Keys are the keys of the host, none for the agent host.
+	Keys []HostKey
+}
+
+// String implements fmt.Stringer interface
+func (h Hop) String() string {
+	if h.User != "" {
+		return h.User + "@" + h.Host
+	}
+
+	return h.Host
+}
+
+// Destination allows to use the agent key on the From host to authenticate
+// to the To host.
+type Destination struct {
+	From Hop
+	To   Hop
+}
+
+// String implements fmt.Stringer interface
+func (d Destination) String() string {
+	if d.From.Host == "" {
+		return d.To.String()
+	}
+
+	return d.From.String() + ">" + d.To.String()
+}
+
+// ParseDestination parses the destination like ssh-add -h: [user@]host to
+// use the key from the agent host or from>[user@]host to use it on the
+// from host, where the agent is forwarded to. The host keys are looked up
+// with the hostKeys func and both hosts must have some.
+func ParseDestination(spec string, hostKeys func(host string) ([]HostKey, error)) (Destination, error) {
+	var d Destination
+	from, to, ok := strings.Cut(spec, ">")
+	if !ok {
+		from, to = "", spec
+	}
+
+	if from != "" {
+		hop, err := parseHop(from, hostKeys)
+		if err != nil {
+			return Destination{}, err
+		}
+		if hop.User != "" {
+			return Destination{}, fmt.Errorf("%s: user can not be set on the from host", spec)
+		}
+		d.From = hop
+	}
+	hop, err := parseHop(to, hostKeys)
+	if err != nil {
+		return Destination{}, err
+	}
+	d.To = hop
+
+	return d, nil
+}
+
+// parseHop parses the [user@]host of the destination.
+func parseHop(s string, hostKeys func(host string) ([]HostKey, error)) (Hop, error) {
+	var h Hop
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		h.User, h.Host = s[:i], s[i+1:]
+	} else {
+		h.Host = s
+	}
+	if h.Host == "" || strings.ContainsAny(h.Host, " >") {
+		return Hop{}, fmt.Errorf("invalid destination host %q", s)
+	}
+
+	keys, err := hostKeys(h.Host)
+	if err != nil {
+		return Hop{}, err
+	}
+	if len(keys) == 0 {
+		return Hop{}, fmt.Errorf("no host keys found for %s", h.Host)
+	}
+	h.Keys = keys
+
+	return h, nil
+}
+
+// marshal encodes the hop for the constraint.
+func (h Hop) marshal() []byte {
+	data := ssh.Marshal(struct {
+		User     string
+		Host     string
+		Reserved string
+	}{h.User, h.Host, ""})
+	for _, k := range h.Keys {
+		data = append(data, ssh.Marshal(struct {
+			Key []byte
+			CA  bool
+		}{k.Key.Marshal(), k.CA})...)
+	}
+
+	return data
+}
+
+// RestrictDestination returns the constraint which limits the use of the
+// agent key to the destinations.
+func RestrictDestination(destinations []Destination) agent.ConstraintExtension {
+	var constraints []byte
+	for _, d := range destinations {
+		constraints = append(constraints, ssh.Marshal(struct {
+			Constraint []byte
+		}{ssh.Marshal(struct {
+			From     []byte
+			To       []byte
+			Reserved string
+		}{d.From.marshal(), d.To.marshal(), ""})})...)
+	}
+
+	return agent.ConstraintExtension{
+		ExtensionName:    RestrictDestinationExtension,
+		ExtensionDetails: ssh.Marshal(struct{ Constraints []byte }{constraints}),
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agents
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestParseDestination(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostKey, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	lookup := func(host string) ([]HostKey, error) {
+		if host == "unknown" {
+			return nil, nil
+		}
+		return []HostKey{{Key: hostKey}}, nil
+	}
+
+	d, err := ParseDestination("git@github.com", lookup)
+	require.NoError(t, err)
+	assert.Equal(t, Hop{}, d.From)
+	assert.Equal(t, "git", d.To.User)
+	assert.Equal(t, "github.com", d.To.Host)
+	assert.Len(t, d.To.Keys, 1)
+	assert.Equal(t, "git@github.com", d.String())
+
+	d, err = ParseDestination("jump>deploy@web", lookup)
+	require.NoError(t, err)
+	assert.Equal(t, "jump", d.From.Host)
+	assert.Len(t, d.From.Keys, 1)
+	assert.Equal(t, "jump>deploy@web", d.String())
+
+	for _, spec := range []string{"", "me@jump>web", "unknown", "jump>unknown", "jump>", "user@"} {
+		_, err := ParseDestination(spec, lookup)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestRestrictDestination(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostKey, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	d := Destination{
+		From: Hop{Host: "jump", Keys: []HostKey{{Key: hostKey, CA: true}}},
+		To:   Hop{User: "git", Host: "web", Keys: []HostKey{{Key: hostKey}}},
+	}
+
+	ext := RestrictDestination([]Destination{d})
+	assert.Equal(t, RestrictDestinationExtension, ext.ExtensionName)
+
+	var constraints struct{ Data []byte }
+	require.NoError(t, ssh.Unmarshal(ext.ExtensionDetails, &constraints))
+	var constraint struct{ Data []byte }
+	require.NoError(t, ssh.Unmarshal(constraints.Data, &constraint))
+	var hops struct {
+		From     []byte
+		To       []byte
+		Reserved string
+	}
+	require.NoError(t, ssh.Unmarshal(constraint.Data, &hops))
+	var to struct {
+		User     string
+		Host     string
+		Reserved string
+		Key      []byte
+		CA       bool
+	}
+	require.NoError(t, ssh.Unmarshal(hops.To, &to))
+	assert.Equal(t, "git", to.User)
+	assert.Equal(t, "web", to.Host)
+	assert.Equal(t, hostKey.Marshal(), to.Key)
+	assert.False(t, to.CA)
+	assert.True(t, bytes.HasSuffix(hops.From, []byte{1}), "from host key is CA")
+
+	// The extension is appended to the constraints of the add request.
+	req, err := encodeAddedKey(agent.AddedKey{PrivateKey: priv, Comment: "me", ConstraintExtensions: []agent.ConstraintExtension{ext}})
+	require.NoError(t, err)
+	assert.Equal(t, byte(agentAddIDConstrained), req[0])
+	suffix := append([]byte{agentConstrainExtension}, ssh.Marshal(struct{ Name string }{RestrictDestinationExtension})...)
+	suffix = append(suffix, ext.ExtensionDetails...)
+	assert.True(t, bytes.HasSuffix(req, suffix))
+}
@@ -0,0 +1,64 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agents
+
+import (
+	"io"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Signer signs data with a key loaded to SSH agent, so the private key
+// does not have to be decrypted again.
+type Signer struct {
+	client agent.ExtendedAgent
+	key    ssh.PublicKey
+}
+
+// NewSigner creates a signer of the key loaded to the agent.
+func NewSigner(client agent.ExtendedAgent, key ssh.PublicKey) *Signer {
+	return &Signer{client: client, key: key}
+}
+
+// Ensure that Signer fulfils the ssh.AlgorithmSigner interface at compile
+// time.
+var _ ssh.AlgorithmSigner = (*Signer)(nil)
+
+// PublicKey implements ssh.Signer interface
+func (s *Signer) PublicKey() ssh.PublicKey {
+	return s.key
+}
+
+// Sign implements ssh.Signer interface
+func (s *Signer) Sign(_ io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.client.Sign(s.key, data)
+}
+
+// SignWithAlgorithm implements ssh.AlgorithmSigner interface. Only RSA keys
+// support choosing of the algorithm, others sign with the default one.
+func (s *Signer) SignWithAlgorithm(_ io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	var flags agent.SignatureFlags
+	switch algorithm {
+	case ssh.KeyAlgoRSASHA256:
+		flags = agent.SignatureFlagRsaSha256
+	case ssh.KeyAlgoRSASHA512:
+		flags = agent.SignatureFlagRsaSha512
+	}
+
+	return s.client.SignWithFlags(s.key, data, flags)
+}
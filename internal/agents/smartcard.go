@@ -0,0 +1,82 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agents
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrSmartcardRefused is returned when the agent fails to add or remove the
+// keys of a PKCS#11 provider, e.g. because of a wrong PIN or a provider
+// which is not allowed by ssh-agent -P.
+var ErrSmartcardRefused = errors.New("agent refused the smartcard request")
+
+// SmartcardProvider provides SSH agent which loads keys of PKCS#11
+// providers, like smartcards and hardware tokens.
+type SmartcardProvider interface {
+	Provider
+	// AddSmartcardKey adds the keys of the PKCS#11 provider library to
+	// the agent, like ssh-add -s.
+	AddSmartcardKey(provider, pin string) error
+	// RemoveSmartcardKey removes the keys of the PKCS#11 provider library
+	// from the agent, like ssh-add -e.
+	RemoveSmartcardKey(provider string) error
+}
+
+// Ensure that SocketProvider fulfils the SmartcardProvider interface at
+// compile time.
+var _ SmartcardProvider = (*SocketProvider)(nil)
+
+// AddSmartcardKey implements SmartcardProvider interface
+func (p *SocketProvider) AddSmartcardKey(provider, pin string) error {
+	return p.smartcardRequest(agentAddSmartcardKey, provider, pin)
+}
+
+// RemoveSmartcardKey implements SmartcardProvider interface
+func (p *SocketProvider) RemoveSmartcardKey(provider string) error {
+	return p.smartcardRequest(agentRemoveSmartcardKey, provider, "")
+}
+
+// smartcardRequest sends the smartcard message over a new connection, so
+// it does not interleave with requests of agent clients.
+func (p *SocketProvider) smartcardRequest(op byte, provider, pin string) error {
+	// The agent identifies providers by the canonical path, like ssh-add.
+	path, err := filepath.Abs(provider)
+	if err != nil {
+		return fmt.Errorf("resolve provider path: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	req := append([]byte{op}, ssh.Marshal(struct {
+		ReaderID string
+		PIN      string
+	}{path, pin})...)
+	if err := call(p.Path, req); err != nil {
+		if errors.Is(err, errAgentFailure) {
+			return fmt.Errorf("%s: %w", path, ErrSmartcardRefused)
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agents
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// smartcardRequest is a smartcard message received by the fake agent.
+type smartcardRequest struct {
+	Op       byte
+	ReaderID string
+	PIN      string
+}
+
+// serveSmartcard starts a fake agent which answers the smartcard messages
+// with the reply and sends the received requests to the channel.
+func serveSmartcard(t *testing.T, reply byte) (*SocketProvider, <-chan smartcardRequest) {
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	requests := make(chan smartcardRequest, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var length [4]byte
+			if _, err := io.ReadFull(conn, length[:]); err != nil {
+				conn.Close()
+				continue
+			}
+			body := make([]byte, binary.BigEndian.Uint32(length[:]))
+			if _, err := io.ReadFull(conn, body); err != nil {
+				conn.Close()
+				continue
+			}
+			var req smartcardRequest
+			if err := ssh.Unmarshal(body, &req); err == nil {
+				requests <- req
+			}
+			conn.Write([]byte{0, 0, 0, 1, reply})
+			conn.Close()
+		}
+	}()
+
+	return NewSocketProvider(path), requests
+}
+
+func TestAddSmartcardKey(t *testing.T) {
+	p, requests := serveSmartcard(t, agentSuccess)
+	provider := filepath.Join(t.TempDir(), "opensc-pkcs11.so")
+
+	require.NoError(t, p.AddSmartcardKey(provider, "1234"))
+	req := <-requests
+	assert.Equal(t, byte(agentAddSmartcardKey), req.Op)
+	assert.Equal(t, provider, req.ReaderID)
+	assert.Equal(t, "1234", req.PIN)
+
+	require.NoError(t, p.RemoveSmartcardKey(provider))
+	req = <-requests
+	assert.Equal(t, byte(agentRemoveSmartcardKey), req.Op)
+	assert.Equal(t, provider, req.ReaderID)
+	assert.Empty(t, req.PIN)
+}
+
+func TestAddSmartcardKeyRefused(t *testing.T) {
+	p, requests := serveSmartcard(t, agentFailure)
+
+	err := p.AddSmartcardKey("/usr/lib/opensc-pkcs11.so", "0000")
+	assert.ErrorIs(t, err, ErrSmartcardRefused)
+	assert.Equal(t, "/usr/lib/opensc-pkcs11.so", (<-requests).ReaderID)
+}
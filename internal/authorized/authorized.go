@@ -0,0 +1,224 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package authorized manages authorized_keys(5) files.
+package authorized
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/linefile"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrDuplicate is returned when the key is already authorized.
+var ErrDuplicate = errors.New("key is already authorized")
+
+// Entry is a key line of authorized_keys file.
+type Entry struct {
+	// Line is the line number in the file, starting from 1.
+	Line int
+	// Options are the key options like from="..." or restrict.
+	Options []string
+	// Key is the authorized public key.
+	Key ssh.PublicKey
+	// Comment is the comment after the key.
+	Comment string
+}
+
+// Fingerprint returns SHA256 fingerprint of the key.
+func (e *Entry) Fingerprint() string {
+	return ssh.FingerprintSHA256(e.Key)
+}
+
+// Option returns the value of the named option. Flag options like restrict
+// have an empty value.
+func (e *Entry) Option(name string) (string, bool) {
+	for _, opt := range e.Options {
+		n, v, hasValue := strings.Cut(opt, "=")
+		if !strings.EqualFold(n, name) {
+			continue
+		}
+		if hasValue {
+			v = strings.TrimSuffix(strings.TrimPrefix(v, `"`), `"`)
+		}
+		return v, true
+	}
+
+	return "", false
+}
+
+// ExpiryTime returns the time of expiry-time option in local time zone.
+func (e *Entry) ExpiryTime() (time.Time, bool) {
+	v, ok := e.Option("expiry-time")
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{"20060102150405", "200601021504", "20060102"} {
+		if len(v) != len(layout) {
+			continue
+		}
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// Expired reports whether the expiry-time of the entry is before now.
+func (e *Entry) Expired(now time.Time) bool {
+	t, ok := e.ExpiryTime()
+	return ok && !now.Before(t)
+}
+
+// String returns the line of the entry in authorized_keys format.
+func (e *Entry) String() string {
+	var b strings.Builder
+	if len(e.Options) > 0 {
+		b.WriteString(strings.Join(e.Options, ","))
+		b.WriteByte(' ')
+	}
+	b.Write(bytes.TrimSpace(ssh.MarshalAuthorizedKey(e.Key)))
+	if e.Comment != "" {
+		b.WriteByte(' ')
+		b.WriteString(e.Comment)
+	}
+
+	return b.String()
+}
+
+// File is an authorized_keys file.
+type File struct {
+	path  string
+	lines *linefile.Lines[*Entry]
+}
+
+// Load reads authorized_keys file. A missing file is treated as empty.
+func Load(path string) (*File, error) {
+	lines, err := linefile.Read(path, parseLine, func(e *Entry, n int) { e.Line = n })
+	if err != nil {
+		return nil, fmt.Errorf("read authorized keys: %v", err)
+	}
+
+	return &File{path: path, lines: lines}, nil
+}
+
+// parseLine parses the key line, comments and broken lines have no entry.
+func parseLine(raw string) (*Entry, error) {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return nil, nil
+	}
+	key, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(trimmed))
+	if err != nil {
+		return nil, nil
+	}
+
+	return &Entry{Options: options, Key: key, Comment: comment}, nil
+}
+
+// Path returns the file path.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Entries returns the key entries of the file.
+func (f *File) Entries() []*Entry {
+	return f.lines.Entries()
+}
+
+// Find returns the entries with the key.
+func (f *File) Find(pub ssh.PublicKey) []*Entry {
+	blob := pub.Marshal()
+	var found []*Entry
+	for _, e := range f.Entries() {
+		if bytes.Equal(e.Key.Marshal(), blob) {
+			found = append(found, e)
+		}
+	}
+
+	return found
+}
+
+// Duplicates returns the groups of entries authorizing the same key.
+func (f *File) Duplicates() [][]*Entry {
+	var (
+		groups [][]*Entry
+		seen   = map[string]int{}
+	)
+	for _, e := range f.Entries() {
+		blob := string(e.Key.Marshal())
+		if i, ok := seen[blob]; ok {
+			groups[i] = append(groups[i], e)
+			continue
+		}
+		seen[blob] = len(groups)
+		groups = append(groups, []*Entry{e})
+	}
+
+	var dups [][]*Entry
+	for _, g := range groups {
+		if len(g) > 1 {
+			dups = append(dups, g)
+		}
+	}
+
+	return dups
+}
+
+// Add appends the key with the comment and options. It returns ErrDuplicate
+// if the key is already in the file.
+func (f *File) Add(pub ssh.PublicKey, comment string, options []string) (*Entry, error) {
+	if len(f.Find(pub)) > 0 {
+		return nil, fmt.Errorf("%s: %w", ssh.FingerprintSHA256(pub), ErrDuplicate)
+	}
+	e := &Entry{
+		Options: options,
+		Key:     pub,
+		Comment: comment,
+	}
+	// Validate the options by parsing the resulting line.
+	if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(e.String())); err != nil {
+		return nil, fmt.Errorf("invalid options %q: %v", strings.Join(options, ","), err)
+	}
+	f.lines.Append(e.String(), e)
+
+	return e, nil
+}
+
+// Remove deletes all entries with the fingerprint and returns the number of
+// removed entries.
+func (f *File) Remove(fingerprint string) int {
+	return f.lines.Remove(func(e *Entry) bool {
+		return e.Fingerprint() == fingerprint
+	})
+}
+
+// Save atomically replaces the file keeping its permissions. New files get
+// 0600 permissions and the directory 0700, as sshd(8) requires in
+// StrictModes.
+func (f *File) Save() error {
+	if err := f.lines.Save(f.path); err != nil {
+		return fmt.Errorf("write authorized keys: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorized
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestPublicKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+
+	return sshPub
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".ssh", "authorized_keys")
+	first, second := newTestPublicKey(t), newTestPublicKey(t)
+
+	f, err := Load(path)
+	require.NoError(t, err)
+	assert.Empty(t, f.Entries())
+
+	_, err = f.Add(first, "me@work", []string{`from="10.0.0.0/8"`, "restrict", `expiry-time="20200101"`})
+	require.NoError(t, err)
+	_, err = f.Add(first, "", nil)
+	assert.ErrorIs(t, err, ErrDuplicate)
+	_, err = f.Add(second, "me@home", nil)
+	require.NoError(t, err)
+	require.NoError(t, f.Save())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Append a comment, a duplicate and a broken line by hand.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data = append(data, "# old laptop\n"...)
+	data = append(data, ssh.MarshalAuthorizedKey(second)...)
+	data = append(data, "ssh-ed25519 broken\n"...)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	f, err = Load(path)
+	require.NoError(t, err)
+	entries := f.Entries()
+	require.Len(t, entries, 3)
+	from, ok := entries[0].Option("from")
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.0/8", from)
+	_, ok = entries[0].Option("restrict")
+	assert.True(t, ok)
+	assert.True(t, entries[0].Expired(time.Now()))
+	assert.False(t, entries[1].Expired(time.Now()))
+
+	dups := f.Duplicates()
+	require.Len(t, dups, 1)
+	assert.Equal(t, []int{2, 4}, []int{dups[0][0].Line, dups[0][1].Line})
+
+	assert.Equal(t, 2, f.Remove(ssh.FingerprintSHA256(second)))
+	require.NoError(t, f.Save())
+
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# old laptop\nssh-ed25519 broken\n")
+	assert.NotContains(t, string(data), "me@home")
+}
@@ -0,0 +1,175 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ca implements a local SSH certificate authority.
+package ca
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyName is the name of the CA key in the CA key store.
+const KeyName = "ca"
+
+// ErrNotInitialized is returned when the CA key doesn't exist.
+var ErrNotInitialized = errors.New("certificate authority is not initialized")
+
+// DefaultUserExtensions returns the extensions ssh-keygen(1) adds to user
+// certificates by default.
+func DefaultUserExtensions() map[string]string {
+	return map[string]string{
+		"permit-X11-forwarding":   "",
+		"permit-agent-forwarding": "",
+		"permit-port-forwarding":  "",
+		"permit-pty":              "",
+		"permit-user-rc":          "",
+	}
+}
+
+// Options holds the parameters of the issued certificate.
+type Options struct {
+	// CertType is ssh.UserCert or ssh.HostCert.
+	CertType uint32
+	// KeyID identifies the certificate in logs.
+	KeyID string
+	// Principals are user or host names the certificate is valid for.
+	Principals []string
+	// ValidAfter is the start of the validity window, zero means now.
+	ValidAfter time.Time
+	// Validity is the length of the validity window, zero means forever.
+	Validity time.Duration
+	// Serial is the certificate serial number, zero means random.
+	Serial uint64
+	// CriticalOptions are options like force-command or source-address.
+	CriticalOptions map[string]string
+	// Extensions are optional features like permit-pty.
+	Extensions map[string]string
+}
+
+// CA is a certificate authority backed by a key in the key store.
+type CA struct {
+	Key    *models.Key
+	signer ssh.Signer
+}
+
+// Init generates a new CA key of the key type and saves it to the store.
+func Init(store keys.KeyStore, keyType, comment string) (*CA, error) {
+	if _, err := store.Get(KeyName); err == nil {
+		return nil, fmt.Errorf("%s: %w", KeyName, keys.ErrKeyExists)
+	}
+	privKey, err := keys.GenerateKey(keyType, 0)
+	if err != nil {
+		return nil, err
+	}
+	key := &models.Key{Name: KeyName, Comment: comment, Private: privKey}
+	if err := store.Create(key); err != nil {
+		return nil, err
+	}
+
+	return New(key)
+}
+
+// Load reads the CA key from the store.
+func Load(store keys.KeyStore) (*CA, error) {
+	key, err := store.Get(KeyName)
+	if errors.Is(err, keys.ErrKeyNotFound) {
+		return nil, ErrNotInitialized
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return New(key)
+}
+
+// New creates a CA signing with the key.
+func New(key *models.Key) (*CA, error) {
+	signer, err := ssh.NewSignerFromKey(key.Private)
+	if err != nil {
+		return nil, fmt.Errorf("create CA signer: %v", err)
+	}
+
+	return &CA{Key: key, signer: signer}, nil
+}
+
+// Sign issues a certificate for the public key.
+func (c *CA) Sign(pub ssh.PublicKey, opts Options) (*ssh.Certificate, error) {
+	if opts.CertType != ssh.UserCert && opts.CertType != ssh.HostCert {
+		return nil, fmt.Errorf("invalid certificate type %d", opts.CertType)
+	}
+	if opts.Validity < 0 {
+		return nil, fmt.Errorf("invalid validity %s, it must be positive", opts.Validity)
+	}
+	serial := opts.Serial
+	if serial == 0 {
+		var b [8]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, fmt.Errorf("generate serial: %v", err)
+		}
+		serial = binary.BigEndian.Uint64(b[:])
+	}
+	validAfter := opts.ValidAfter
+	if validAfter.IsZero() {
+		validAfter = time.Now()
+	}
+	validBefore := uint64(ssh.CertTimeInfinity)
+	if opts.Validity > 0 {
+		validBefore = uint64(validAfter.Add(opts.Validity).Unix())
+	}
+
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          serial,
+		CertType:        opts.CertType,
+		KeyId:           opts.KeyID,
+		ValidPrincipals: opts.Principals,
+		ValidAfter:      uint64(validAfter.Unix()),
+		ValidBefore:     validBefore,
+		Permissions: ssh.Permissions{
+			CriticalOptions: opts.CriticalOptions,
+			Extensions:      opts.Extensions,
+		},
+	}
+	if err := cert.SignCert(rand.Reader, c.signer); err != nil {
+		return nil, fmt.Errorf("sign certificate: %v", err)
+	}
+
+	return cert, nil
+}
+
+// SignKey issues a certificate for the key and writes it next to the key
+// file with the -cert.pub suffix.
+func (c *CA) SignKey(key *models.Key, opts Options) (*ssh.Certificate, error) {
+	cert, err := c.Sign(key.Public, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(key.Path+keys.CertSuffix, keys.MarshalPublicKey(cert, key.Comment), 0644); err != nil {
+		return nil, fmt.Errorf("write certificate file: %v", err)
+	}
+	key.Certificate = cert
+
+	return cert, nil
+}
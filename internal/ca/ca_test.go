@@ -0,0 +1,95 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ca
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSignKey(t *testing.T) {
+	caStore := keys.NewFSStore(t.TempDir())
+	authority, err := Init(caStore, ssh.KeyAlgoED25519, "test CA")
+	require.NoError(t, err)
+	_, err = Init(caStore, ssh.KeyAlgoED25519, "test CA")
+	assert.ErrorIs(t, err, keys.ErrKeyExists)
+
+	authority, err = Load(caStore)
+	require.NoError(t, err)
+
+	store := keys.NewFSStore(t.TempDir())
+	privKey, err := keys.GenerateKey(ssh.KeyAlgoECDSA256, 0)
+	require.NoError(t, err)
+	key := &models.Key{Name: "id_ecdsa", Private: privKey}
+	require.NoError(t, store.Create(key))
+
+	cert, err := authority.SignKey(key, Options{
+		CertType:        ssh.UserCert,
+		KeyID:           "me",
+		Principals:      []string{"me"},
+		Validity:        8 * time.Hour,
+		CriticalOptions: map[string]string{"force-command": "uptime"},
+		Extensions:      DefaultUserExtensions(),
+	})
+	require.NoError(t, err)
+	assert.NotZero(t, cert.Serial)
+	assert.Equal(t, uint64(8*time.Hour.Seconds()), cert.ValidBefore-cert.ValidAfter)
+
+	_, err = authority.Sign(key.Public, Options{CertType: ssh.UserCert, Validity: -time.Hour})
+	assert.Error(t, err)
+
+	// The certificate is discovered next to the key.
+	got, err := store.Get("id_ecdsa")
+	require.NoError(t, err)
+	require.NotNil(t, got.Certificate)
+	assert.Equal(t, cert.Marshal(), got.Certificate.Marshal())
+
+	checker := &ssh.CertChecker{
+		SupportedCriticalOptions: []string{"force-command"},
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return string(auth.Marshal()) == string(authority.Key.Public.Marshal())
+		},
+	}
+	perms, err := checker.Authenticate(fakeConnMetadata("me"), cert)
+	require.NoError(t, err)
+	assert.Equal(t, "uptime", perms.CriticalOptions["force-command"])
+
+	_, err = checker.Authenticate(fakeConnMetadata("root"), cert)
+	assert.Error(t, err)
+}
+
+func TestLoadNotInitialized(t *testing.T) {
+	_, err := Load(keys.NewFSStore(t.TempDir()))
+	assert.ErrorIs(t, err, ErrNotInitialized)
+}
+
+// fakeConnMetadata implements ssh.ConnMetadata for the user.
+type fakeConnMetadata string
+
+func (f fakeConnMetadata) User() string          { return string(f) }
+func (f fakeConnMetadata) SessionID() []byte     { return nil }
+func (f fakeConnMetadata) ClientVersion() []byte { return nil }
+func (f fakeConnMetadata) ServerVersion() []byte { return nil }
+func (f fakeConnMetadata) RemoteAddr() net.Addr  { return &net.TCPAddr{} }
+func (f fakeConnMetadata) LocalAddr() net.Addr   { return &net.TCPAddr{} }
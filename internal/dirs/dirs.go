@@ -0,0 +1,61 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dirs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// appName is the name of the application directory under XDG base dirs.
+const appName = "ssh-keys"
+
+// SSHDir returns the user's ~/.ssh directory.
+func SSHDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("get user home dir: %w", err)
+	}
+
+	return filepath.Join(home, ".ssh"), nil
+}
+
+// DataDir returns the application data directory, $XDG_DATA_HOME/ssh-keys
+// or ~/.local/share/ssh-keys when the variable is unset.
+func DataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, appName), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("get user home dir: %w", err)
+	}
+
+	return filepath.Join(home, ".local", "share", appName), nil
+}
+
+// DataFile returns the path of the named file in the application data
+// directory.
+func DataFile(name string) (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, name), nil
+}
@@ -0,0 +1,202 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gitconfig configures SSH commit signing of git(1). The config is
+// read and written by git itself, so includes and scopes work as usual.
+package gitconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// The scopes of git config. The default scope reads the effective value of
+// all scopes and writes to the repository config.
+const (
+	ScopeDefault  = ""
+	ScopeGlobal   = "global"
+	ScopeLocal    = "local"
+	ScopeSystem   = "system"
+	ScopeWorktree = "worktree"
+)
+
+// Scopes are the scopes which can be chosen explicitly.
+var Scopes = []string{ScopeGlobal, ScopeLocal, ScopeSystem, ScopeWorktree}
+
+// literalPrefix marks a signing key given inline instead of a key file.
+const literalPrefix = "key::"
+
+// Git runs git config commands.
+type Git struct {
+	// Dir is the working directory, which selects the repository of the
+	// local scope. Empty means the current directory.
+	Dir string
+	// Env is added to the environment of git, e.g. GIT_CONFIG_GLOBAL.
+	Env []string
+}
+
+// Get returns the value of the key in the scope, or an empty string when
+// the key is not set.
+func (g *Git) Get(scope, key string) (string, error) {
+	args := append(scopeArgs(scope), "--get", key)
+	out, err := g.run(args...)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// git config exits with 1 when the key is not set.
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(out, "\n"), nil
+}
+
+// Set sets the value of the key in the scope.
+func (g *Git) Set(scope, key, value string) error {
+	_, err := g.run(append(scopeArgs(scope), key, value)...)
+	return err
+}
+
+// SigningKey returns the public key of user.signingkey when git signs with
+// SSH keys, or nil when it does not.
+func (g *Git) SigningKey() (ssh.PublicKey, error) {
+	format, err := g.Get(ScopeDefault, "gpg.format")
+	if err != nil || format != "ssh" {
+		return nil, err
+	}
+	value, err := g.Get(ScopeDefault, "user.signingkey")
+	if err != nil || value == "" {
+		return nil, err
+	}
+
+	return ParseSigningKey(value)
+}
+
+// Setup configures git in the scope to sign with the key, verifying
+// signatures with the allowed_signers file unless it is empty.
+func (g *Git) Setup(scope string, key *models.Key, allowedSigners string) error {
+	settings := [][2]string{
+		{"gpg.format", "ssh"},
+		{"user.signingkey", SigningKeyValue(key)},
+	}
+	if allowedSigners != "" {
+		settings = append(settings, [2]string{"gpg.ssh.allowedSignersFile", allowedSigners})
+	}
+	for _, s := range settings {
+		if err := g.Set(scope, s[0], s[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SigningKeyValue returns the value of user.signingkey for the key: the path
+// of the public key file when there is one, otherwise the key itself.
+func SigningKeyValue(key *models.Key) string {
+	if key.Path != "" {
+		if _, err := os.Stat(key.Path + ".pub"); err == nil {
+			return key.Path + ".pub"
+		}
+	}
+
+	return literalPrefix + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key.Public)))
+}
+
+// ParseSigningKey parses the value of user.signingkey: a key prefixed with
+// key::, or the path of a public or private key file. For private key files
+// the public key is read from the .pub file next to it.
+func ParseSigningKey(value string) (ssh.PublicKey, error) {
+	if literal, ok := strings.CutPrefix(value, literalPrefix); ok {
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(literal))
+		if err != nil {
+			return nil, fmt.Errorf("parse user.signingkey: %v", err)
+		}
+		return pub, nil
+	}
+	// Old git versions take the key without the prefix.
+	if slices.ContainsFunc([]string{"ssh-", "ecdsa-", "sk-"}, func(prefix string) bool {
+		return strings.HasPrefix(value, prefix)
+	}) {
+		return ParseSigningKey(literalPrefix + value)
+	}
+
+	path, err := expandHome(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range []string{path, path + ".pub"} {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		if pub, _, _, _, err := ssh.ParseAuthorizedKey(data); err == nil {
+			return pub, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no public key found for user.signingkey %s", value)
+}
+
+// run runs git config with the arguments and returns its output.
+func (g *Git) run(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"config"}, args...)...)
+	cmd.Dir = g.Dir
+	cmd.Env = append(os.Environ(), g.Env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git config: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("git config: %w", err)
+	}
+
+	return stdout.String(), nil
+}
+
+// scopeArgs returns the git config arguments selecting the scope.
+func scopeArgs(scope string) []string {
+	if scope == ScopeDefault {
+		return nil
+	}
+
+	return []string{"--" + scope}
+}
+
+// expandHome expands the leading ~/ of the path.
+func expandHome(path string) (string, error) {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("get user home dir: %w", err)
+	}
+
+	return filepath.Join(home, rest), nil
+}
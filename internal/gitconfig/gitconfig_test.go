@@ -0,0 +1,105 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitconfig
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestGit returns git with empty global config and no system config.
+func newTestGit(t *testing.T) *Git {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+
+	return &Git{
+		Dir: dir,
+		Env: []string{
+			"GIT_CONFIG_GLOBAL=" + filepath.Join(dir, ".gitconfig"),
+			"GIT_CONFIG_NOSYSTEM=1",
+		},
+	}
+}
+
+func newTestKey(t *testing.T, dir string) *models.Key {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+
+	return &models.Key{Name: "id_test", Path: filepath.Join(dir, "id_test"), Public: sshPub}
+}
+
+func TestSetup(t *testing.T) {
+	g := newTestGit(t)
+	key := newTestKey(t, g.Dir)
+
+	got, err := g.SigningKey()
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	// Without the .pub file the key is configured literally.
+	require.NoError(t, g.Setup(ScopeGlobal, key, "/tmp/allowed_signers"))
+	value, err := g.Get(ScopeGlobal, "user.signingkey")
+	require.NoError(t, err)
+	assert.Contains(t, value, "key::ssh-ed25519 ")
+	got, err = g.SigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, key.Public.Marshal(), got.Marshal())
+
+	require.NoError(t, os.WriteFile(key.Path+".pub", ssh.MarshalAuthorizedKey(key.Public), 0644))
+	require.NoError(t, g.Setup(ScopeGlobal, key, "/tmp/allowed_signers"))
+	value, err = g.Get(ScopeGlobal, "user.signingkey")
+	require.NoError(t, err)
+	assert.Equal(t, key.Path+".pub", value)
+	got, err = g.SigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, key.Public.Marshal(), got.Marshal())
+
+	value, err = g.Get(ScopeDefault, "gpg.ssh.allowedSignersFile")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/allowed_signers", value)
+
+	// The local scope needs a repository.
+	assert.Error(t, g.Set(ScopeLocal, "gpg.format", "ssh"))
+}
+
+func TestParseSigningKey(t *testing.T) {
+	dir := t.TempDir()
+	key := newTestKey(t, dir)
+	require.NoError(t, os.WriteFile(key.Path+".pub", ssh.MarshalAuthorizedKey(key.Public), 0644))
+
+	// The private key path finds the .pub file next to it.
+	for _, value := range []string{key.Path, key.Path + ".pub", string(ssh.MarshalAuthorizedKey(key.Public))} {
+		got, err := ParseSigningKey(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, key.Public.Marshal(), got.Marshal())
+	}
+	_, err := ParseSigningKey(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
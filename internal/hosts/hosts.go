@@ -0,0 +1,235 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package hosts manages known_hosts files of OpenSSH, see sshd(8).
+package hosts
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/mixanemca/ssh-keys/internal/linefile"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Markers of known_hosts lines.
+const (
+	MarkerCertAuthority = "cert-authority"
+	MarkerRevoked       = "revoked"
+)
+
+// hashPrefix is the prefix of hashed host names.
+const hashPrefix = "|1|"
+
+// Entry is a key line of known_hosts file.
+type Entry struct {
+	// Line is the line number in the file, starting from 1.
+	Line int
+	// Marker is empty, MarkerCertAuthority or MarkerRevoked.
+	Marker string
+	// Hosts are the host patterns or hashed host names.
+	Hosts []string
+	// Key is the host key or CA key.
+	Key ssh.PublicKey
+	// Comment is the comment after the key.
+	Comment string
+}
+
+// Fingerprint returns SHA256 fingerprint of the key.
+func (e *Entry) Fingerprint() string {
+	return ssh.FingerprintSHA256(e.Key)
+}
+
+// Hashed reports whether the host names of the entry are hashed.
+func (e *Entry) Hashed() bool {
+	for _, h := range e.Hosts {
+		if strings.HasPrefix(h, hashPrefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Match reports whether the entry applies to the host, which may have a port
+// like host:2222. Hashed host names are compared by hashing the host with
+// the salt of the entry, plain ones support * and ? wildcards and !
+// negation.
+func (e *Entry) Match(host string) bool {
+	normalized := knownhosts.Normalize(host)
+
+	matched := false
+	for _, pattern := range e.Hosts {
+		if strings.HasPrefix(pattern, hashPrefix) {
+			if matchHashed(pattern, normalized) {
+				matched = true
+			}
+			continue
+		}
+		negate := strings.HasPrefix(pattern, "!")
+		if wildcardMatch(strings.TrimPrefix(pattern, "!"), normalized) {
+			if negate {
+				return false
+			}
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+// File is a known_hosts file.
+type File struct {
+	path  string
+	lines *linefile.Lines[*Entry]
+}
+
+// Load reads known_hosts file. A missing file is treated as empty.
+func Load(path string) (*File, error) {
+	lines, err := linefile.Read(path, parseLine, func(e *Entry, n int) { e.Line = n })
+	if err != nil {
+		return nil, fmt.Errorf("read known hosts: %v", err)
+	}
+
+	return &File{path: path, lines: lines}, nil
+}
+
+// parseLine parses the host key line. Comments, markers of unknown kinds and
+// other lines ssh(1) skips have no entry.
+func parseLine(raw string) (*Entry, error) {
+	marker, hosts, key, comment, _, err := ssh.ParseKnownHosts([]byte(raw))
+	if err != nil {
+		return nil, nil
+	}
+
+	return &Entry{Marker: marker, Hosts: hosts, Key: key, Comment: comment}, nil
+}
+
+// Path returns the file path.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Entries returns the key entries of the file.
+func (f *File) Entries() []*Entry {
+	return f.lines.Entries()
+}
+
+// Search returns the entries applying to the host.
+func (f *File) Search(host string) []*Entry {
+	var found []*Entry
+	for _, e := range f.Entries() {
+		if e.Match(host) {
+			found = append(found, e)
+		}
+	}
+
+	return found
+}
+
+// Add appends a plain entry with the host key for the addresses, which are
+// normalized like host or [host]:port.
+func (f *File) Add(addresses []string, key ssh.PublicKey) *Entry {
+	hosts := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		hosts = append(hosts, knownhosts.Normalize(a))
+	}
+	e := &Entry{Hosts: hosts, Key: key}
+	f.lines.Append(knownhosts.Line(addresses, key), e)
+
+	return e
+}
+
+// RemoveHost deletes the host key lines applying to the host and returns
+// the number of removed lines. Like ssh-keygen -R, @cert-authority and
+// @revoked lines are kept.
+func (f *File) RemoveHost(host string) int {
+	return f.lines.Remove(func(e *Entry) bool {
+		return e.Marker == "" && e.Match(host)
+	})
+}
+
+// RemoveLine deletes the entry at the line number. It reports whether the
+// entry was found.
+func (f *File) RemoveLine(n int) bool {
+	return f.lines.Remove(func(e *Entry) bool {
+		return e.Line == n
+	}) > 0
+}
+
+// Save atomically replaces the file keeping its permissions, a new file is
+// created with 0600 permissions.
+func (f *File) Save() error {
+	if err := f.lines.Save(f.path); err != nil {
+		return fmt.Errorf("write known hosts: %v", err)
+	}
+
+	return nil
+}
+
+// matchHashed reports whether the hashed host name |1|salt|hash is the
+// hash of the host.
+func matchHashed(hashed, host string) bool {
+	parts := strings.Split(strings.TrimPrefix(hashed, hashPrefix), "|")
+	if len(parts) != 2 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// wildcardMatch matches the host against the pattern with * and ? wildcards,
+// case insensitively.
+func wildcardMatch(pattern, host string) bool {
+	pattern, host = strings.ToLower(pattern), strings.ToLower(host)
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := 0; i <= len(host); i++ {
+				if wildcardMatch(pattern[1:], host[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if host == "" {
+				return false
+			}
+		default:
+			if host == "" || pattern[0] != host[0] {
+				return false
+			}
+		}
+		pattern, host = pattern[1:], host[1:]
+	}
+
+	return host == ""
+}
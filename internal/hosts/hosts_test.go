@@ -0,0 +1,98 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hosts
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestPublicKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+
+	return sshPub
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	plain, hashed, ca, revoked := newTestPublicKey(t), newTestPublicKey(t), newTestPublicKey(t), newTestPublicKey(t)
+
+	lines := []string{
+		"# managed by hand",
+		knownhosts.Line([]string{"git.example.com", "10.0.0.1"}, plain),
+		knownhosts.Line([]string{knownhosts.HashHostname(knownhosts.Normalize("db.example.com:2222"))}, hashed),
+		"@cert-authority *.example.com,!bastion.example.com " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca))),
+		"@revoked * " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(revoked))),
+		"",
+	}
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600))
+
+	f, err := Load(path)
+	require.NoError(t, err)
+	entries := f.Entries()
+	require.Len(t, entries, 4)
+	assert.Equal(t, MarkerCertAuthority, entries[2].Marker)
+	assert.Equal(t, MarkerRevoked, entries[3].Marker)
+	assert.True(t, entries[1].Hashed())
+
+	cases := []struct {
+		host string
+		want []int
+	}{
+		{"git.example.com", []int{2, 4, 5}},
+		{"10.0.0.1:22", []int{2, 5}},
+		{"db.example.com:2222", []int{3, 5}},
+		{"db.example.com", []int{4, 5}},
+		{"bastion.example.com", []int{5}},
+	}
+	for _, c := range cases {
+		var got []int
+		for _, e := range f.Search(c.host) {
+			got = append(got, e.Line)
+		}
+		assert.Equal(t, c.want, got, c.host)
+	}
+
+	assert.Equal(t, 1, f.RemoveHost("[db.example.com]:2222"))
+	require.NoError(t, f.Save())
+
+	f, err = Load(path)
+	require.NoError(t, err)
+	require.Len(t, f.Entries(), 3)
+	assert.True(t, f.RemoveLine(2))
+	assert.False(t, f.RemoveLine(100))
+
+	e := f.Add([]string{"new.example.com:2022"}, plain)
+	assert.Equal(t, []string{"[new.example.com]:2022"}, e.Hosts)
+	require.NoError(t, f.Save())
+	f, err = Load(path)
+	require.NoError(t, err)
+	// The @revoked * entry applies to the new host too.
+	require.Len(t, f.Search("new.example.com:2022"), 2)
+}
@@ -0,0 +1,38 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/models"
+)
+
+// DefaultMaxAge is the default rotation period of keys.
+const DefaultMaxAge = 365 * 24 * time.Hour
+
+// FormatAge formats the key age in whole days, like 42d.
+func FormatAge(d time.Duration) string {
+	return fmt.Sprintf("%dd", int(d/(24*time.Hour)))
+}
+
+// Overdue reports whether the key is older than maxAge. Keys with unknown
+// creation time are never overdue and zero maxAge disables the check.
+func Overdue(k *models.Key, maxAge time.Duration, now time.Time) bool {
+	return maxAge > 0 && !k.Created.IsZero() && k.Age(now) > maxAge
+}
@@ -0,0 +1,55 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyAge(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	created := time.Now().Add(-400 * 24 * time.Hour).Truncate(time.Second)
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	require.NoError(t, store.Create(&models.Key{Name: "id_old", Private: priv, Created: created}))
+
+	list, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	now := time.Now()
+	k := list[0]
+	assert.True(t, k.Created.Equal(created))
+	assert.Equal(t, "400d", FormatAge(k.Age(now)))
+	assert.True(t, Overdue(k, DefaultMaxAge, now))
+	assert.False(t, Overdue(k, 0, now))
+	assert.False(t, Overdue(k, 500*24*time.Hour, now))
+
+	// The modification time of the key file is the creation time.
+	require.NoError(t, os.Chtimes(k.Path, now, now))
+	k, err = store.Get(k.Name)
+	require.NoError(t, err)
+	assert.False(t, Overdue(k, DefaultMaxAge, now))
+	assert.False(t, Overdue(&models.Key{}, DefaultMaxAge, now), "unknown creation time")
+}
@@ -0,0 +1,138 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// CertSuffix is the suffix of the certificate file next to the private key.
+const CertSuffix = "-cert.pub"
+
+// CertExpiryWarning is the time before the certificate expiry when it is
+// considered soon to expire.
+const CertExpiryWarning = 24 * time.Hour
+
+// CertStatus describes the validity of a certificate at a moment.
+type CertStatus int
+
+const (
+	// CertValid is a certificate which is valid and not going to expire soon.
+	CertValid CertStatus = iota
+	// CertExpiringSoon is a valid certificate which expires within CertExpiryWarning.
+	CertExpiringSoon
+	// CertExpired is a certificate which validity window is over.
+	CertExpired
+	// CertNotYetValid is a certificate which validity window is not started.
+	CertNotYetValid
+)
+
+// String implements fmt.Stringer interface
+func (s CertStatus) String() string {
+	switch s {
+	case CertValid:
+		return "valid"
+	case CertExpiringSoon:
+		return "expiring soon"
+	case CertExpired:
+		return "expired"
+	case CertNotYetValid:
+		return "not yet valid"
+	default:
+		return "unknown"
+	}
+}
+
+// CertificateStatus returns the status of the certificate at the moment now.
+func CertificateStatus(cert *ssh.Certificate, now time.Time) CertStatus {
+	unix := uint64(now.Unix())
+	switch {
+	case unix < cert.ValidAfter:
+		return CertNotYetValid
+	case cert.ValidBefore != ssh.CertTimeInfinity && unix >= cert.ValidBefore:
+		return CertExpired
+	case cert.ValidBefore != ssh.CertTimeInfinity && unix+uint64(CertExpiryWarning.Seconds()) >= cert.ValidBefore:
+		return CertExpiringSoon
+	default:
+		return CertValid
+	}
+}
+
+// DescribeCertificate returns the human readable lines with the certificate
+// type, key ID, serial, principals, validity window and CA fingerprint.
+func DescribeCertificate(cert *ssh.Certificate) []string {
+	certType := "user"
+	if cert.CertType == ssh.HostCert {
+		certType = "host"
+	}
+	principals := "(any)"
+	if len(cert.ValidPrincipals) > 0 {
+		principals = strings.Join(cert.ValidPrincipals, ", ")
+	}
+
+	return []string{
+		fmt.Sprintf("Type: %s certificate", certType),
+		fmt.Sprintf("Key ID: %q", cert.KeyId),
+		fmt.Sprintf("Serial: %d", cert.Serial),
+		fmt.Sprintf("Principals: %s", principals),
+		fmt.Sprintf("Valid: %s", formatValidity(cert)),
+		fmt.Sprintf("CA: %s %s", cert.SignatureKey.Type(), ssh.FingerprintSHA256(cert.SignatureKey)),
+	}
+}
+
+// formatValidity formats the validity window of the certificate.
+func formatValidity(cert *ssh.Certificate) string {
+	from := "always"
+	if cert.ValidAfter != 0 {
+		from = "from " + time.Unix(int64(cert.ValidAfter), 0).Format(time.DateTime)
+	}
+	to := "forever"
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		to = "to " + time.Unix(int64(cert.ValidBefore), 0).Format(time.DateTime)
+	}
+
+	return from + " " + to
+}
+
+// loadCertificate reads the certificate of the key at path, if it exists and
+// certifies the public key.
+func loadCertificate(path string, pub ssh.PublicKey) (*ssh.Certificate, error) {
+	data, err := os.ReadFile(path + CertSuffix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read certificate file: %v", err)
+	}
+
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, nil
+	}
+	cert, ok := parsed.(*ssh.Certificate)
+	if !ok || !bytes.Equal(cert.Key.Marshal(), pub.Marshal()) {
+		return nil, nil
+	}
+
+	return cert, nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestCertificate(t *testing.T, pub ssh.PublicKey, validAfter, validBefore time.Time) *ssh.Certificate {
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ca, err := ssh.NewSignerFromKey(caKey)
+	require.NoError(t, err)
+
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          42,
+		CertType:        ssh.UserCert,
+		KeyId:           "me@work",
+		ValidPrincipals: []string{"me", "deploy"},
+		ValidAfter:      uint64(validAfter.Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+
+	return cert
+}
+
+func TestLoadPrivateKeysWithCertificate(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFSStore(dir)
+	privKey, err := ssh.ParseRawPrivateKey([]byte(keyEd25519))
+	require.NoError(t, err)
+
+	key := &models.Key{Name: "id_ed25519", Private: privKey}
+	require.NoError(t, store.Create(key))
+	now := time.Now()
+	cert := newTestCertificate(t, key.Public, now.Add(-time.Hour), now.Add(time.Hour))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "id_ed25519"+CertSuffix), ssh.MarshalAuthorizedKey(cert), 0644))
+
+	list, err := LoadPrivateKeys(dir)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.NotNil(t, list[0].Certificate)
+	assert.Equal(t, "me@work", list[0].Certificate.KeyId)
+	assert.Equal(t, CertExpiringSoon, CertificateStatus(list[0].Certificate, now))
+
+	lines := DescribeCertificate(list[0].Certificate)
+	assert.Contains(t, lines, "Principals: me, deploy")
+	assert.Contains(t, lines, "Serial: 42")
+
+	// A certificate of another key is ignored.
+	other, err := ssh.ParseRawPrivateKey([]byte(keyECDSA))
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(other)
+	require.NoError(t, err)
+	cert = newTestCertificate(t, signer.PublicKey(), now, now.Add(time.Hour))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "id_ed25519"+CertSuffix), ssh.MarshalAuthorizedKey(cert), 0644))
+
+	got, err := store.Get("id_ed25519")
+	require.NoError(t, err)
+	assert.Nil(t, got.Certificate)
+
+	// Unreadable companion files don't hide the key.
+	for _, suffix := range []string{CertSuffix, ".pub"} {
+		path := filepath.Join(dir, "id_ed25519"+suffix)
+		require.NoError(t, os.Remove(path))
+		require.NoError(t, os.Mkdir(path, 0700))
+	}
+	list, err = LoadPrivateKeys(dir)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Nil(t, list[0].Certificate)
+}
+
+func TestCertificateStatus(t *testing.T) {
+	now := time.Now()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name        string
+		validAfter  time.Time
+		validBefore time.Time
+		want        CertStatus
+	}{
+		{"Test valid certificate", now.Add(-time.Hour), now.Add(48 * time.Hour), CertValid},
+		{"Test expiring certificate", now.Add(-time.Hour), now.Add(time.Hour), CertExpiringSoon},
+		{"Test expired certificate", now.Add(-2 * time.Hour), now.Add(-time.Hour), CertExpired},
+		{"Test not yet valid certificate", now.Add(time.Hour), now.Add(48 * time.Hour), CertNotYetValid},
+	}
+
+	for _, c := range cases {
+		cert := newTestCertificate(t, sshPub, c.validAfter, c.validBefore)
+		assert.Equal(t, c.want, CertificateStatus(cert, now), c.name)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// Encodings lists the encodings supported by EncodePrivateKey.
+var Encodings = []string{EncodingOpenSSH, EncodingPKCS8, EncodingPEM, EncodingPPK}
+
+// EncodePrivateKey serializes the private key in the encoding. The key is
+// encrypted when the passphrase is not empty. PuTTY keys are written in
+// version 3 of the format.
+func EncodePrivateKey(key *models.Key, encoding string, passphrase []byte) ([]byte, error) {
+	privKey := NormalizePrivateKey(key.Private)
+
+	switch encoding {
+	case EncodingOpenSSH:
+		var (
+			block *pem.Block
+			err   error
+		)
+		if len(passphrase) > 0 {
+			block, err = ssh.MarshalPrivateKeyWithPassphrase(privKey, key.Comment, passphrase)
+		} else {
+			block, err = ssh.MarshalPrivateKey(privKey, key.Comment)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("marshal private key: %v", err)
+		}
+		return pem.EncodeToMemory(block), nil
+	case EncodingPKCS8:
+		der, err := x509.MarshalPKCS8PrivateKey(privKey)
+		if err != nil {
+			return nil, fmt.Errorf("marshal private key: %v", err)
+		}
+		if len(passphrase) == 0 {
+			return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+		}
+		if der, err = encryptPKCS8(der, passphrase); err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}), nil
+	case EncodingPEM:
+		if len(passphrase) > 0 {
+			return nil, fmt.Errorf("encryption is not supported for %s encoding, use %s", EncodingPEM, EncodingPKCS8)
+		}
+		switch k := privKey.(type) {
+		case *rsa.PrivateKey:
+			return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}), nil
+		case *ecdsa.PrivateKey:
+			der, err := x509.MarshalECPrivateKey(k)
+			if err != nil {
+				return nil, fmt.Errorf("marshal private key: %v", err)
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+		default:
+			return nil, fmt.Errorf("%s keys have no %s encoding, use %s", key.Format, EncodingPEM, EncodingPKCS8)
+		}
+	case EncodingPPK:
+		return encodePPK(privKey, key.Comment, passphrase, 3)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
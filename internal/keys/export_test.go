@@ -0,0 +1,53 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"testing"
+
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestEncodePrivateKey(t *testing.T) {
+	for algo, privKey := range generateTestKeys(t) {
+		signer, err := ssh.NewSignerFromKey(privKey)
+		require.NoError(t, err)
+		key := &models.Key{Format: algo, Comment: "me@work", Private: privKey, Public: signer.PublicKey()}
+
+		for _, encoding := range Encodings {
+			for _, passphrase := range []string{"", "secret"} {
+				data, err := EncodePrivateKey(key, encoding, []byte(passphrase))
+				if encoding == EncodingPEM && (passphrase != "" || algo == ssh.KeyAlgoED25519) {
+					assert.Error(t, err, algo, encoding)
+					continue
+				}
+				require.NoError(t, err, algo, encoding)
+
+				got, gotEncoding, err := DecodePrivateKey(data, []byte(passphrase))
+				require.NoError(t, err, algo, encoding)
+				assert.Equal(t, encoding, gotEncoding)
+				assert.Equal(t, key.Public.Marshal(), got.Public.Marshal(), algo, encoding)
+			}
+		}
+	}
+
+	_, err := EncodePrivateKey(&models.Key{}, "jks", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,55 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultRSABits is the size of generated RSA keys when no size is given.
+const DefaultRSABits = 3072
+
+// GenerateKey generates a new private key of the SSH key type, like
+// ssh-ed25519 or ecdsa-sha2-nistp256. The bits are used for RSA keys only,
+// zero means DefaultRSABits.
+func GenerateKey(keyType string, bits int) (any, error) {
+	switch keyType {
+	case ssh.KeyAlgoED25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case ssh.KeyAlgoRSA:
+		if bits == 0 {
+			bits = DefaultRSABits
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	case ssh.KeyAlgoECDSA256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ssh.KeyAlgoECDSA384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case ssh.KeyAlgoECDSA521:
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", keyType)
+	}
+}
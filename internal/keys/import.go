@@ -0,0 +1,154 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// Encodings of private key files.
+const (
+	EncodingOpenSSH = "openssh"
+	EncodingPEM     = "pem"
+	EncodingPKCS8   = "pkcs8"
+	EncodingPPK     = "ppk"
+)
+
+var (
+	// ErrPassphraseRequired is returned when the key is encrypted and no
+	// passphrase was given.
+	ErrPassphraseRequired = errors.New("passphrase required")
+	// ErrWrongPassphrase is returned when the key can't be decrypted with the
+	// given passphrase.
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	// ErrUnknownFormat is returned when the private key encoding is not recognized.
+	ErrUnknownFormat = errors.New("unknown private key format")
+)
+
+// DecodePrivateKey detects the encoding of the private key file, parses it
+// and returns the key without a name along with the detected encoding.
+// OpenSSH, PKCS#1 and SEC1 PEM, plain or PBES2 encrypted PKCS#8 PEM, PKCS#8
+// DER and PuTTY .ppk v2/v3 files are supported.
+func DecodePrivateKey(data, passphrase []byte) (*models.Key, string, error) {
+	var (
+		privKey  any
+		comment  string
+		encoding string
+		err      error
+	)
+
+	if isPPK(data) {
+		encoding = EncodingPPK
+		privKey, comment, err = parsePPK(data, passphrase)
+	} else if block, _ := pem.Decode(data); block != nil {
+		switch block.Type {
+		case "OPENSSH PRIVATE KEY":
+			encoding = EncodingOpenSSH
+		case "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			encoding = EncodingPEM
+		case "PRIVATE KEY":
+			encoding = EncodingPKCS8
+		case "ENCRYPTED PRIVATE KEY":
+			encoding = EncodingPKCS8
+		default:
+			return nil, "", fmt.Errorf("%w: PEM block %q", ErrUnknownFormat, block.Type)
+		}
+		if block.Type == "ENCRYPTED PRIVATE KEY" {
+			privKey, err = decryptPKCS8(block.Bytes, passphrase)
+		} else {
+			privKey, err = decodePEMPrivateKey(data, passphrase)
+		}
+	} else {
+		privKey, encoding, err = parseDERPrivateKey(data)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	signer, err := ssh.NewSignerFromKey(privKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("create signer: %v", err)
+	}
+
+	return &models.Key{
+		Format:  signer.PublicKey().Type(),
+		Comment: comment,
+		Private: privKey,
+		Public:  signer.PublicKey(),
+	}, encoding, nil
+}
+
+// ImportKey decodes the private key file data and saves the key to the
+// store under the name. An empty comment is replaced by the one found in
+// the file, if any.
+func ImportKey(store KeyStore, name, comment string, data, passphrase []byte) (*models.Key, error) {
+	key, _, err := DecodePrivateKey(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key.Name = name
+	if comment != "" {
+		key.Comment = comment
+	}
+	if err := store.Create(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// decodePEMPrivateKey parses the PEM encoded private key, decrypting it with
+// the passphrase if needed.
+func decodePEMPrivateKey(data, passphrase []byte) (any, error) {
+	privKey, err := ssh.ParseRawPrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return privKey, err
+	}
+	if len(passphrase) == 0 {
+		return nil, ErrPassphraseRequired
+	}
+
+	privKey, err = ssh.ParseRawPrivateKeyWithPassphrase(data, passphrase)
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, ErrWrongPassphrase
+	}
+
+	return privKey, err
+}
+
+// parseDERPrivateKey parses the private key in binary PKCS#8, PKCS#1 or SEC1
+// form.
+func parseDERPrivateKey(data []byte) (any, string, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(data); err == nil {
+		return key, EncodingPKCS8, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(data); err == nil {
+		return key, EncodingPEM, nil
+	}
+	if key, err := x509.ParseECPrivateKey(data); err == nil {
+		return key, EncodingPEM, nil
+	}
+
+	return nil, "", ErrUnknownFormat
+}
@@ -0,0 +1,295 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+// The PuTTY Ed25519 keys with the seed of bytes 1 to 31 followed by a zero
+// byte, which PuTTY drops when writing the seed.
+const (
+	ppkEd25519TrailingZero = `PuTTY-User-Key-File-3: ssh-ed25519
+Encryption: none
+Comment: ed25519-key-20231018
+Public-Lines: 2
+AAAAC3NzaC1lZDI1NTE5AAAAINctxmemDGBZtcOnmpCZGvJSIV2/IBBhdi0QdxOT
+59ZR
+Private-Lines: 1
+AAAAHwECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=
+Private-MAC: 190e06fa38f046f325e6140165484bc7942e33fadb1f1975367d370bf7743f47
+`
+	ppkEd25519TrailingZeroV2 = `PuTTY-User-Key-File-2: ssh-ed25519
+Encryption: aes256-cbc
+Comment: ed25519-key-20231018
+Public-Lines: 2
+AAAAC3NzaC1lZDI1NTE5AAAAINctxmemDGBZtcOnmpCZGvJSIV2/IBBhdi0QdxOT
+59ZR
+Private-Lines: 1
+sMyuSowAE//ARNxux974iE9ahyTSfmI+wbMqxOnUmkEXJS+NxTe33lpLgLrCwh6V
+Private-MAC: 9768c33f76e5e22cd77257f7008ca72887a2cf79
+`
+)
+
+func generateTestKeys(t *testing.T) map[string]any {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return map[string]any{
+		ssh.KeyAlgoRSA:      rsaKey,
+		ssh.KeyAlgoECDSA256: ecKey,
+		ssh.KeyAlgoED25519:  edKey,
+	}
+}
+
+// encodeTestPPK writes the key in PuTTY format following the PPK
+// specification, independently of the exporter.
+func encodeTestPPK(t *testing.T, key any, comment string, passphrase []byte, version int) []byte {
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	algorithm := signer.PublicKey().Type()
+	public := signer.PublicKey().Marshal()
+
+	var private []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		k.Precompute()
+		private = ssh.Marshal(struct{ D, P, Q, Iqmp *big.Int }{k.D, k.Primes[0], k.Primes[1], k.Precomputed.Qinv})
+	case *ecdsa.PrivateKey:
+		private = ssh.Marshal(struct{ D *big.Int }{k.D})
+	case ed25519.PrivateKey:
+		private = ssh.Marshal(struct{ Seed []byte }{k.Seed()})
+	}
+
+	return writeTestPPK(t, algorithm, public, private, comment, passphrase, version)
+}
+
+// writeTestPPK writes the PuTTY key file of the blobs, encrypting the private
+// blob when the passphrase is set.
+func writeTestPPK(t *testing.T, algorithm string, public, private []byte, comment string, passphrase []byte, version int) []byte {
+	encryption := "none"
+	if len(passphrase) > 0 {
+		encryption = "aes256-cbc"
+		if n := len(private) % aes.BlockSize; n != 0 {
+			private = append(private, make([]byte, aes.BlockSize-n)...)
+		}
+	}
+
+	var (
+		kdfHeaders            string
+		cipherKey, iv, macKey []byte
+		newMAC                func() hash.Hash = sha256.New
+	)
+	switch version {
+	case 2:
+		newMAC = sha1.New
+		sum := sha1.Sum(append([]byte("putty-private-key-file-mac-key"), passphrase...))
+		macKey = sum[:]
+		first := sha1.Sum(append([]byte{0, 0, 0, 0}, passphrase...))
+		second := sha1.Sum(append([]byte{0, 0, 0, 1}, passphrase...))
+		cipherKey, iv = append(first[:], second[:]...)[:32], make([]byte, aes.BlockSize)
+	case 3:
+		if len(passphrase) > 0 {
+			salt := make([]byte, 16)
+			_, err := rand.Read(salt)
+			require.NoError(t, err)
+			derived := argon2.IDKey(passphrase, salt, 1, 8192, 1, 80)
+			cipherKey, iv, macKey = derived[:32], derived[32:48], derived[48:]
+			kdfHeaders = fmt.Sprintf("Key-Derivation: Argon2id\nArgon2-Memory: 8192\nArgon2-Passes: 1\nArgon2-Parallelism: 1\nArgon2-Salt: %x\n", salt)
+		}
+	}
+
+	mac := hmac.New(newMAC, macKey)
+	for _, field := range [][]byte{[]byte(algorithm), []byte(encryption), []byte(comment), public, private} {
+		mac.Write(binary.BigEndian.AppendUint32(nil, uint32(len(field))))
+		mac.Write(field)
+	}
+
+	if len(passphrase) > 0 {
+		block, err := aes.NewCipher(cipherKey)
+		require.NoError(t, err)
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(private, private)
+	}
+
+	lines := func(blob []byte) string {
+		encoded := base64.StdEncoding.EncodeToString(blob)
+		var chunks []string
+		for len(encoded) > 64 {
+			chunks = append(chunks, encoded[:64])
+			encoded = encoded[64:]
+		}
+		chunks = append(chunks, encoded)
+		return fmt.Sprintf("%d\n%s\n", len(chunks), strings.Join(chunks, "\n"))
+	}
+
+	return []byte(fmt.Sprintf("PuTTY-User-Key-File-%d: %s\nEncryption: %s\nComment: %s\nPublic-Lines: %s%sPrivate-Lines: %sPrivate-MAC: %x\n",
+		version, algorithm, encryption, comment, lines(public), kdfHeaders, lines(private), mac.Sum(nil)))
+}
+
+func TestDecodePrivateKeyPEM(t *testing.T) {
+	for algo, key := range generateTestKeys(t) {
+		pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		openssh, err := ssh.MarshalPrivateKey(key, "")
+		require.NoError(t, err)
+		encrypted, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte("secret"))
+		require.NoError(t, err)
+
+		cases := map[string][]byte{
+			EncodingPKCS8:   pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+			EncodingOpenSSH: pem.EncodeToMemory(openssh),
+		}
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			cases[EncodingPEM] = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)})
+		case *ecdsa.PrivateKey:
+			sec1, err := x509.MarshalECPrivateKey(k)
+			require.NoError(t, err)
+			cases[EncodingPEM] = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})
+		}
+
+		for encoding, data := range cases {
+			got, gotEncoding, err := DecodePrivateKey(data, nil)
+			require.NoError(t, err, algo, encoding)
+			assert.Equal(t, encoding, gotEncoding)
+			assert.Equal(t, algo, got.Format)
+		}
+
+		got, gotEncoding, err := DecodePrivateKey(pkcs8, nil)
+		require.NoError(t, err, algo)
+		assert.Equal(t, EncodingPKCS8, gotEncoding)
+		assert.Equal(t, algo, got.Format)
+
+		data := pem.EncodeToMemory(encrypted)
+		_, _, err = DecodePrivateKey(data, nil)
+		assert.ErrorIs(t, err, ErrPassphraseRequired)
+		_, _, err = DecodePrivateKey(data, []byte("wrong"))
+		assert.ErrorIs(t, err, ErrWrongPassphrase)
+		_, _, err = DecodePrivateKey(data, []byte("secret"))
+		assert.NoError(t, err)
+	}
+
+	_, _, err := DecodePrivateKey([]byte(keyRandom), nil)
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestDecodePrivateKeyPPK(t *testing.T) {
+	for algo, key := range generateTestKeys(t) {
+		for _, version := range []int{2, 3} {
+			for _, passphrase := range []string{"", "secret"} {
+				name := fmt.Sprintf("%s v%d %q", algo, version, passphrase)
+				data := encodeTestPPK(t, key, "me@work", []byte(passphrase), version)
+
+				got, encoding, err := DecodePrivateKey(data, []byte(passphrase))
+				require.NoError(t, err, name)
+				assert.Equal(t, EncodingPPK, encoding, name)
+				assert.Equal(t, algo, got.Format, name)
+				assert.Equal(t, "me@work", got.Comment, name)
+
+				if passphrase != "" {
+					_, _, err = DecodePrivateKey(data, nil)
+					assert.ErrorIs(t, err, ErrPassphraseRequired, name)
+					_, _, err = DecodePrivateKey(data, []byte("wrong"))
+					assert.ErrorIs(t, err, ErrWrongPassphrase, name)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodePrivateKeyPPKEd25519Seed(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed[:31] {
+		seed[i] = byte(i + 1)
+	}
+
+	for data, passphrase := range map[string]string{
+		ppkEd25519TrailingZero:   "",
+		ppkEd25519TrailingZeroV2: "secret",
+	} {
+		got, _, err := DecodePrivateKey([]byte(data), []byte(passphrase))
+		require.NoError(t, err)
+		assert.Equal(t, "ed25519-key-20231018", got.Comment)
+		k, ok := got.Private.(*ed25519.PrivateKey)
+		require.True(t, ok)
+		assert.Equal(t, seed, k.Seed())
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	blob, err := ppkPrivateBlob(ed25519.NewKeyFromSeed(seed))
+	require.NoError(t, err)
+	assert.Equal(t, ssh.Marshal(struct{ Seed []byte }{seed}), blob)
+	_, ok := ed25519FromPPK(make([]byte, ed25519.SeedSize+1), edKey.Public().(ed25519.PublicKey))
+	assert.False(t, ok)
+}
+
+func TestDecodePrivateKeyPPKCertificate(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(edKey)
+	require.NoError(t, err)
+	cert := &ssh.Certificate{Key: signer.PublicKey(), CertType: ssh.UserCert, ValidBefore: ssh.CertTimeInfinity}
+	require.NoError(t, cert.SignCert(rand.Reader, signer))
+
+	private := ssh.Marshal(struct{ Seed []byte }{edKey.Seed()})
+	data := writeTestPPK(t, cert.Type(), cert.Marshal(), private, "me@work", nil, 3)
+	_, _, err = DecodePrivateKey(data, nil)
+	assert.ErrorContains(t, err, "unsupported PuTTY key algorithm")
+}
+
+func TestImportKey(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	data := encodeTestPPK(t, edKey, "me@work", nil, 3)
+	key, err := ImportKey(store, "id_putty", "", data, nil)
+	require.NoError(t, err)
+
+	got, err := store.Get("id_putty")
+	require.NoError(t, err)
+	assert.Equal(t, "me@work", got.Comment)
+	assert.Equal(t, key.Public.Marshal(), got.Public.Marshal())
+}
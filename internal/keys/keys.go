@@ -34,6 +34,8 @@ func isPrivateKey(p []byte) (ssh.Signer, bool) {
 	return signer, true
 }
 
+// LoadPrivateKeys walks the root directory and returns all private keys found
+// in it.
 func LoadPrivateKeys(root string) ([]*models.Key, error) {
 	keys := make([]*models.Key, 0)
 	err := filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
@@ -53,35 +55,12 @@ func LoadPrivateKeys(root string) ([]*models.Key, error) {
 			return nil
 		}
 
-		privateBytes, err := os.ReadFile(path)
+		key, err := loadKey(root, path)
 		if err != nil {
-			return fmt.Errorf("read key file: %v", err)
+			return err
 		}
-
-		// Try to read the comment from public key file
-		var comment string
-		publicBytes, _ := os.ReadFile(path + ".pub")
-		if err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("read public key file: %v", err)
-		}
-		if len(publicBytes) > 0 {
-			_, comment, _, _, _ = ssh.ParseAuthorizedKey(publicBytes)
-		}
-
-		if signer, ok := isPrivateKey(privateBytes); ok {
-			if name, err := filepath.Rel(root, path); err == nil {
-				if privKey, err := ssh.ParseRawPrivateKey(privateBytes); err == nil {
-					key := &models.Key{
-						Name:    name,
-						Path:    path,
-						Format:  signer.PublicKey().Type(),
-						Comment: comment,
-						Private: privKey,
-						Public:  signer.PublicKey(),
-					}
-					keys = append(keys, key)
-				}
-			}
+		if key != nil {
+			keys = append(keys, key)
 		}
 		return nil
 	})
@@ -91,3 +70,56 @@ func LoadPrivateKeys(root string) ([]*models.Key, error) {
 
 	return keys, nil
 }
+
+// loadKey reads the private key file at path. It returns nil key without an
+// error when the file is not a private key.
+func loadKey(root, path string) (*models.Key, error) {
+	privateBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("stat key file: %v", err)
+	}
+
+	// Try to read the comment from public key file. Like a broken
+	// certificate below, an unreadable file doesn't hide the key.
+	var comment string
+	publicBytes, _ := os.ReadFile(path + ".pub")
+	if len(publicBytes) > 0 {
+		_, comment, _, _, _ = ssh.ParseAuthorizedKey(publicBytes)
+	}
+
+	var (
+		pub     ssh.PublicKey
+		privKey any
+		sk      *models.SecurityKey
+	)
+	if signer, ok := isPrivateKey(privateBytes); ok {
+		if privKey, err = ssh.ParseRawPrivateKey(privateBytes); err != nil {
+			return nil, nil
+		}
+		pub = signer.PublicKey()
+	} else if pub, sk, err = ParseSecurityKey(privateBytes); err != nil {
+		// Security keys are handles which ssh.ParsePrivateKey rejects.
+		return nil, nil
+	}
+	name, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil, nil
+	}
+	cert, _ := loadCertificate(path, pub)
+
+	return &models.Key{
+		Name:        name,
+		Path:        path,
+		Format:      pub.Type(),
+		Comment:     comment,
+		Private:     privKey,
+		Public:      pub,
+		Certificate: cert,
+		SecurityKey: sk,
+		Created:     info.ModTime(),
+	}, nil
+}
@@ -25,6 +25,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/mixanemca/ssh-keys/internal/models"
 	"github.com/stretchr/testify/assert"
@@ -166,6 +167,7 @@ func TestLoadPrivateKeys(t *testing.T) {
 		Private:       privKey,
 		Public:        pubKey,
 		LoadedToAgent: false,
+		Created:       modTime(t, filepath.Join(dir, "id_ecdsa")),
 	})
 
 	privKey, pubKey, err = parseRawPrivateKey(keyEd25519)
@@ -180,6 +182,7 @@ func TestLoadPrivateKeys(t *testing.T) {
 		Private:       privKey,
 		Public:        pubKey,
 		LoadedToAgent: false,
+		Created:       modTime(t, filepath.Join(dir, "id_ed25519")),
 	})
 	// {Name: "id_ed25519_with_passphrase"},
 
@@ -195,6 +198,7 @@ func TestLoadPrivateKeys(t *testing.T) {
 		Private:       privKey,
 		Public:        pubKey,
 		LoadedToAgent: false,
+		Created:       modTime(t, filepath.Join(dir, "id_rsa")),
 	})
 
 	cases := []struct {
@@ -218,6 +222,16 @@ func TestLoadPrivateKeys(t *testing.T) {
 	}
 }
 
+// modTime returns the modification time of the file.
+func modTime(t *testing.T, path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return info.ModTime()
+}
+
 func TestLoadPrivateKeysErr(t *testing.T) {
 	dir := prepareTestKeysDirNoReadable(t)
 	defer os.RemoveAll(dir)
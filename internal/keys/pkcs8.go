@@ -0,0 +1,192 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"hash"
+)
+
+// pbkdf2Iterations is the PBKDF2 iteration count for new encrypted keys.
+const pbkdf2Iterations = 600000
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// encryptedPrivateKeyInfo is defined in RFC 5958, section 3.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params is defined in RFC 8018, appendix A.4.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params is defined in RFC 8018, appendix A.2.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// encryptPKCS8 encrypts the PKCS#8 private key with PBES2 using
+// PBKDF2-HMAC-SHA256 and AES-256-CBC.
+func encryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %v", err)
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, fmt.Errorf("generate iv: %v", err)
+	}
+
+	key, err := pbkdf2.Key(sha256.New, string(passphrase), salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %v", err)
+	}
+	pad := aes.BlockSize - len(der)%aes.BlockSize
+	data := append(bytes.Clone(der), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: pbkdf2Iterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal PBKDF2 params: %v", err)
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, fmt.Errorf("marshal iv: %v", err)
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal PBES2 params: %v", err)
+	}
+
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: data,
+	})
+}
+
+// decryptPKCS8 decrypts the PBES2 encrypted PKCS#8 private key and parses it.
+func decryptPKCS8(der, passphrase []byte) (any, error) {
+	if len(passphrase) == 0 {
+		return nil, ErrPassphraseRequired
+	}
+
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("parse encrypted PKCS#8 key: %v", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported PKCS#8 encryption %v", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("parse PBES2 params: %v", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported PKCS#8 key derivation %v", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("parse PBKDF2 params: %v", err)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case kdf.PRF.Algorithm == nil, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 function %v", kdf.PRF.Algorithm)
+	}
+
+	var keyLen int
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLen = 16
+	case scheme.Equal(oidAES192CBC):
+		keyLen = 24
+	case scheme.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("unsupported PKCS#8 cipher %v", scheme)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid PKCS#8 cipher iv")
+	}
+
+	key, err := pbkdf2.Key(prf, string(passphrase), kdf.Salt, kdf.IterationCount, keyLen)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %v", err)
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid encrypted PKCS#8 data length")
+	}
+	data := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, info.EncryptedData)
+
+	pad := int(data[len(data)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(data[len(data)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, ErrWrongPassphrase
+	}
+	privKey, err := x509.ParsePKCS8PrivateKey(data[:len(data)-pad])
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return privKey, nil
+}
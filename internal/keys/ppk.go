@@ -0,0 +1,564 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+// ppkHeader is the prefix of PuTTY private key files.
+const ppkHeader = "PuTTY-User-Key-File-"
+
+// ppkMACKeyV2 is prepended to the passphrase to derive the version 2 MAC key.
+const ppkMACKeyV2 = "putty-private-key-file-mac-key"
+
+// Argon2id parameters used by PuTTYgen by default.
+const (
+	ppkArgon2Memory      = 8192
+	ppkArgon2Passes      = 13
+	ppkArgon2Parallelism = 1
+)
+
+// ppkFile holds the fields of a PuTTY private key file.
+type ppkFile struct {
+	version    int
+	algorithm  string
+	encryption string
+	comment    string
+	public     []byte
+	private    []byte
+	mac        []byte
+	kdf        string
+	memory     uint32
+	passes     uint32
+	threads    uint8
+	salt       []byte
+}
+
+// isPPK reports whether data looks like a PuTTY private key file.
+func isPPK(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte(ppkHeader))
+}
+
+// parsePPK parses PuTTY private key file of version 2 or 3 and returns the
+// private key and its comment.
+func parsePPK(data, passphrase []byte) (any, string, error) {
+	f, err := readPPK(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var (
+		cipherKey, iv, macKey []byte
+		newMAC                func() hash.Hash
+	)
+	switch f.version {
+	case 2:
+		newMAC = sha1.New
+		if f.encryption != "none" {
+			cipherKey = ppkV2CipherKey(passphrase)
+			iv = make([]byte, aes.BlockSize)
+		}
+		macKey = ppkV2MACKey(passphrase)
+	case 3:
+		newMAC = sha256.New
+		if f.encryption != "none" {
+			keys, err := ppkV3Keys(f, passphrase)
+			if err != nil {
+				return nil, "", err
+			}
+			cipherKey, iv, macKey = keys[:32], keys[32:48], keys[48:]
+		}
+	default:
+		return nil, "", fmt.Errorf("unsupported PuTTY key file version %d", f.version)
+	}
+
+	private := f.private
+	switch f.encryption {
+	case "none":
+	case "aes256-cbc":
+		if len(passphrase) == 0 {
+			return nil, "", ErrPassphraseRequired
+		}
+		if len(private)%aes.BlockSize != 0 {
+			return nil, "", fmt.Errorf("invalid PuTTY private key length")
+		}
+		block, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			return nil, "", fmt.Errorf("create cipher: %v", err)
+		}
+		private = make([]byte, len(f.private))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(private, f.private)
+	default:
+		return nil, "", fmt.Errorf("unsupported PuTTY key encryption %q", f.encryption)
+	}
+
+	mac := hmac.New(newMAC, macKey)
+	mac.Write(ppkMACData(f.algorithm, f.encryption, f.comment, f.public, private))
+	if !hmac.Equal(mac.Sum(nil), f.mac) {
+		if f.encryption != "none" {
+			return nil, "", ErrWrongPassphrase
+		}
+		return nil, "", fmt.Errorf("PuTTY key file MAC mismatch")
+	}
+
+	key, err := ppkPrivateKey(f.algorithm, f.public, private)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, f.comment, nil
+}
+
+// readPPK reads the headers and blobs of the PuTTY private key file.
+func readPPK(data []byte) (*ppkFile, error) {
+	f := &ppkFile{}
+	s := bufio.NewScanner(bytes.NewReader(data))
+
+	next := func() (string, string, error) {
+		for s.Scan() {
+			line := strings.TrimRight(s.Text(), "\r")
+			if line == "" {
+				continue
+			}
+			name, value, ok := strings.Cut(line, ": ")
+			if !ok {
+				return "", "", fmt.Errorf("invalid PuTTY key file line %q", line)
+			}
+			return name, value, nil
+		}
+		if err := s.Err(); err != nil {
+			return "", "", err
+		}
+		return "", "", fmt.Errorf("unexpected end of PuTTY key file")
+	}
+	lines := func(value string) ([]byte, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PuTTY key file lines count %q", value)
+		}
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			if !s.Scan() {
+				return nil, fmt.Errorf("unexpected end of PuTTY key file")
+			}
+			b.WriteString(strings.TrimSpace(s.Text()))
+		}
+		return base64.StdEncoding.DecodeString(b.String())
+	}
+
+	for {
+		name, value, err := next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case strings.HasPrefix(name, ppkHeader):
+			v, err := strconv.Atoi(strings.TrimPrefix(name, ppkHeader))
+			if err != nil {
+				return nil, fmt.Errorf("invalid PuTTY key file version %q", name)
+			}
+			f.version, f.algorithm = v, value
+		case name == "Encryption":
+			f.encryption = value
+		case name == "Comment":
+			f.comment = value
+		case name == "Public-Lines":
+			if f.public, err = lines(value); err != nil {
+				return nil, fmt.Errorf("decode PuTTY public key: %v", err)
+			}
+		case name == "Private-Lines":
+			if f.private, err = lines(value); err != nil {
+				return nil, fmt.Errorf("decode PuTTY private key: %v", err)
+			}
+		case name == "Key-Derivation":
+			f.kdf = value
+		case name == "Argon2-Memory":
+			n, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Argon2 memory %q", value)
+			}
+			f.memory = uint32(n)
+		case name == "Argon2-Passes":
+			n, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Argon2 passes %q", value)
+			}
+			f.passes = uint32(n)
+		case name == "Argon2-Parallelism":
+			n, err := strconv.ParseUint(value, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Argon2 parallelism %q", value)
+			}
+			f.threads = uint8(n)
+		case name == "Argon2-Salt":
+			if f.salt, err = hex.DecodeString(value); err != nil {
+				return nil, fmt.Errorf("invalid Argon2 salt %q", value)
+			}
+		case name == "Private-MAC":
+			if f.mac, err = hex.DecodeString(value); err != nil {
+				return nil, fmt.Errorf("invalid PuTTY key file MAC %q", value)
+			}
+			if f.version == 0 || f.public == nil || f.private == nil {
+				return nil, fmt.Errorf("incomplete PuTTY key file")
+			}
+			return f, nil
+		case name == "Private-Hash":
+			return nil, fmt.Errorf("unsupported PuTTY key file version 1")
+		}
+	}
+}
+
+// ppkV2CipherKey derives the AES key of PuTTY key file version 2.
+func ppkV2CipherKey(passphrase []byte) []byte {
+	var key []byte
+	for i := uint32(0); i < 2; i++ {
+		h := sha1.New()
+		_ = binary.Write(h, binary.BigEndian, i)
+		h.Write(passphrase)
+		key = h.Sum(key)
+	}
+
+	return key[:32]
+}
+
+// ppkV2MACKey derives the MAC key of PuTTY key file version 2.
+func ppkV2MACKey(passphrase []byte) []byte {
+	sum := sha1.Sum(append([]byte(ppkMACKeyV2), passphrase...))
+	return sum[:]
+}
+
+// ppkV3Keys derives the AES key, IV and MAC key of PuTTY key file version 3.
+func ppkV3Keys(f *ppkFile, passphrase []byte) ([]byte, error) {
+	const size = 32 + aes.BlockSize + 32
+	switch f.kdf {
+	case "Argon2id":
+		return argon2.IDKey(passphrase, f.salt, f.passes, f.memory, f.threads, size), nil
+	case "Argon2i":
+		return argon2.Key(passphrase, f.salt, f.passes, f.memory, f.threads, size), nil
+	default:
+		return nil, fmt.Errorf("unsupported PuTTY key derivation %q", f.kdf)
+	}
+}
+
+// encodePPK writes the private key in PuTTY format of version 2 or 3. The
+// key is encrypted when the passphrase is not empty.
+func encodePPK(key any, comment string, passphrase []byte, version int) ([]byte, error) {
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("create signer: %v", err)
+	}
+	private, err := ppkPrivateBlob(key)
+	if err != nil {
+		return nil, err
+	}
+	f := &ppkFile{
+		version:    version,
+		algorithm:  signer.PublicKey().Type(),
+		encryption: "none",
+		comment:    comment,
+		public:     signer.PublicKey().Marshal(),
+	}
+
+	var (
+		cipherKey, iv, macKey []byte
+		newMAC                func() hash.Hash
+		padding               []byte
+	)
+	switch version {
+	case 2:
+		newMAC = sha1.New
+		cipherKey, iv = ppkV2CipherKey(passphrase), make([]byte, aes.BlockSize)
+		macKey = ppkV2MACKey(passphrase)
+		// Version 2 pads the private blob with its SHA-1 hash.
+		sum := sha1.Sum(private)
+		padding = sum[:]
+	case 3:
+		newMAC = sha256.New
+		padding = make([]byte, aes.BlockSize)
+		if _, err := rand.Read(padding); err != nil {
+			return nil, fmt.Errorf("generate padding: %v", err)
+		}
+		if len(passphrase) > 0 {
+			f.kdf = "Argon2id"
+			f.memory = ppkArgon2Memory
+			f.passes = ppkArgon2Passes
+			f.threads = ppkArgon2Parallelism
+			f.salt = make([]byte, 16)
+			if _, err := rand.Read(f.salt); err != nil {
+				return nil, fmt.Errorf("generate salt: %v", err)
+			}
+			keys, err := ppkV3Keys(f, passphrase)
+			if err != nil {
+				return nil, err
+			}
+			cipherKey, iv, macKey = keys[:32], keys[32:48], keys[48:]
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PuTTY key file version %d", version)
+	}
+
+	if len(passphrase) > 0 {
+		f.encryption = "aes256-cbc"
+		if n := len(private) % aes.BlockSize; n != 0 {
+			private = append(private, padding[:aes.BlockSize-n]...)
+		}
+	}
+
+	mac := hmac.New(newMAC, macKey)
+	mac.Write(ppkMACData(f.algorithm, f.encryption, f.comment, f.public, private))
+	f.mac = mac.Sum(nil)
+
+	f.private = private
+	if len(passphrase) > 0 {
+		block, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			return nil, fmt.Errorf("create cipher: %v", err)
+		}
+		f.private = make([]byte, len(private))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(f.private, private)
+	}
+
+	return writePPK(f), nil
+}
+
+// writePPK formats the fields of the PuTTY private key file.
+func writePPK(f *ppkFile) []byte {
+	var b bytes.Buffer
+	lines := func(data []byte) {
+		s := base64.StdEncoding.EncodeToString(data)
+		var out []string
+		for len(s) > 64 {
+			out = append(out, s[:64])
+			s = s[64:]
+		}
+		out = append(out, s)
+		fmt.Fprintf(&b, "%d\n%s\n", len(out), strings.Join(out, "\n"))
+	}
+
+	fmt.Fprintf(&b, "%s%d: %s\n", ppkHeader, f.version, f.algorithm)
+	fmt.Fprintf(&b, "Encryption: %s\n", f.encryption)
+	fmt.Fprintf(&b, "Comment: %s\n", f.comment)
+	b.WriteString("Public-Lines: ")
+	lines(f.public)
+	if f.kdf != "" {
+		fmt.Fprintf(&b, "Key-Derivation: %s\n", f.kdf)
+		fmt.Fprintf(&b, "Argon2-Memory: %d\n", f.memory)
+		fmt.Fprintf(&b, "Argon2-Passes: %d\n", f.passes)
+		fmt.Fprintf(&b, "Argon2-Parallelism: %d\n", f.threads)
+		fmt.Fprintf(&b, "Argon2-Salt: %x\n", f.salt)
+	}
+	b.WriteString("Private-Lines: ")
+	lines(f.private)
+	fmt.Fprintf(&b, "Private-MAC: %x\n", f.mac)
+
+	return b.Bytes()
+}
+
+// ppkPrivateBlob returns the PuTTY private blob of the key.
+func ppkPrivateBlob(key any) ([]byte, error) {
+	switch k := NormalizePrivateKey(key).(type) {
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, fmt.Errorf("multi-prime RSA keys are not supported")
+		}
+		k.Precompute()
+		return ssh.Marshal(struct{ D, P, Q, Iqmp *big.Int }{k.D, k.Primes[0], k.Primes[1], k.Precomputed.Qinv}), nil
+	case *ecdsa.PrivateKey:
+		return ssh.Marshal(struct{ D *big.Int }{k.D}), nil
+	case ed25519.PrivateKey:
+		// PuTTY writes the full 32-byte seed.
+		return ssh.Marshal(struct{ Seed []byte }{k.Seed()}), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// ppkMACData returns the data authenticated by the PuTTY key file MAC.
+func ppkMACData(algorithm, encryption, comment string, public, private []byte) []byte {
+	var b []byte
+	for _, field := range [][]byte{[]byte(algorithm), []byte(encryption), []byte(comment), public, private} {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+		b = append(b, field...)
+	}
+
+	return b
+}
+
+// ppkPrivateKey builds the private key from the PuTTY public and private
+// blobs and checks they match each other.
+func ppkPrivateKey(algorithm string, public, private []byte) (any, error) {
+	pub, err := ssh.ParsePublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("parse PuTTY public key: %v", err)
+	}
+	if pub.Type() != algorithm {
+		return nil, fmt.Errorf("PuTTY key algorithm %q doesn't match public key %q", algorithm, pub.Type())
+	}
+	// Certificates have no crypto public key and are not PuTTY keys.
+	cp, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported PuTTY key algorithm %q", algorithm)
+	}
+	cryptoPub := cp.CryptoPublicKey()
+	r := &blobReader{data: private}
+
+	var key any
+	switch algorithm {
+	case ssh.KeyAlgoRSA:
+		rsaPub := cryptoPub.(*rsa.PublicKey)
+		d, p, q, iqmp := r.mpint(), r.mpint(), r.mpint(), r.mpint()
+		if r.err != nil {
+			return nil, fmt.Errorf("parse PuTTY RSA key: %v", r.err)
+		}
+		k := &rsa.PrivateKey{
+			PublicKey: *rsaPub,
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		if err := k.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid PuTTY RSA key: %v", err)
+		}
+		k.Precompute()
+		if k.Precomputed.Qinv.Cmp(iqmp) != 0 {
+			return nil, fmt.Errorf("invalid PuTTY RSA key: iqmp mismatch")
+		}
+		key = k
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521:
+		ecPub := cryptoPub.(*ecdsa.PublicKey)
+		d := r.mpint()
+		if r.err != nil {
+			return nil, fmt.Errorf("parse PuTTY ECDSA key: %v", r.err)
+		}
+		k := &ecdsa.PrivateKey{PublicKey: *ecPub, D: d}
+		if !ecdsaKeyMatches(k) {
+			return nil, fmt.Errorf("invalid PuTTY ECDSA key: public key mismatch")
+		}
+		key = k
+	case ssh.KeyAlgoED25519:
+		edPub := cryptoPub.(ed25519.PublicKey)
+		raw := r.string()
+		if r.err != nil {
+			return nil, fmt.Errorf("parse PuTTY Ed25519 key: %v", r.err)
+		}
+		k, ok := ed25519FromPPK(raw, edPub)
+		if !ok {
+			return nil, fmt.Errorf("invalid PuTTY Ed25519 key: public key mismatch")
+		}
+		key = &k
+	default:
+		return nil, fmt.Errorf("unsupported PuTTY key algorithm %q", algorithm)
+	}
+
+	return key, nil
+}
+
+// ed25519FromPPK restores the Ed25519 key from the PuTTY private blob. PuTTY
+// writes the 32-byte RFC 8032 seed, but the seed may also come as a
+// little-endian integer with the trailing zero bytes dropped, so shorter
+// values are padded with zeros.
+func ed25519FromPPK(raw []byte, pub ed25519.PublicKey) (ed25519.PrivateKey, bool) {
+	if len(raw) > ed25519.SeedSize {
+		return nil, false
+	}
+	seed := make([]byte, ed25519.SeedSize)
+	copy(seed, raw)
+
+	k := ed25519.NewKeyFromSeed(seed)
+	if !k.Public().(ed25519.PublicKey).Equal(pub) {
+		return nil, false
+	}
+
+	return k, true
+}
+
+// ecdsaKeyMatches reports whether the private scalar matches the public point.
+func ecdsaKeyMatches(k *ecdsa.PrivateKey) bool {
+	priv, err := k.ECDH()
+	if err != nil {
+		return false
+	}
+	pub, err := k.PublicKey.ECDH()
+	if err != nil {
+		return false
+	}
+
+	return priv.PublicKey().Equal(pub)
+}
+
+// blobReader reads SSH wire format values, keeping the first error.
+type blobReader struct {
+	data []byte
+	err  error
+}
+
+// string reads a length prefixed string.
+func (r *blobReader) string() []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < 4 {
+		r.err = errors.New("short data")
+		return nil
+	}
+	n := binary.BigEndian.Uint32(r.data)
+	if uint64(len(r.data)-4) < uint64(n) {
+		r.err = errors.New("short data")
+		return nil
+	}
+	s := r.data[4 : 4+n]
+	r.data = r.data[4+n:]
+
+	return s
+}
+
+// mpint reads a multiple precision integer.
+func (r *blobReader) mpint() *big.Int {
+	b := r.string()
+	if r.err != nil {
+		return nil
+	}
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		r.err = errors.New("negative mpint")
+		return nil
+	}
+
+	return new(big.Int).SetBytes(b)
+}
@@ -0,0 +1,215 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// The types of FIDO security keys.
+const (
+	KeyAlgoSKED25519 = "sk-ssh-ed25519@openssh.com"
+	KeyAlgoSKECDSA   = "sk-ecdsa-sha2-nistp256@openssh.com"
+)
+
+// ErrSecurityKey is returned when an operation needs the private key, which
+// a security key never reveals.
+var ErrSecurityKey = errors.New("private key is kept on the security key")
+
+// opensshMagic starts the OpenSSH private key format.
+const opensshMagic = "openssh-key-v1\x00"
+
+// opensshKey is the OpenSSH private key format, see PROTOCOL.key of
+// OpenSSH.
+type opensshKey struct {
+	CipherName   string
+	KdfName      string
+	KdfOpts      string
+	NumKeys      uint32
+	PubKey       []byte
+	PrivKeyBlock []byte
+}
+
+// opensshPrivate is the unencrypted private section with one key.
+type opensshPrivate struct {
+	Check1  uint32
+	Check2  uint32
+	Keytype string
+	Rest    []byte `ssh:"rest"`
+}
+
+// skEd25519Private is the private part of sk-ssh-ed25519 key.
+type skEd25519Private struct {
+	Pub         []byte
+	Application string
+	Flags       uint8
+	KeyHandle   []byte
+	Reserved    []byte
+	Rest        []byte `ssh:"rest"`
+}
+
+// skECDSAPrivate is the private part of sk-ecdsa-sha2-nistp256 key.
+type skECDSAPrivate struct {
+	Curve       string
+	Q           []byte
+	Application string
+	Flags       uint8
+	KeyHandle   []byte
+	Reserved    []byte
+	Rest        []byte `ssh:"rest"`
+}
+
+// IsSecurityKeyType reports whether the key type is a FIDO security key.
+func IsSecurityKeyType(keyType string) bool {
+	return keyType == KeyAlgoSKED25519 || keyType == KeyAlgoSKECDSA
+}
+
+// ParseSecurityKey parses the OpenSSH private key file of a FIDO security
+// key, which ssh.ParsePrivateKey does not support. The flags and the key
+// handle of encrypted files are left empty.
+func ParseSecurityKey(data []byte) (ssh.PublicKey, *models.SecurityKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+		return nil, nil, fmt.Errorf("not an OpenSSH private key")
+	}
+	rest, ok := bytes.CutPrefix(block.Bytes, []byte(opensshMagic))
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid OpenSSH private key magic")
+	}
+	var w opensshKey
+	if err := ssh.Unmarshal(rest, &w); err != nil {
+		return nil, nil, fmt.Errorf("parse OpenSSH private key: %v", err)
+	}
+	if w.NumKeys != 1 {
+		return nil, nil, fmt.Errorf("unsupported number of keys %d", w.NumKeys)
+	}
+	pub, err := ssh.ParsePublicKey(w.PubKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse public key: %v", err)
+	}
+	if !IsSecurityKeyType(pub.Type()) {
+		return nil, nil, fmt.Errorf("%s is not a security key", pub.Type())
+	}
+
+	sk := &models.SecurityKey{Application: skApplication(w.PubKey), Encrypted: w.CipherName != "none"}
+	if sk.Encrypted {
+		return pub, sk, nil
+	}
+
+	var priv opensshPrivate
+	if err := ssh.Unmarshal(w.PrivKeyBlock, &priv); err != nil {
+		return nil, nil, fmt.Errorf("parse private section: %v", err)
+	}
+	if priv.Check1 != priv.Check2 {
+		return nil, nil, fmt.Errorf("private section check failed")
+	}
+	switch priv.Keytype {
+	case KeyAlgoSKED25519:
+		var k skEd25519Private
+		if err := ssh.Unmarshal(priv.Rest, &k); err != nil {
+			return nil, nil, fmt.Errorf("parse %s: %v", priv.Keytype, err)
+		}
+		sk.Flags, sk.KeyHandle = k.Flags, k.KeyHandle
+	case KeyAlgoSKECDSA:
+		var k skECDSAPrivate
+		if err := ssh.Unmarshal(priv.Rest, &k); err != nil {
+			return nil, nil, fmt.Errorf("parse %s: %v", priv.Keytype, err)
+		}
+		sk.Flags, sk.KeyHandle = k.Flags, k.KeyHandle
+	default:
+		return nil, nil, fmt.Errorf("private key type %s does not match public key type %s", priv.Keytype, pub.Type())
+	}
+
+	return pub, sk, nil
+}
+
+// NewSigner returns the signer of the private key. Security keys can not
+// sign without the token, ErrSecurityKey is returned for them.
+func NewSigner(key *models.Key) (ssh.Signer, error) {
+	if key.SecurityKey != nil {
+		return nil, fmt.Errorf("%s: %w", key.Name, ErrSecurityKey)
+	}
+	signer, err := ssh.NewSignerFromKey(key.Private)
+	if err != nil {
+		return nil, fmt.Errorf("create signer: %v", err)
+	}
+
+	return signer, nil
+}
+
+// DescribeSecurityKey returns human readable lines about the security key.
+func DescribeSecurityKey(sk *models.SecurityKey) []string {
+	lines := []string{"Application: " + sk.Application}
+	if sk.Encrypted {
+		return append(lines, "Flags: unknown, the key handle is encrypted")
+	}
+
+	return append(lines,
+		"User presence: "+required(sk.UserPresenceRequired()),
+		"User verification: "+required(sk.UserVerificationRequired()),
+		"Resident: "+yesNo(sk.Resident()),
+		fmt.Sprintf("Key handle: %d bytes", len(sk.KeyHandle)),
+	)
+}
+
+// skApplication returns the application of the security public key blob,
+// which ssh.PublicKey does not expose.
+func skApplication(blob []byte) string {
+	var ed struct {
+		Type        string
+		Key         []byte
+		Application string
+	}
+	if ssh.Unmarshal(blob, &ed) == nil && ed.Type == KeyAlgoSKED25519 {
+		return ed.Application
+	}
+	var ec struct {
+		Type        string
+		Curve       string
+		Q           []byte
+		Application string
+	}
+	if ssh.Unmarshal(blob, &ec) == nil && ec.Type == KeyAlgoSKECDSA {
+		return ec.Application
+	}
+
+	return ""
+}
+
+// required describes whether a check is required.
+func required(ok bool) string {
+	if ok {
+		return "required"
+	}
+
+	return "not required"
+}
+
+// yesNo describes the boolean as yes or no.
+func yesNo(ok bool) string {
+	if ok {
+		return "yes"
+	}
+
+	return "no"
+}
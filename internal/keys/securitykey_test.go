@@ -0,0 +1,111 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// marshalSecurityKey creates the OpenSSH private key file of a
+// sk-ssh-ed25519 key handle, like ssh-keygen -t ed25519-sk does.
+func marshalSecurityKey(t *testing.T, cipher string, flags uint8) ([]byte, ssh.PublicKey) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pubBlob := ssh.Marshal(struct {
+		Type        string
+		Key         []byte
+		Application string
+	}{KeyAlgoSKED25519, pub, "ssh:"})
+	sshPub, err := ssh.ParsePublicKey(pubBlob)
+	require.NoError(t, err)
+
+	private := ssh.Marshal(struct {
+		Check1, Check2 uint32
+		Keytype        string
+		Pub            []byte
+		Application    string
+		Flags          uint8
+		KeyHandle      []byte
+		Reserved       []byte
+		Comment        string
+	}{42, 42, KeyAlgoSKED25519, pub, "ssh:", flags, []byte("handle"), nil, "me@token"})
+	for i := byte(1); len(private)%8 != 0; i++ {
+		private = append(private, i)
+	}
+	data := ssh.Marshal(opensshKey{
+		CipherName:   cipher,
+		KdfName:      "none",
+		NumKeys:      1,
+		PubKey:       pubBlob,
+		PrivKeyBlock: private,
+	})
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "OPENSSH PRIVATE KEY",
+		Bytes: append([]byte(opensshMagic), data...),
+	}), sshPub
+}
+
+func TestParseSecurityKey(t *testing.T) {
+	data, pub := marshalSecurityKey(t, "none", models.SKUserPresenceRequired|models.SKResident)
+	got, sk, err := ParseSecurityKey(data)
+	require.NoError(t, err)
+	assert.Equal(t, pub.Marshal(), got.Marshal())
+	assert.Equal(t, "ssh:", sk.Application)
+	assert.True(t, sk.UserPresenceRequired())
+	assert.False(t, sk.UserVerificationRequired())
+	assert.True(t, sk.Resident())
+	assert.Equal(t, []byte("handle"), sk.KeyHandle)
+	assert.Contains(t, DescribeSecurityKey(sk), "User verification: not required")
+
+	// Flags of encrypted handles are unknown.
+	data, _ = marshalSecurityKey(t, "aes256-ctr", models.SKUserVerificationRequired)
+	_, sk, err = ParseSecurityKey(data)
+	require.NoError(t, err)
+	assert.True(t, sk.Encrypted)
+	assert.False(t, sk.UserVerificationRequired())
+
+	_, _, err = ParseSecurityKey([]byte(keyEd25519))
+	assert.Error(t, err)
+}
+
+func TestLoadSecurityKey(t *testing.T) {
+	dir := t.TempDir()
+	data, pub := marshalSecurityKey(t, "none", models.SKUserPresenceRequired)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "id_ed25519_sk"), data, 0600))
+
+	store := NewFSStore(dir)
+	key, err := store.Get("id_ed25519_sk")
+	require.NoError(t, err)
+	assert.Equal(t, KeyAlgoSKED25519, key.Format)
+	assert.Equal(t, pub.Marshal(), key.Public.Marshal())
+	assert.Nil(t, key.Private)
+	require.NotNil(t, key.SecurityKey)
+
+	_, err = NewSigner(key)
+	assert.ErrorIs(t, err, ErrSecurityKey)
+}
@@ -0,0 +1,236 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"crypto/ed25519"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrKeyNotFound is returned when the key is absent in the store.
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrKeyExists is returned when the key name is already taken.
+	ErrKeyExists = errors.New("key already exists")
+	// ErrInvalidName is returned when the key name is not acceptable by the store.
+	ErrInvalidName = errors.New("invalid key name")
+)
+
+// KeyStore is a storage backend of SSH keys. Keys are addressed by name,
+// which is unique within the store.
+type KeyStore interface {
+	// List returns all keys kept in the store.
+	List() ([]*models.Key, error)
+	// Get returns the key by name.
+	Get(name string) (*models.Key, error)
+	// Create saves a new key. The Name, Private and Comment fields are used,
+	// as well as Created if the store keeps the creation time.
+	Create(key *models.Key) error
+	// Delete removes the key by name.
+	Delete(name string) error
+	// Rename changes the name of the key.
+	Rename(oldName, newName string) error
+}
+
+// FSStore keeps keys as OpenSSH private key files with the .pub companions
+// in a directory, like ~/.ssh.
+type FSStore struct {
+	root string
+}
+
+// Ensure that FSStore fulfils the KeyStore interface at compile time.
+var _ KeyStore = (*FSStore)(nil)
+
+// NewFSStore creates a new store for the keys directory.
+func NewFSStore(root string) *FSStore {
+	return &FSStore{root: root}
+}
+
+// Root returns the keys directory.
+func (s *FSStore) Root() string {
+	return s.root
+}
+
+// List implements KeyStore interface
+func (s *FSStore) List() ([]*models.Key, error) {
+	return LoadPrivateKeys(s.root)
+}
+
+// Get implements KeyStore interface
+func (s *FSStore) Get(name string) (*models.Key, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %w", name, ErrKeyNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stat key file: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s: %w", name, ErrKeyNotFound)
+	}
+
+	key, err := loadKey(s.root, path)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%s: %w", name, ErrKeyNotFound)
+	}
+
+	return key, nil
+}
+
+// Create implements KeyStore interface
+func (s *FSStore) Create(key *models.Key) error {
+	path, err := s.path(key.Name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%s: %w", key.Name, ErrKeyExists)
+	}
+
+	block, err := ssh.MarshalPrivateKey(NormalizePrivateKey(key.Private), key.Comment)
+	if err != nil {
+		return fmt.Errorf("marshal private key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key.Private)
+	if err != nil {
+		return fmt.Errorf("create signer: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("create keys dir: %v", err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return fmt.Errorf("write key file: %v", err)
+	}
+	if err := os.WriteFile(path+".pub", MarshalPublicKey(signer.PublicKey(), key.Comment), 0644); err != nil {
+		return fmt.Errorf("write public key file: %v", err)
+	}
+	// Keys moved from other stores keep their age.
+	if !key.Created.IsZero() {
+		if err := os.Chtimes(path, key.Created, key.Created); err != nil {
+			return fmt.Errorf("set key file time: %v", err)
+		}
+	}
+
+	key.Path = path
+	key.Format = signer.PublicKey().Type()
+	key.Public = signer.PublicKey()
+
+	return nil
+}
+
+// Delete implements KeyStore interface
+func (s *FSStore) Delete(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s: %w", name, ErrKeyNotFound)
+		}
+		return fmt.Errorf("remove key file: %v", err)
+	}
+	if err := os.Remove(path + ".pub"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove public key file: %v", err)
+	}
+	if err := os.Remove(path + CertSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove certificate file: %v", err)
+	}
+
+	return nil
+}
+
+// Rename implements KeyStore interface
+func (s *FSStore) Rename(oldName, newName string) error {
+	oldPath, err := s.path(oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := s.path(newName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(oldPath); os.IsNotExist(err) {
+		return fmt.Errorf("%s: %w", oldName, ErrKeyNotFound)
+	}
+	if _, err := os.Lstat(newPath); err == nil {
+		return fmt.Errorf("%s: %w", newName, ErrKeyExists)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newPath), 0700); err != nil {
+		return fmt.Errorf("create keys dir: %v", err)
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("rename key file: %v", err)
+	}
+	if err := os.Rename(oldPath+".pub", newPath+".pub"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("rename public key file: %v", err)
+	}
+	if err := os.Rename(oldPath+CertSuffix, newPath+CertSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("rename certificate file: %v", err)
+	}
+
+	return nil
+}
+
+// path returns the file path of the key, ensuring it stays inside the root.
+func (s *FSStore) path(name string) (string, error) {
+	clean := filepath.Clean(name)
+	if name == "" || filepath.IsAbs(clean) || clean == "." || clean == ".." ||
+		strings.HasPrefix(clean, ".."+string(filepath.Separator)) || strings.HasSuffix(clean, ".pub") {
+		return "", fmt.Errorf("%q: %w", name, ErrInvalidName)
+	}
+
+	return filepath.Join(s.root, clean), nil
+}
+
+// MarshalPublicKey serializes the public key in authorized_keys format with
+// an optional comment.
+func MarshalPublicKey(pub ssh.PublicKey, comment string) []byte {
+	line := ssh.MarshalAuthorizedKey(pub)
+	if comment == "" {
+		return line
+	}
+
+	return append(line[:len(line)-1], []byte(" "+comment+"\n")...)
+}
+
+// NormalizePrivateKey converts a key returned by ssh.ParseRawPrivateKey to
+// the form accepted by ssh.MarshalPrivateKey.
+func NormalizePrivateKey(key any) any {
+	if k, ok := key.(*ed25519.PrivateKey); ok {
+		return *k
+	}
+
+	return key
+}
@@ -0,0 +1,78 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestFSStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFSStore(dir)
+
+	privKey, err := ssh.ParseRawPrivateKey([]byte(keyEd25519))
+	require.NoError(t, err)
+
+	key := &models.Key{Name: "id_work", Private: privKey, Comment: "me@work"}
+	require.NoError(t, store.Create(key))
+	assert.Equal(t, filepath.Join(dir, "id_work"), key.Path)
+	assert.Equal(t, ssh.KeyAlgoED25519, key.Format)
+	assert.ErrorIs(t, store.Create(key), ErrKeyExists)
+
+	got, err := store.Get("id_work")
+	require.NoError(t, err)
+	assert.Equal(t, "me@work", got.Comment)
+	assert.Equal(t, key.Public.Marshal(), got.Public.Marshal())
+
+	list, err := store.List()
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	require.NoError(t, store.Rename("id_work", "id_home"))
+	_, err = store.Get("id_work")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.FileExists(t, filepath.Join(dir, "id_home.pub"))
+
+	require.NoError(t, store.Delete("id_home"))
+	assert.NoFileExists(t, filepath.Join(dir, "id_home"))
+	assert.NoFileExists(t, filepath.Join(dir, "id_home.pub"))
+	assert.ErrorIs(t, store.Delete("id_home"), ErrKeyNotFound)
+}
+
+func TestFSStoreInvalidName(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+
+	for _, name := range []string{"", ".", "..", "../id_rsa", "/etc/passwd", "id_rsa.pub"} {
+		_, err := store.Get(name)
+		assert.ErrorIs(t, err, ErrInvalidName, name)
+	}
+}
+
+func TestFSStoreGetNotKey(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config"), []byte("Host *"), 0600))
+
+	_, err := NewFSStore(dir).Get("config")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
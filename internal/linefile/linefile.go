@@ -0,0 +1,171 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package linefile keeps the lines of OpenSSH files with one entry per line,
+// like authorized_keys or known_hosts, so the files are edited without losing
+// comments and formatting.
+package linefile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Line is a line of the file.
+type Line[E comparable] struct {
+	// Raw is the line as read, it is written back untouched.
+	Raw string
+	// Entry is parsed from the line, zero for comments, blank and broken
+	// lines.
+	Entry E
+	// Err is the parse error of a broken line.
+	Err error
+}
+
+// Lines are the lines of a file with the entries parsed from them.
+type Lines[E comparable] struct {
+	lines []Line[E]
+	// number sets the line number of the entry, starting from 1.
+	number func(e E, n int)
+}
+
+// Read reads the lines of the file. The parse function returns the entry of
+// the line, zero for the lines without entries, or an error for the broken
+// ones. A missing or empty file has no lines.
+func Read[E comparable](path string, parse func(raw string) (E, error), number func(e E, n int)) (*Lines[E], error) {
+	l := &Lines[E]{number: number}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return l, nil
+	}
+
+	for _, raw := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		e, err := parse(raw)
+		l.lines = append(l.lines, Line[E]{Raw: raw, Entry: e, Err: err})
+	}
+	l.renumber()
+
+	return l, nil
+}
+
+// All returns all lines of the file.
+func (l *Lines[E]) All() []Line[E] {
+	return l.lines
+}
+
+// Entries returns the entries of the file.
+func (l *Lines[E]) Entries() []E {
+	var (
+		entries []E
+		zero    E
+	)
+	for _, line := range l.lines {
+		if line.Entry != zero {
+			entries = append(entries, line.Entry)
+		}
+	}
+
+	return entries
+}
+
+// Append adds the line of the entry to the end of the file.
+func (l *Lines[E]) Append(raw string, e E) {
+	l.lines = append(l.lines, Line[E]{Raw: raw, Entry: e})
+	l.number(e, len(l.lines))
+}
+
+// Remove deletes the lines of the entries matching the predicate and returns
+// the number of removed entries. The following entries are renumbered.
+func (l *Lines[E]) Remove(match func(e E) bool) int {
+	var (
+		kept    []Line[E]
+		removed int
+		zero    E
+	)
+	for _, line := range l.lines {
+		if line.Entry != zero && match(line.Entry) {
+			removed++
+			continue
+		}
+		kept = append(kept, line)
+	}
+	l.lines = kept
+	l.renumber()
+
+	return removed
+}
+
+// Save writes the lines to a temporary file and replaces the file with it,
+// so a failed write keeps the old content. The file keeps its permissions,
+// a new one is created with 0600 permissions and the directory with 0700
+// permissions if needed.
+func (l *Lines[E]) Save(path string) error {
+	var b strings.Builder
+	for _, line := range l.lines {
+		b.WriteString(line.Raw)
+		b.WriteByte('\n')
+	}
+
+	// A symlinked file is replaced at its target.
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("create dir: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// renumber updates the line numbers of the entries.
+func (l *Lines[E]) renumber() {
+	var zero E
+	for i, line := range l.lines {
+		if line.Entry != zero {
+			l.number(line.Entry, i+1)
+		}
+	}
+}
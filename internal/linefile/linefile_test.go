@@ -0,0 +1,96 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linefile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// entry is a numbered line of the test file.
+type entry struct {
+	line  int
+	value int
+}
+
+// parseEntry parses the lines with numbers, the other lines are broken.
+func parseEntry(raw string) (*entry, error) {
+	if raw == "" || strings.HasPrefix(raw, "#") {
+		return nil, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, errors.New("not a number")
+	}
+
+	return &entry{value: v}, nil
+}
+
+func readTestFile(t *testing.T, path string) *Lines[*entry] {
+	l, err := Read(path, parseEntry, func(e *entry, n int) { e.line = n })
+	require.NoError(t, err)
+
+	return l
+}
+
+func TestLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	assert.Empty(t, readTestFile(t, path).All())
+
+	// The first line of an empty file is the appended one.
+	require.NoError(t, os.WriteFile(path, nil, 0640))
+	l := readTestFile(t, path)
+	assert.Empty(t, l.All())
+	l.Append("1", &entry{value: 1})
+	require.NoError(t, l.Save(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", string(data))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	require.NoError(t, os.WriteFile(path, []byte("# numbers\r\n1\nx\n\n2\n"), 0644))
+	l = readTestFile(t, path)
+	require.Len(t, l.All(), 5)
+	assert.Equal(t, "# numbers", l.All()[0].Raw)
+	assert.EqualError(t, l.All()[2].Err, "not a number")
+	entries := l.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, []int{2, 5}, []int{entries[0].line, entries[1].line})
+
+	assert.Equal(t, 1, l.Remove(func(e *entry) bool { return e.value == 1 }))
+	assert.Equal(t, 4, entries[1].line)
+	l.Append("3", &entry{value: 3})
+	assert.Equal(t, 5, l.Entries()[1].line)
+
+	saved := filepath.Join(t.TempDir(), "dir", "file")
+	require.NoError(t, l.Save(saved))
+	data, err = os.ReadFile(saved)
+	require.NoError(t, err)
+	assert.Equal(t, "# numbers\nx\n\n2\n3\n", string(data))
+	info, err = os.Stat(saved)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
@@ -0,0 +1,170 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metadata keeps the team metadata of keys, like tags and owner, in
+// a JSON file. The metadata is keyed by the key fingerprint, so it survives
+// renames and moves of the key files.
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// DateLayout is the layout of expiry dates.
+const DateLayout = "2006-01-02"
+
+// file is the format of the metadata file.
+type file struct {
+	Keys map[string]models.Metadata `json:"keys"`
+}
+
+// Store is the metadata file.
+type Store struct {
+	path string
+	keys map[string]models.Metadata
+}
+
+// Load reads the metadata file. A missing file is treated as empty.
+func Load(path string) (*Store, error) {
+	s := &Store{path: path, keys: map[string]models.Metadata{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read metadata: %v", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse metadata: %v", err)
+	}
+	for fp, md := range f.Keys {
+		s.keys[fp] = md
+	}
+
+	return s, nil
+}
+
+// Path returns the file path.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Get returns the metadata of the key with the fingerprint.
+func (s *Store) Get(fingerprint string) models.Metadata {
+	return s.keys[fingerprint]
+}
+
+// Set replaces the metadata of the key with the fingerprint. Empty metadata
+// removes the key from the file.
+func (s *Store) Set(fingerprint string, md models.Metadata) {
+	if md.IsZero() {
+		delete(s.keys, fingerprint)
+		return
+	}
+	s.keys[fingerprint] = md
+}
+
+// Apply fills the Metadata field of the keys and overrides their creation
+// time when the metadata has one.
+func (s *Store) Apply(keys []*models.Key) {
+	for _, k := range keys {
+		k.Metadata = s.Get(ssh.FingerprintSHA256(k.Public))
+		if !k.Metadata.Created.IsZero() {
+			k.Created = k.Metadata.Created
+		}
+	}
+}
+
+// Save writes the file with 0600 permissions.
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(file{Keys: s.keys}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal metadata: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("create metadata dir: %v", err)
+	}
+	if err := os.WriteFile(s.path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("write metadata: %v", err)
+	}
+
+	return nil
+}
+
+// ParseTags parses the comma separated tags, dropping empty and repeated
+// ones.
+func ParseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// ParseDate parses the YYYY-MM-DD expiry date in local time zone. An empty
+// string is the zero time, which means no expiry.
+func ParseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(DateLayout, s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, want YYYY-MM-DD", s)
+	}
+
+	return t, nil
+}
+
+// Describe returns the human readable lines of the metadata fields which
+// are set.
+func Describe(md models.Metadata) []string {
+	var lines []string
+	if len(md.Tags) > 0 {
+		lines = append(lines, "Tags: "+strings.Join(md.Tags, ", "))
+	}
+	if md.Owner != "" {
+		lines = append(lines, "Owner: "+md.Owner)
+	}
+	if md.Purpose != "" {
+		lines = append(lines, "Purpose: "+md.Purpose)
+	}
+	if md.Notes != "" {
+		lines = append(lines, "Notes: "+md.Notes)
+	}
+	if !md.Expires.IsZero() {
+		lines = append(lines, "Expires: "+md.Expires.Format(DateLayout))
+	}
+	if !md.Created.IsZero() {
+		lines = append(lines, "Created: "+md.Created.Format(DateLayout))
+	}
+
+	return lines
+}
@@ -0,0 +1,70 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.json")
+	s, err := Load(path)
+	require.NoError(t, err)
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	fp := ssh.FingerprintSHA256(sshPub)
+
+	expires, err := ParseDate("2027-01-31")
+	require.NoError(t, err)
+	md := models.Metadata{
+		Tags:    ParseTags(" prod, ci,,prod"),
+		Owner:   "platform",
+		Purpose: "deploy",
+		Expires: expires,
+	}
+	assert.Equal(t, []string{"prod", "ci"}, md.Tags)
+	s.Set(fp, md)
+	require.NoError(t, s.Save())
+
+	s, err = Load(path)
+	require.NoError(t, err)
+	keys := []*models.Key{{Name: "renamed", Public: sshPub}}
+	s.Apply(keys)
+	assert.Equal(t, "platform", keys[0].Metadata.Owner)
+	assert.True(t, keys[0].Metadata.HasTag("ci"))
+	assert.True(t, keys[0].Metadata.Expires.Equal(expires))
+	assert.True(t, keys[0].Metadata.Expired(expires))
+	assert.False(t, keys[0].Metadata.Expired(expires.Add(-time.Second)))
+
+	s.Set(fp, models.Metadata{})
+	assert.True(t, s.Get(fp).IsZero())
+
+	_, err = ParseDate("31.01.2027")
+	assert.Error(t, err)
+}
@@ -18,19 +18,41 @@ package models
 
 import (
 	"fmt"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
 // Key represents a SSH key with additional info like a path.
 type Key struct {
-	Name          string
-	Path          string
-	Format        string
-	Comment       string
-	Private       any
-	Public        ssh.PublicKey
+	Name    string
+	Path    string
+	Format  string
+	Comment string
+	// Private is the private key, nil for security keys.
+	Private     any
+	Public      ssh.PublicKey
+	Certificate *ssh.Certificate
+	// SecurityKey is the handle of a FIDO security key, nil for other keys.
+	SecurityKey   *SecurityKey
+	Metadata      Metadata
 	LoadedToAgent bool
+	// Created is the creation time of the key, the modification time of
+	// the key file unless the metadata tells otherwise. Zero if unknown.
+	Created time.Time
+	// LastUsed is the time of the latest use of the key recorded in the
+	// usage log. Zero if unknown.
+	LastUsed time.Time
+}
+
+// Age returns the time passed since the key was created, or zero if the
+// creation time is unknown.
+func (k *Key) Age(now time.Time) time.Duration {
+	if k.Created.IsZero() {
+		return 0
+	}
+
+	return now.Sub(k.Created)
 }
 
 // String implements fmt.Stringer interface
@@ -0,0 +1,55 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Metadata is the team information about a key, which is kept apart from
+// the key files.
+type Metadata struct {
+	// Tags are free form labels like prod or ci.
+	Tags []string `json:"tags,omitempty"`
+	// Owner is the person or team responsible for the key.
+	Owner string `json:"owner,omitempty"`
+	// Purpose tells what the key is used for.
+	Purpose string `json:"purpose,omitempty"`
+	// Notes are free form notes.
+	Notes string `json:"notes,omitempty"`
+	// Expires is the date the key is intended to be replaced at.
+	Expires time.Time `json:"expires,omitzero"`
+	// Created overrides the creation time of the key, e.g. when the key
+	// file was copied and lost its modification time.
+	Created time.Time `json:"created,omitzero"`
+}
+
+// IsZero reports whether no metadata is set.
+func (m Metadata) IsZero() bool {
+	return len(m.Tags) == 0 && m.Owner == "" && m.Purpose == "" && m.Notes == "" && m.Expires.IsZero() && m.Created.IsZero()
+}
+
+// HasTag reports whether the metadata has the tag.
+func (m Metadata) HasTag(tag string) bool {
+	return slices.Contains(m.Tags, tag)
+}
+
+// Expired reports whether the intended expiry date is before now.
+func (m Metadata) Expired(now time.Time) bool {
+	return !m.Expires.IsZero() && !now.Before(m.Expires)
+}
@@ -0,0 +1,56 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+// The flags of FIDO security keys, as defined by OpenSSH.
+const (
+	SKUserPresenceRequired     = 0x01
+	SKUserVerificationRequired = 0x04
+	SKResident                 = 0x20
+)
+
+// SecurityKey is the handle of a key kept on a FIDO security key, like
+// sk-ssh-ed25519@openssh.com. The private key never leaves the token, the
+// file only has the handle to ask the token to sign.
+type SecurityKey struct {
+	// Application is the FIDO application string, usually "ssh:".
+	Application string
+	// Flags are the SK* flags. They are unknown when the handle is
+	// encrypted with a passphrase.
+	Flags byte
+	// KeyHandle is the token specific handle of the key.
+	KeyHandle []byte
+	// Encrypted reports whether the handle is encrypted with a passphrase.
+	Encrypted bool
+}
+
+// UserPresenceRequired reports whether the token must be touched to sign.
+func (k *SecurityKey) UserPresenceRequired() bool {
+	return k.Flags&SKUserPresenceRequired != 0
+}
+
+// UserVerificationRequired reports whether a PIN or biometrics is checked
+// to sign, the verify-required option of ssh-keygen(1).
+func (k *SecurityKey) UserVerificationRequired() bool {
+	return k.Flags&SKUserVerificationRequired != 0
+}
+
+// Resident reports whether the key is stored on the token, so the handle
+// can be downloaded with ssh-keygen -K.
+func (k *SecurityKey) Resident() bool {
+	return k.Flags&SKResident != 0
+}
@@ -0,0 +1,107 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remote
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"golang.org/x/crypto/ssh"
+)
+
+// copyIDScript appends the key line $2 to authorized_keys unless the key
+// blob $1 is already there, and fixes the permissions like ssh-copy-id(1).
+const copyIDScript = `set -e
+cd
+umask 077
+mkdir -p .ssh
+chmod 700 .ssh
+touch .ssh/authorized_keys
+chmod 600 .ssh/authorized_keys
+if grep -qF "$1" .ssh/authorized_keys; then
+	echo present
+	exit 0
+fi
+if [ -s .ssh/authorized_keys ] && [ -n "$(tail -c 1 .ssh/authorized_keys)" ]; then
+	echo >> .ssh/authorized_keys
+fi
+printf '%s\n' "$2" >> .ssh/authorized_keys
+echo added
+`
+
+// CopyID adds the public key to the remote authorized_keys file. It reports
+// whether the key was added, false means the key is already authorized.
+func CopyID(client *ssh.Client, pub ssh.PublicKey, comment string) (bool, error) {
+	blob := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	line := strings.TrimSpace(string(keys.MarshalPublicKey(pub, comment)))
+
+	out, err := Run(client, copyIDScript, blob, line)
+	if err != nil {
+		return false, err
+	}
+	switch strings.TrimSpace(out) {
+	case "added":
+		return true, nil
+	case "present":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected output of remote command: %q", out)
+	}
+}
+
+// removeIDScript removes the lines with the key blob $1 from authorized_keys.
+// The file is replaced only when grep succeeds, with the mode of the file
+// kept, so a failed write never leaves a truncated authorized_keys.
+const removeIDScript = `set -e
+cd
+umask 077
+f=.ssh/authorized_keys
+if [ ! -f "$f" ] || ! grep -qF "$1" "$f"; then
+	echo absent
+	exit 0
+fi
+trap 'rm -f "$f.tmp"' EXIT
+cp -p "$f" "$f.tmp"
+status=0
+grep -vF "$1" "$f" > "$f.tmp" || status=$?
+if [ "$status" -gt 1 ]; then
+	echo "filter authorized_keys: grep exited with status $status" >&2
+	exit "$status"
+fi
+mv "$f.tmp" "$f"
+echo removed
+`
+
+// RemoveID removes the public key from the remote authorized_keys file. It
+// reports whether the key was found.
+func RemoveID(client *ssh.Client, pub ssh.PublicKey) (bool, error) {
+	blob := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+
+	out, err := Run(client, removeIDScript, blob)
+	if err != nil {
+		return false, err
+	}
+	switch strings.TrimSpace(out) {
+	case "removed":
+		return true, nil
+	case "absent":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected output of remote command: %q", out)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remote
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// errProbe stops the authentication once the offered methods are known.
+var errProbe = errors.New("probe of authentication methods")
+
+// TestResult is the result of testing a key against a host.
+type TestResult struct {
+	// Accepted is true when the server accepted the key.
+	Accepted bool
+	// Methods are the authentication methods offered by the server, among
+	// publickey, password and keyboard-interactive, or none when the server
+	// does not require authentication.
+	Methods []string
+	// HostKey is the host key of the server. It is set even when the key
+	// is not trusted.
+	HostKey ssh.PublicKey
+}
+
+// TestKey tries to log in to the target with the key alone, ignoring the
+// signers and password of the dialer, and finds out which authentication
+// methods the server offers. Rejection of the key is not an error.
+func (d *Dialer) TestKey(t Target, signer ssh.Signer) (*TestResult, error) {
+	result := &TestResult{}
+	hostKeyCallback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		result.HostKey = key
+		return d.HostKeyCallback(hostname, remote, key)
+	}
+
+	// The probes are tried only for the methods the server offers. Only
+	// keyboard-interactive sends a request, so it goes last.
+	probe := func(method string) {
+		result.Methods = append(result.Methods, method)
+	}
+	probeDialer := &Dialer{HostKeyCallback: hostKeyCallback, Timeout: d.Timeout}
+	client, err := probeDialer.dial(t, []ssh.AuthMethod{
+		ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			probe("publickey")
+			return nil, errProbe
+		}),
+		ssh.PasswordCallback(func() (string, error) {
+			probe("password")
+			return "", errProbe
+		}),
+		ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			probe("keyboard-interactive")
+			return nil, errProbe
+		}),
+	})
+	switch {
+	case err == nil:
+		client.Close()
+		result.Methods = []string{"none"}
+	case !errors.Is(err, errProbe) && !isAuthError(err):
+		return result, err
+	}
+
+	client, err = probeDialer.dial(t, []ssh.AuthMethod{ssh.PublicKeys(signer)})
+	switch {
+	case err == nil:
+		client.Close()
+		result.Accepted = true
+	case !isAuthError(err):
+		return result, err
+	}
+
+	return result, nil
+}
+
+// isAuthError reports whether the error is returned when the server did not
+// accept any of the credentials.
+func isAuthError(err error) bool {
+	return strings.Contains(err.Error(), "ssh: unable to authenticate")
+}
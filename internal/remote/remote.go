@@ -0,0 +1,224 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package remote connects to SSH servers to manage keys on them.
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/hosts"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// DefaultPort is the default SSH port.
+const DefaultPort = 22
+
+// ErrUnknownHost is returned when the host key is not in known_hosts file.
+var ErrUnknownHost = errors.New("host key is unknown")
+
+// Target is a remote account to connect to.
+type Target struct {
+	User string
+	Host string
+	Port int
+}
+
+// ParseTarget parses the user@host[:port] destination. The user defaults
+// to the current user and the port to 22. IPv6 addresses with the port are
+// written in brackets like [::1]:2222.
+func ParseTarget(s string) (Target, error) {
+	t := Target{Port: DefaultPort}
+	hostport := s
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		t.User, hostport = s[:i], s[i+1:]
+	}
+
+	t.Host = strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]")
+	if host, port, err := net.SplitHostPort(hostport); err == nil {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return Target{}, fmt.Errorf("invalid port in %q", s)
+		}
+		t.Host, t.Port = host, n
+	}
+	if t.Host == "" {
+		return Target{}, fmt.Errorf("host is missing in %q", s)
+	}
+
+	if t.User == "" {
+		u, err := user.Current()
+		if err != nil {
+			return Target{}, fmt.Errorf("get current user: %v", err)
+		}
+		t.User = u.Username
+	}
+
+	return t, nil
+}
+
+// Addr returns the host:port address to dial.
+func (t Target) Addr() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+// String returns the target as user@host or user@[host]:port.
+func (t Target) String() string {
+	return t.User + "@" + knownhosts.Normalize(t.Addr())
+}
+
+// Dialer connects to remote hosts.
+type Dialer struct {
+	// Signers returns the keys for public key authentication, usually the
+	// keys of SSH agent. Optional.
+	Signers func() ([]ssh.Signer, error)
+	// Password asks for the password of the target, it is called at most
+	// once per connection and only when the keys are not accepted. Optional.
+	Password func(t Target) (string, error)
+	// HostKeyCallback verifies the host key, see KnownHostsCallback.
+	HostKeyCallback ssh.HostKeyCallback
+	// Timeout limits the time of establishing the connection. Zero means
+	// no timeout.
+	Timeout time.Duration
+}
+
+// Dial connects to the target and authenticates.
+func (d *Dialer) Dial(t Target) (*ssh.Client, error) {
+	var auth []ssh.AuthMethod
+	if d.Signers != nil {
+		auth = append(auth, ssh.PublicKeysCallback(d.Signers))
+	}
+	if d.Password != nil {
+		password := sync.OnceValues(func() (string, error) {
+			return d.Password(t)
+		})
+		auth = append(auth,
+			ssh.PasswordCallback(password),
+			ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range questions {
+					if echos[i] {
+						continue
+					}
+					p, err := password()
+					if err != nil {
+						return nil, err
+					}
+					answers[i] = p
+				}
+				return answers, nil
+			}),
+		)
+	}
+
+	return d.dial(t, auth)
+}
+
+// dial connects to the target with the authentication methods.
+func (d *Dialer) dial(t Target, auth []ssh.AuthMethod) (*ssh.Client, error) {
+	if d.HostKeyCallback == nil {
+		return nil, fmt.Errorf("host key callback is required")
+	}
+
+	client, err := ssh.Dial("tcp", t.Addr(), &ssh.ClientConfig{
+		User:            t.User,
+		Auth:            auth,
+		HostKeyCallback: d.HostKeyCallback,
+		Timeout:         d.Timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", t, err)
+	}
+
+	return client, nil
+}
+
+// KnownHostsCallback verifies host keys against the known_hosts file. Keys
+// of unknown hosts are added to the file when acceptNew is true, like
+// StrictHostKeyChecking=accept-new of ssh(1), otherwise ErrUnknownHost is
+// returned. Changed and revoked keys are always rejected.
+func KnownHostsCallback(path string, acceptNew bool) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		var err error = &knownhosts.KeyError{}
+		check, loadErr := knownhosts.New(path)
+		switch {
+		case loadErr == nil:
+			err = check(hostname, remote, key)
+		case !errors.Is(loadErr, fs.ErrNotExist):
+			return fmt.Errorf("read known hosts: %v", loadErr)
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+			return err
+		}
+		if !acceptNew {
+			return fmt.Errorf("%s %s: %w", hostname, ssh.FingerprintSHA256(key), ErrUnknownHost)
+		}
+
+		f, err := hosts.Load(path)
+		if err != nil {
+			return err
+		}
+		f.Add([]string{hostname}, key)
+
+		return f.Save()
+	}
+}
+
+// Run runs the POSIX shell script on the remote host with the arguments and
+// returns its output. The script is passed on stdin, so it does not depend
+// on quoting rules of the login shell.
+func Run(client *ssh.Client, script string, args ...string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("open session: %v", err)
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdin = strings.NewReader(script)
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	cmd := "sh -s --"
+	for _, arg := range args {
+		cmd += " " + shellQuote(arg)
+	}
+	if err := session.Run(cmd); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("run remote command: %v: %s", err, msg)
+		}
+		return "", fmt.Errorf("run remote command: %v", err)
+	}
+
+	return stdout.String(), nil
+}
+
+// shellQuote quotes the string for POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
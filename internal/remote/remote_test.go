@@ -0,0 +1,224 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remote
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mixanemca/ssh-keys/internal/remote/remotetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+
+	return signer
+}
+
+func TestParseTarget(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Target
+	}{
+		{"alice@example.com", Target{User: "alice", Host: "example.com", Port: 22}},
+		{"alice@example.com:2222", Target{User: "alice", Host: "example.com", Port: 2222}},
+		{"alice@[::1]:2222", Target{User: "alice", Host: "::1", Port: 2222}},
+		{"alice@[::1]", Target{User: "alice", Host: "::1", Port: 22}},
+		{"a@b@example.com", Target{User: "a@b", Host: "example.com", Port: 22}},
+	}
+	for _, c := range cases {
+		got, err := ParseTarget(c.in)
+		require.NoError(t, err, c.in)
+		assert.Equal(t, c.want, got, c.in)
+	}
+
+	for _, in := range []string{"alice@", "alice@example.com:0", "alice@example.com:ssh"} {
+		_, err := ParseTarget(in)
+		assert.Error(t, err, in)
+	}
+
+	got, err := ParseTarget("example.com")
+	require.NoError(t, err)
+	assert.NotEmpty(t, got.User)
+	assert.Equal(t, "alice@[example.com]:2222", Target{User: "alice", Host: "example.com", Port: 2222}.String())
+}
+
+func TestCopyID(t *testing.T) {
+	srv := remotetest.NewServer(t)
+	srv.SetPassword("secret")
+	target, err := ParseTarget(srv.Target())
+	require.NoError(t, err)
+
+	var prompts int
+	d := &Dialer{
+		Password: func(Target) (string, error) {
+			prompts++
+			return "secret", nil
+		},
+		HostKeyCallback: srv.HostKeyCallback(),
+	}
+	client, err := d.Dial(target)
+	require.NoError(t, err)
+	defer client.Close()
+	assert.Equal(t, 1, prompts)
+
+	// An existing file without the trailing newline is kept intact.
+	other := newTestSigner(t)
+	require.NoError(t, os.MkdirAll(filepath.Dir(srv.AuthorizedKeys()), 0755))
+	require.NoError(t, os.WriteFile(srv.AuthorizedKeys(), ssh.MarshalAuthorizedKey(other.PublicKey())[:80], 0644))
+
+	key := newTestSigner(t)
+	added, err := CopyID(client, key.PublicKey(), "alice's key")
+	require.NoError(t, err)
+	assert.True(t, added)
+	added, err = CopyID(client, key.PublicKey(), "alice's key")
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	data, err := os.ReadFile(srv.AuthorizedKeys())
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasSuffix(lines[1], " alice's key"))
+
+	for path, perm := range map[string]os.FileMode{filepath.Dir(srv.AuthorizedKeys()): 0700, srv.AuthorizedKeys(): 0600} {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, perm, info.Mode().Perm(), path)
+	}
+
+	// The deployed key is accepted now.
+	d = &Dialer{
+		Signers:         func() ([]ssh.Signer, error) { return []ssh.Signer{key}, nil },
+		HostKeyCallback: srv.HostKeyCallback(),
+	}
+	client, err = d.Dial(target)
+	require.NoError(t, err)
+	defer client.Close()
+
+	// The mode of the replaced file is kept.
+	require.NoError(t, os.Chmod(srv.AuthorizedKeys(), 0640))
+	removed, err := RemoveID(client, other.PublicKey())
+	require.NoError(t, err)
+	assert.True(t, removed)
+	info, err := os.Stat(srv.AuthorizedKeys())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	removed, err = RemoveID(client, other.PublicKey())
+	require.NoError(t, err)
+	assert.False(t, removed)
+	data, err = os.ReadFile(srv.AuthorizedKeys())
+	require.NoError(t, err)
+	assert.Equal(t, lines[1]+"\n", string(data))
+}
+
+func TestRemoveIDScriptGrepFailure(t *testing.T) {
+	home := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(home, ".ssh"), 0700))
+	path := filepath.Join(home, ".ssh", "authorized_keys")
+	content := "ssh-ed25519 AAAAfirst\nssh-ed25519 AAAAsecond\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	// The fake grep finds the key but fails to filter the file, like on an
+	// I/O error.
+	grep, err := exec.LookPath("grep")
+	require.NoError(t, err)
+	bin := t.TempDir()
+	fake := fmt.Sprintf("#!/bin/sh\nif [ \"$1\" = -vF ]; then exit 2; fi\nexec %s \"$@\"\n", grep)
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "grep"), []byte(fake), 0755))
+
+	cmd := exec.Command("/bin/sh", "-s", "--", "ssh-ed25519 AAAAfirst")
+	cmd.Stdin = strings.NewReader(removeIDScript)
+	cmd.Env = append(os.Environ(), "HOME="+home, "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	out, err := cmd.CombinedOutput()
+	require.Error(t, err)
+	assert.Contains(t, string(out), "grep exited with status 2")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+	_, err = os.Stat(path + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestKnownHostsCallback(t *testing.T) {
+	srv := remotetest.NewServer(t)
+	srv.SetPassword("secret")
+	target, err := ParseTarget(srv.Target())
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "known_hosts")
+
+	dial := func(acceptNew bool) error {
+		d := &Dialer{
+			Password:        func(Target) (string, error) { return "secret", nil },
+			HostKeyCallback: KnownHostsCallback(path, acceptNew),
+		}
+		client, err := d.Dial(target)
+		if err == nil {
+			client.Close()
+		}
+		return err
+	}
+
+	assert.ErrorIs(t, dial(false), ErrUnknownHost)
+	require.NoError(t, dial(true))
+	require.NoError(t, dial(false))
+
+	// The host was rekeyed.
+	srv.Rekey(t)
+	assert.Error(t, dial(true))
+}
+
+func TestTestKey(t *testing.T) {
+	srv := remotetest.NewServer(t)
+	target, err := ParseTarget(srv.Target())
+	require.NoError(t, err)
+	key := newTestSigner(t)
+	d := &Dialer{HostKeyCallback: srv.HostKeyCallback()}
+
+	result, err := d.TestKey(target, key)
+	require.NoError(t, err)
+	assert.False(t, result.Accepted)
+	assert.Equal(t, []string{"publickey"}, result.Methods)
+	assert.Equal(t, srv.HostKey().Marshal(), result.HostKey.Marshal())
+
+	srv.SetPassword("secret")
+	require.NoError(t, os.MkdirAll(filepath.Dir(srv.AuthorizedKeys()), 0700))
+	require.NoError(t, os.WriteFile(srv.AuthorizedKeys(), ssh.MarshalAuthorizedKey(key.PublicKey()), 0600))
+	result, err = d.TestKey(target, key)
+	require.NoError(t, err)
+	assert.True(t, result.Accepted)
+	assert.Equal(t, []string{"publickey", "password"}, result.Methods)
+
+	// The host key is reported even when it is not trusted.
+	srv.Rekey(t)
+	result, err = d.TestKey(target, key)
+	assert.Error(t, err)
+	assert.Equal(t, srv.HostKey().Marshal(), result.HostKey.Marshal())
+}
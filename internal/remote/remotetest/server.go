@@ -0,0 +1,231 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package remotetest provides an in-process SSH server for tests.
+package remotetest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/mixanemca/ssh-keys/internal/authorized"
+	"golang.org/x/crypto/ssh"
+)
+
+// User is the only account of the server.
+const User = "tester"
+
+// Server is an SSH server listening on the loopback interface. Public keys
+// are checked against .ssh/authorized_keys in Home, exec requests are run
+// by sh(1) in Home.
+type Server struct {
+	// Addr is the host:port address of the server.
+	Addr string
+	// Home is the home directory of User.
+	Home string
+
+	listener net.Listener
+
+	// mu guards the fields changed by tests while the server is running.
+	mu       sync.Mutex
+	password string
+	hostKey  ssh.Signer
+}
+
+// NewServer starts a new server, it is stopped when the test finishes.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &Server{
+		Addr:     l.Addr().String(),
+		Home:     t.TempDir(),
+		listener: l,
+	}
+	s.Rekey(t)
+	go s.serve()
+
+	return s
+}
+
+// Target returns the user@host:port destination of the server.
+func (s *Server) Target() string {
+	return User + "@" + s.Addr
+}
+
+// SetPassword enables password authentication of User. An empty password
+// disables it.
+func (s *Server) SetPassword(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.password = password
+}
+
+// Rekey replaces the host key of the server with a new one.
+func (s *Server) Rekey(t testing.TB) {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("create host key signer: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hostKey = signer
+}
+
+// HostKey returns the current host key of the server.
+func (s *Server) HostKey() ssh.PublicKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hostKey.PublicKey()
+}
+
+// HostKeyCallback accepts only the current host key of the server.
+func (s *Server) HostKeyCallback() ssh.HostKeyCallback {
+	return ssh.FixedHostKey(s.HostKey())
+}
+
+// AuthorizedKeys returns the path of authorized_keys file of User.
+func (s *Server) AuthorizedKeys() string {
+	return filepath.Join(s.Home, ".ssh", "authorized_keys")
+}
+
+// config returns the server configuration.
+func (s *Server) config() *ssh.ServerConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			f, err := authorized.Load(s.AuthorizedKeys())
+			if err != nil {
+				return nil, err
+			}
+			if c.User() != User || len(f.Find(key)) == 0 {
+				return nil, fmt.Errorf("public key of %s rejected", c.User())
+			}
+			return nil, nil
+		},
+	}
+	if password := s.password; password != "" {
+		config.PasswordCallback = func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() != User || string(pass) != password {
+				return nil, fmt.Errorf("password of %s rejected", c.User())
+			}
+			return nil, nil
+		}
+	}
+	config.AddHostKey(s.hostKey)
+
+	return config
+}
+
+// serve accepts connections until the listener is closed.
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn handles the SSH connection.
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config())
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, chReqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go s.serveSession(ch, chReqs)
+	}
+}
+
+// serveSession runs the command of the first exec request.
+func (s *Server) serveSession(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+
+	for req := range reqs {
+		var payload struct {
+			Command string
+		}
+		if req.Type != "exec" || ssh.Unmarshal(req.Payload, &payload) != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		status := struct {
+			Status uint32
+		}{s.run(ch, payload.Command)}
+		ch.SendRequest("exit-status", false, ssh.Marshal(&status))
+		return
+	}
+}
+
+// run runs the command like sshd(8) does with the user shell and returns
+// its exit status.
+func (s *Server) run(ch ssh.Channel, command string) uint32 {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Dir = s.Home
+	cmd.Env = []string{"HOME=" + s.Home, "PATH=" + os.Getenv("PATH")}
+	cmd.Stdin = ch
+	cmd.Stdout = ch
+	cmd.Stderr = ch.Stderr()
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return uint32(exitErr.ExitCode())
+	default:
+		return 255
+	}
+}
@@ -0,0 +1,368 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rotate replaces a key with a new one on the hosts it is used for.
+//
+// The rotation generates the new key next to the old one, then for every
+// host deploys the new key, verifies the login with it and removes the old
+// key from authorized_keys. When all hosts are done, the old key is moved
+// to the archive and the new key takes its name. The progress is saved
+// after every step, so a failed rotation resumes where it stopped.
+package rotate
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/mixanemca/ssh-keys/internal/remote"
+	"golang.org/x/crypto/ssh"
+)
+
+// NewSuffix is appended to the key name to get the name of the new key
+// while the rotation is in progress.
+const NewSuffix = ".new"
+
+// Stage is the progress of the rotation on a host.
+type Stage string
+
+const (
+	// StagePending means nothing was done on the host yet.
+	StagePending Stage = "pending"
+	// StageDeployed means the new key is added to authorized_keys.
+	StageDeployed Stage = "deployed"
+	// StageVerified means the login with the new key succeeded.
+	StageVerified Stage = "verified"
+	// StageRetired means the old key is removed from authorized_keys.
+	StageRetired Stage = "retired"
+)
+
+// Host is a host the key is used for.
+type Host struct {
+	// Alias is the host name in ssh_config.
+	Alias string
+	// Target is the account the key logs in to.
+	Target remote.Target
+	// Stage is the progress of the rotation on the host.
+	Stage Stage
+}
+
+// State is the progress of the rotation of a key.
+type State struct {
+	// Name is the name of the rotated key.
+	Name string
+	// OldFingerprint is the fingerprint of the key being replaced.
+	OldFingerprint string
+	// NewFingerprint is the fingerprint of the replacement key.
+	NewFingerprint string
+	// Hosts are the hosts to deploy the new key to.
+	Hosts []*Host
+	// Archived is true when the old key is moved to the archive.
+	Archived bool
+	// Started is the time the rotation started.
+	Started time.Time
+}
+
+// Rotator rotates keys of the store.
+type Rotator struct {
+	// Store keeps the rotated keys.
+	Store keys.KeyStore
+	// Archive receives the old keys.
+	Archive keys.KeyStore
+	// Dialer connects to the hosts. The old key is offered before its
+	// own signers.
+	Dialer *remote.Dialer
+	// StateDir keeps the state of unfinished rotations.
+	StateDir string
+	// Output receives the progress messages. Optional.
+	Output io.Writer
+	// Now returns the current time. Optional, defaults to time.Now.
+	Now func() time.Time
+}
+
+// Plan returns the state of the unfinished rotation of the key, or the
+// plan of a new rotation on the hosts. Nothing is changed.
+func (r *Rotator) Plan(name string, hosts []*Host) (*State, error) {
+	state, err := r.loadState(name)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return state, err
+	}
+
+	old, err := r.Store.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hosts {
+		h.Stage = StagePending
+	}
+
+	return &State{
+		Name:           name,
+		OldFingerprint: ssh.FingerprintSHA256(old.Public),
+		Hosts:          hosts,
+		Started:        r.now(),
+	}, nil
+}
+
+// Run rotates the key on the hosts or resumes the unfinished rotation, in
+// which case the hosts are taken from the saved state. All hosts are tried
+// even when some of them fail.
+func (r *Rotator) Run(name string, hosts []*Host) error {
+	state, err := r.Plan(name, hosts)
+	if err != nil {
+		return err
+	}
+
+	var old *models.Key
+	if !state.Archived {
+		if old, err = r.Store.Get(name); err != nil {
+			return err
+		}
+		if fp := ssh.FingerprintSHA256(old.Public); fp != state.OldFingerprint {
+			return fmt.Errorf("key %s was changed since the rotation started: %s, want %s", name, fp, state.OldFingerprint)
+		}
+	}
+
+	newKey, err := r.newKey(state, old)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, h := range state.Hosts {
+		if err := r.rotateHost(state, h, old, newKey); err != nil {
+			r.printf("%s: %v\n", h.Alias, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("rotation failed on %d of %d hosts, run it again to resume", failed, len(state.Hosts))
+	}
+
+	if !state.Archived {
+		archived := name + "-" + state.Started.UTC().Format("20060102T150405Z")
+		if err := r.archive(old, archived); err != nil {
+			return err
+		}
+		state.Archived = true
+		if err := r.saveState(state); err != nil {
+			return err
+		}
+		r.printf("Archived old key as %s\n", archived)
+	}
+	if err := r.Store.Rename(name+NewSuffix, name); err != nil {
+		return err
+	}
+	r.printf("Key %s was rotated, new fingerprint %s\n", name, state.NewFingerprint)
+
+	return r.removeState(name)
+}
+
+// newKey generates the replacement of the old key, or returns the one
+// generated by the unfinished rotation.
+func (r *Rotator) newKey(state *State, old *models.Key) (*models.Key, error) {
+	name := state.Name + NewSuffix
+	if state.NewFingerprint != "" {
+		key, err := r.Store.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if fp := ssh.FingerprintSHA256(key.Public); fp != state.NewFingerprint {
+			return nil, fmt.Errorf("key %s was changed since the rotation started: %s, want %s", name, fp, state.NewFingerprint)
+		}
+		return key, nil
+	}
+
+	var bits int
+	if k, ok := old.Private.(*rsa.PrivateKey); ok {
+		bits = k.N.BitLen()
+	}
+	priv, err := keys.GenerateKey(old.Format, bits)
+	if err != nil {
+		return nil, err
+	}
+	key := &models.Key{Name: name, Comment: old.Comment, Private: priv}
+	if err := r.Store.Create(key); err != nil {
+		return nil, err
+	}
+	state.NewFingerprint = ssh.FingerprintSHA256(key.Public)
+	if err := r.saveState(state); err != nil {
+		return nil, err
+	}
+	r.printf("Generated %s key %s, fingerprint %s\n", key.Format, name, state.NewFingerprint)
+
+	return key, nil
+}
+
+// rotateHost advances the rotation on the host up to StageRetired.
+func (r *Rotator) rotateHost(state *State, h *Host, old, newKey *models.Key) error {
+	if h.Stage == StageRetired {
+		return nil
+	}
+	newSigner, err := ssh.NewSignerFromKey(newKey.Private)
+	if err != nil {
+		return fmt.Errorf("create signer: %v", err)
+	}
+
+	if h.Stage == StagePending {
+		oldSigner, err := ssh.NewSignerFromKey(old.Private)
+		if err != nil {
+			return fmt.Errorf("create signer: %v", err)
+		}
+		client, err := r.dial(h.Target, oldSigner, true)
+		if err != nil {
+			return err
+		}
+		_, err = remote.CopyID(client, newKey.Public, newKey.Comment)
+		client.Close()
+		if err != nil {
+			return err
+		}
+		if err := r.advance(state, h, StageDeployed); err != nil {
+			return err
+		}
+	}
+
+	// Only the new key is offered, so the login proves it works.
+	client, err := r.dial(h.Target, newSigner, false)
+	if err != nil {
+		return fmt.Errorf("verify login with new key: %w", err)
+	}
+	defer client.Close()
+	if h.Stage == StageDeployed {
+		if err := r.advance(state, h, StageVerified); err != nil {
+			return err
+		}
+	}
+
+	// The old key is archived only when all hosts are retired, so it is
+	// still there.
+	if _, err := remote.RemoveID(client, old.Public); err != nil {
+		return err
+	}
+
+	return r.advance(state, h, StageRetired)
+}
+
+// advance saves the new stage of the host.
+func (r *Rotator) advance(state *State, h *Host, stage Stage) error {
+	h.Stage = stage
+	r.printf("%s (%s): %s\n", h.Alias, h.Target, stage)
+
+	return r.saveState(state)
+}
+
+// dial connects to the target with the signer. The signers and password of
+// the dialer are used as a fallback when fallback is true.
+func (r *Rotator) dial(t remote.Target, signer ssh.Signer, fallback bool) (*ssh.Client, error) {
+	d := remote.Dialer{
+		Signers: func() ([]ssh.Signer, error) {
+			return []ssh.Signer{signer}, nil
+		},
+		HostKeyCallback: r.Dialer.HostKeyCallback,
+		Timeout:         r.Dialer.Timeout,
+	}
+	if fallback {
+		d.Password = r.Dialer.Password
+		if r.Dialer.Signers != nil {
+			d.Signers = func() ([]ssh.Signer, error) {
+				signers, err := r.Dialer.Signers()
+				return append([]ssh.Signer{signer}, signers...), err
+			}
+		}
+	}
+
+	return d.Dial(t)
+}
+
+// archive moves the old key to the archive under the new name.
+func (r *Rotator) archive(old *models.Key, name string) error {
+	archived := &models.Key{Name: name, Comment: old.Comment, Private: old.Private}
+	if err := r.Archive.Create(archived); err != nil {
+		return fmt.Errorf("archive old key: %w", err)
+	}
+
+	return r.Store.Delete(old.Name)
+}
+
+// statePath returns the path of the state file of the key rotation.
+func (r *Rotator) statePath(name string) string {
+	return filepath.Join(r.StateDir, url.PathEscape(name)+".json")
+}
+
+// loadState reads the state of the unfinished rotation. The error wraps
+// os.ErrNotExist when there is none.
+func (r *Rotator) loadState(name string) (*State, error) {
+	data, err := os.ReadFile(r.statePath(name))
+	if err != nil {
+		return nil, fmt.Errorf("read rotation state: %w", err)
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parse rotation state: %v", err)
+	}
+
+	return &state, nil
+}
+
+// saveState writes the state of the rotation.
+func (r *Rotator) saveState(state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal rotation state: %v", err)
+	}
+	if err := os.MkdirAll(r.StateDir, 0700); err != nil {
+		return fmt.Errorf("create rotation state dir: %v", err)
+	}
+	if err := os.WriteFile(r.statePath(state.Name), data, 0600); err != nil {
+		return fmt.Errorf("write rotation state: %v", err)
+	}
+
+	return nil
+}
+
+// removeState deletes the state of the finished rotation.
+func (r *Rotator) removeState(name string) error {
+	if err := os.Remove(r.statePath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove rotation state: %v", err)
+	}
+
+	return nil
+}
+
+// printf writes the progress message.
+func (r *Rotator) printf(format string, args ...any) {
+	if r.Output != nil {
+		fmt.Fprintf(r.Output, format, args...)
+	}
+}
+
+// now returns the current time.
+func (r *Rotator) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+
+	return time.Now()
+}
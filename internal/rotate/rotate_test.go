@@ -0,0 +1,131 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotate
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mixanemca/ssh-keys/internal/authorized"
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/mixanemca/ssh-keys/internal/remote"
+	"github.com/mixanemca/ssh-keys/internal/remote/remotetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// authorize adds the key to authorized_keys of the server.
+func authorize(t *testing.T, srv *remotetest.Server, pub ssh.PublicKey) {
+	f, err := authorized.Load(srv.AuthorizedKeys())
+	require.NoError(t, err)
+	_, err = f.Add(pub, "", nil)
+	require.NoError(t, err)
+	require.NoError(t, f.Save())
+}
+
+// authorizedKeys returns the fingerprints of keys authorized on the server.
+func authorizedKeys(t *testing.T, srv *remotetest.Server) []string {
+	f, err := authorized.Load(srv.AuthorizedKeys())
+	require.NoError(t, err)
+	var fps []string
+	for _, e := range f.Entries() {
+		fps = append(fps, e.Fingerprint())
+	}
+
+	return fps
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	store := keys.NewFSStore(filepath.Join(dir, "keys"))
+	archive := keys.NewFSStore(filepath.Join(dir, "archive"))
+	priv, err := keys.GenerateKey(ssh.KeyAlgoED25519, 0)
+	require.NoError(t, err)
+	old := &models.Key{Name: "id_work", Comment: "work", Private: priv}
+	require.NoError(t, store.Create(old))
+	oldFingerprint := ssh.FingerprintSHA256(old.Public)
+
+	// The old key is not authorized on the second server yet.
+	srv1, srv2 := remotetest.NewServer(t), remotetest.NewServer(t)
+	authorize(t, srv1, old.Public)
+
+	var hosts []*Host
+	for alias, srv := range map[string]*remotetest.Server{"one": srv1, "two": srv2} {
+		target, err := remote.ParseTarget(srv.Target())
+		require.NoError(t, err)
+		hosts = append(hosts, &Host{Alias: alias, Target: target})
+	}
+
+	var out bytes.Buffer
+	r := &Rotator{
+		Store:   store,
+		Archive: archive,
+		Dialer: &remote.Dialer{
+			HostKeyCallback: func(hostname string, addr net.Addr, key ssh.PublicKey) error {
+				if err := srv1.HostKeyCallback()(hostname, addr, key); err == nil {
+					return nil
+				}
+				return srv2.HostKeyCallback()(hostname, addr, key)
+			},
+		},
+		StateDir: filepath.Join(dir, "state"),
+		Output:   &out,
+	}
+
+	state, err := r.Plan("id_work", hosts)
+	require.NoError(t, err)
+	assert.Equal(t, oldFingerprint, state.OldFingerprint)
+	assert.Empty(t, state.NewFingerprint)
+	_, err = store.Get("id_work" + NewSuffix)
+	assert.ErrorIs(t, err, keys.ErrKeyNotFound, "planning changes nothing")
+
+	require.Error(t, r.Run("id_work", hosts))
+	state, err = r.Plan("id_work", nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, state.NewFingerprint)
+	stages := map[string]Stage{}
+	for _, h := range state.Hosts {
+		stages[h.Alias] = h.Stage
+	}
+	assert.Equal(t, map[string]Stage{"one": StageRetired, "two": StagePending}, stages)
+	assert.Equal(t, []string{state.NewFingerprint}, authorizedKeys(t, srv1))
+
+	// Resume after the old key is authorized on the second server.
+	authorize(t, srv2, old.Public)
+	require.NoError(t, r.Run("id_work", nil), out.String())
+	assert.Equal(t, []string{state.NewFingerprint}, authorizedKeys(t, srv2))
+
+	key, err := store.Get("id_work")
+	require.NoError(t, err)
+	assert.Equal(t, state.NewFingerprint, ssh.FingerprintSHA256(key.Public))
+	assert.Equal(t, "work", key.Comment)
+	_, err = store.Get("id_work" + NewSuffix)
+	assert.ErrorIs(t, err, keys.ErrKeyNotFound)
+
+	archived, err := archive.List()
+	require.NoError(t, err)
+	require.Len(t, archived, 1)
+	assert.Equal(t, oldFingerprint, ssh.FingerprintSHA256(archived[0].Public))
+
+	_, err = os.Stat(r.statePath("id_work"))
+	assert.True(t, os.IsNotExist(err))
+}
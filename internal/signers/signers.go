@@ -0,0 +1,471 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package signers manages allowed_signers files of ssh-keygen(1), which list
+// the keys trusted to make SSHSIG signatures, like Git commit signatures.
+package signers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/linefile"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrDuplicate is returned when the key is already allowed for the
+// principals.
+var ErrDuplicate = errors.New("key is already allowed for the principals")
+
+// Entry is a key line of allowed_signers file.
+type Entry struct {
+	// Line is the line number in the file, starting from 1.
+	Line int
+	// Principals are the principal patterns, like user@example.com or
+	// *@example.com.
+	Principals []string
+	// Options are the key options like cert-authority or namespaces="git".
+	Options []string
+	// Key is the allowed public key, or the CA key for cert-authority.
+	Key ssh.PublicKey
+	// Comment is the comment after the key.
+	Comment string
+}
+
+// Fingerprint returns SHA256 fingerprint of the key.
+func (e *Entry) Fingerprint() string {
+	return ssh.FingerprintSHA256(e.Key)
+}
+
+// Option returns the value of the named option. Flag options like
+// cert-authority have an empty value.
+func (e *Entry) Option(name string) (string, bool) {
+	for _, opt := range e.Options {
+		n, v, hasValue := strings.Cut(opt, "=")
+		if !strings.EqualFold(n, name) {
+			continue
+		}
+		if hasValue {
+			v = strings.TrimSuffix(strings.TrimPrefix(v, `"`), `"`)
+		}
+		return v, true
+	}
+
+	return "", false
+}
+
+// CertAuthority reports whether the key is a CA which signs certificates of
+// the principals.
+func (e *Entry) CertAuthority() bool {
+	_, ok := e.Option("cert-authority")
+	return ok
+}
+
+// Namespaces returns the namespace patterns the key may sign in, nil means
+// any namespace.
+func (e *Entry) Namespaces() []string {
+	v, ok := e.Option("namespaces")
+	if !ok {
+		return nil
+	}
+
+	return strings.Split(v, ",")
+}
+
+// MatchPrincipal reports whether the principal matches the principal
+// patterns of the entry. The patterns support * and ? wildcards and !
+// negation.
+func (e *Entry) MatchPrincipal(principal string) bool {
+	return matchList(e.Principals, principal)
+}
+
+// MatchNamespace reports whether the key may sign in the namespace.
+func (e *Entry) MatchNamespace(namespace string) bool {
+	patterns := e.Namespaces()
+	return patterns == nil || matchList(patterns, namespace)
+}
+
+// Validity returns the times of valid-after and valid-before options, zero
+// when the option is not set.
+func (e *Entry) Validity() (after, before time.Time, err error) {
+	if v, ok := e.Option("valid-after"); ok {
+		if after, err = ParseTime(v); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	if v, ok := e.Option("valid-before"); ok {
+		if before, err = ParseTime(v); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+
+	return after, before, nil
+}
+
+// Valid reports whether the entry is valid at the time.
+func (e *Entry) Valid(now time.Time) bool {
+	after, before, err := e.Validity()
+	if err != nil {
+		return false
+	}
+
+	return (after.IsZero() || !now.Before(after)) && (before.IsZero() || now.Before(before))
+}
+
+// String returns the line of the entry in allowed_signers format.
+func (e *Entry) String() string {
+	var b strings.Builder
+	principals := strings.Join(e.Principals, ",")
+	if strings.ContainsAny(principals, " \t") {
+		principals = `"` + principals + `"`
+	}
+	b.WriteString(principals)
+	b.WriteByte(' ')
+	if len(e.Options) > 0 {
+		b.WriteString(strings.Join(e.Options, ","))
+		b.WriteByte(' ')
+	}
+	b.Write(bytes.TrimSpace(ssh.MarshalAuthorizedKey(e.Key)))
+	if e.Comment != "" {
+		b.WriteByte(' ')
+		b.WriteString(e.Comment)
+	}
+
+	return b.String()
+}
+
+// allows reports whether the entry allows the key to sign in the namespace
+// at the time. The key may be a certificate signed by a cert-authority key.
+func (e *Entry) allows(key ssh.PublicKey, namespace string, now time.Time) bool {
+	if !e.MatchNamespace(namespace) || !e.Valid(now) {
+		return false
+	}
+	cert, isCert := key.(*ssh.Certificate)
+	if !e.CertAuthority() {
+		return !isCert && bytes.Equal(key.Marshal(), e.Key.Marshal())
+	}
+	if !isCert || cert.CertType != ssh.UserCert || !bytes.Equal(cert.SignatureKey.Marshal(), e.Key.Marshal()) {
+		return false
+	}
+	unix := uint64(now.Unix())
+
+	return unix >= cert.ValidAfter && unix < cert.ValidBefore
+}
+
+// File is an allowed_signers file.
+type File struct {
+	path  string
+	lines *linefile.Lines[*Entry]
+}
+
+// Load reads allowed_signers file. A missing file is treated as empty.
+// Broken lines are kept and reported by Validate.
+func Load(path string) (*File, error) {
+	lines, err := linefile.Read(path, parseFileLine, func(e *Entry, n int) { e.Line = n })
+	if err != nil {
+		return nil, fmt.Errorf("read allowed signers: %v", err)
+	}
+
+	return &File{path: path, lines: lines}, nil
+}
+
+// parseFileLine parses the line of the file, skipping comments and blank
+// lines.
+func parseFileLine(raw string) (*Entry, error) {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return nil, nil
+	}
+
+	return ParseLine(trimmed)
+}
+
+// ParseLine parses the line of allowed_signers file.
+func ParseLine(s string) (*Entry, error) {
+	s = strings.TrimSpace(s)
+	var principals string
+	if rest, ok := strings.CutPrefix(s, `"`); ok {
+		var closed bool
+		principals, s, closed = strings.Cut(rest, `"`)
+		if !closed {
+			return nil, fmt.Errorf("unterminated quoted principals")
+		}
+	} else {
+		i := strings.IndexAny(s, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("key is missing")
+		}
+		principals, s = s[:i], s[i:]
+	}
+	if principals == "" {
+		return nil, fmt.Errorf("principals are missing")
+	}
+
+	key, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(s)))
+	if err != nil {
+		return nil, fmt.Errorf("parse key: %v", err)
+	}
+	e := &Entry{
+		Principals: strings.Split(principals, ","),
+		Options:    options,
+		Key:        key,
+		Comment:    comment,
+	}
+	if _, _, err := e.Validity(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// ParseTime parses the time of valid-after and valid-before options in
+// YYYYMMDD[HHMM[SS]] format, in local time zone or in UTC with Z suffix.
+func ParseTime(s string) (time.Time, error) {
+	loc := time.Local
+	if v, ok := strings.CutSuffix(s, "Z"); ok {
+		s, loc = v, time.UTC
+	}
+	for _, layout := range []string{"20060102150405", "200601021504", "20060102"} {
+		if len(s) != len(layout) {
+			continue
+		}
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, want YYYYMMDD[HHMM[SS]][Z]", s)
+}
+
+// Path returns the file path.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Entries returns the key entries of the file.
+func (f *File) Entries() []*Entry {
+	return f.lines.Entries()
+}
+
+// Allowed reports whether the principal may sign with the key in the
+// namespace at the time. For certificates the principal must be one of
+// the certificate principals as well.
+func (f *File) Allowed(principal string, key ssh.PublicKey, namespace string, now time.Time) bool {
+	for _, e := range f.Entries() {
+		if !e.allows(key, namespace, now) || !e.MatchPrincipal(principal) {
+			continue
+		}
+		if cert, ok := key.(*ssh.Certificate); ok && !slices.Contains(cert.ValidPrincipals, principal) {
+			continue
+		}
+		return true
+	}
+
+	return false
+}
+
+// Principals returns the principals which may sign with the key in the
+// namespace at the time, like ssh-keygen -Y find-principals. Patterns of
+// entries are returned as written, except the negated ones.
+func (f *File) Principals(key ssh.PublicKey, namespace string, now time.Time) []string {
+	var principals []string
+	for _, e := range f.Entries() {
+		if !e.allows(key, namespace, now) {
+			continue
+		}
+		if cert, ok := key.(*ssh.Certificate); ok {
+			for _, p := range cert.ValidPrincipals {
+				if e.MatchPrincipal(p) && !slices.Contains(principals, p) {
+					principals = append(principals, p)
+				}
+			}
+			continue
+		}
+		for _, p := range e.Principals {
+			if !strings.HasPrefix(p, "!") && !slices.Contains(principals, p) {
+				principals = append(principals, p)
+			}
+		}
+	}
+
+	return principals
+}
+
+// Find returns the entries with the key.
+func (f *File) Find(pub ssh.PublicKey) []*Entry {
+	blob := pub.Marshal()
+	var found []*Entry
+	for _, e := range f.Entries() {
+		if bytes.Equal(e.Key.Marshal(), blob) {
+			found = append(found, e)
+		}
+	}
+
+	return found
+}
+
+// Add appends the key for the principals, allowed to sign in the
+// namespaces, or in any namespace when there are none. It returns
+// ErrDuplicate if there is an entry of the key with the same principals.
+func (f *File) Add(principals []string, pub ssh.PublicKey, namespaces []string, comment string) (*Entry, error) {
+	if len(principals) == 0 {
+		return nil, fmt.Errorf("principal is required")
+	}
+	for _, e := range f.Find(pub) {
+		if slices.Equal(e.Principals, principals) {
+			return nil, fmt.Errorf("%s: %w", ssh.FingerprintSHA256(pub), ErrDuplicate)
+		}
+	}
+	e := &Entry{
+		Principals: principals,
+		Key:        pub,
+		Comment:    comment,
+	}
+	if len(namespaces) > 0 {
+		e.Options = []string{fmt.Sprintf("namespaces=%q", strings.Join(namespaces, ","))}
+	}
+	// Validate the principals and namespaces by parsing the resulting line.
+	if _, err := ParseLine(e.String()); err != nil {
+		return nil, err
+	}
+	f.lines.Append(e.String(), e)
+
+	return e, nil
+}
+
+// Remove deletes all entries with the fingerprint and returns the number of
+// removed entries.
+func (f *File) Remove(fingerprint string) int {
+	return f.lines.Remove(func(e *Entry) bool {
+		return e.Fingerprint() == fingerprint
+	})
+}
+
+// RemoveLine deletes the entry at the line number. It reports whether the
+// entry was found.
+func (f *File) RemoveLine(n int) bool {
+	return f.lines.Remove(func(e *Entry) bool {
+		return e.Line == n
+	}) > 0
+}
+
+// Problem is an issue of a line of the file.
+type Problem struct {
+	// Line is the line number in the file, starting from 1.
+	Line int
+	// Text describes the issue.
+	Text string
+}
+
+// Validate returns the issues of the file: broken lines, entries which are
+// expired or not yet valid at the time, and repeated entries.
+func (f *File) Validate(now time.Time) []Problem {
+	var (
+		problems []Problem
+		seen     = map[string]int{}
+	)
+	for i, l := range f.lines.All() {
+		if l.Err != nil {
+			problems = append(problems, Problem{Line: i + 1, Text: l.Err.Error()})
+			continue
+		}
+		e := l.Entry
+		if e == nil {
+			continue
+		}
+
+		after, before, _ := e.Validity()
+		switch {
+		case !before.IsZero() && !now.Before(before):
+			problems = append(problems, Problem{Line: e.Line, Text: "expired " + before.Format(time.DateTime)})
+		case !after.IsZero() && now.Before(after):
+			problems = append(problems, Problem{Line: e.Line, Text: "not valid until " + after.Format(time.DateTime)})
+		}
+		if slices.Contains(e.Namespaces(), "") {
+			problems = append(problems, Problem{Line: e.Line, Text: "empty namespace"})
+		}
+
+		id := strings.Join(e.Principals, ",") + " " + string(e.Key.Marshal())
+		if first, ok := seen[id]; ok {
+			problems = append(problems, Problem{Line: e.Line, Text: fmt.Sprintf("duplicate of line %d", first)})
+		} else {
+			seen[id] = e.Line
+		}
+	}
+
+	return problems
+}
+
+// Save atomically replaces the file keeping its permissions, like the
+// 0644 ones shared with Git. A new file is created with 0600 permissions.
+func (f *File) Save() error {
+	if err := f.lines.Save(f.path); err != nil {
+		return fmt.Errorf("write allowed signers: %v", err)
+	}
+
+	return nil
+}
+
+// matchList matches the value against the patterns with * and ? wildcards,
+// like match_pattern_list of OpenSSH. A matching pattern prefixed with !
+// rejects the value.
+func matchList(patterns []string, value string) bool {
+	var matched bool
+	for _, pattern := range patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		if !matchPattern(strings.TrimPrefix(pattern, "!"), value) {
+			continue
+		}
+		if negate {
+			return false
+		}
+		matched = true
+	}
+
+	return matched
+}
+
+// matchPattern matches the value against the pattern, where * matches any
+// sequence of characters and ? any single character. Other characters match
+// themselves, case sensitively.
+func matchPattern(pattern, value string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := 0; i <= len(value); i++ {
+				if matchPattern(pattern[1:], value[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if value == "" {
+				return false
+			}
+		default:
+			if value == "" || pattern[0] != value[0] {
+				return false
+			}
+		}
+		pattern, value = pattern[1:], value[1:]
+	}
+
+	return value == ""
+}
@@ -0,0 +1,178 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+
+	return signer
+}
+
+func authorizedKey(pub ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+}
+
+func TestFile(t *testing.T) {
+	alice, bob, ca := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	path := filepath.Join(t.TempDir(), "allowed_signers")
+	data := fmt.Sprintf(`# team keys
+alice@example.com,alice@home namespaces="git" %s alice
+"bob@example.com" valid-before="20200101Z" %s
+*@example.com,!mallory@example.com cert-authority %s CA
+broken line
+`, authorizedKey(alice.PublicKey()), authorizedKey(bob.PublicKey()), authorizedKey(ca.PublicKey()))
+	require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+
+	f, err := Load(path)
+	require.NoError(t, err)
+	entries := f.Entries()
+	require.Len(t, entries, 3)
+	assert.Equal(t, []string{"alice@example.com", "alice@home"}, entries[0].Principals)
+	assert.Equal(t, []string{"git"}, entries[0].Namespaces())
+	assert.Equal(t, "alice", entries[0].Comment)
+	assert.Equal(t, 3, entries[1].Line)
+	assert.True(t, entries[2].CertAuthority())
+
+	now := time.Now()
+	assert.True(t, f.Allowed("alice@home", alice.PublicKey(), "git", now))
+	assert.False(t, f.Allowed("alice@home", alice.PublicKey(), "file", now))
+	assert.False(t, f.Allowed("bob@example.com", alice.PublicKey(), "git", now))
+	assert.Equal(t, []string{"alice@example.com", "alice@home"}, f.Principals(alice.PublicKey(), "git", now))
+	// The key of bob has expired.
+	assert.False(t, f.Allowed("bob@example.com", bob.PublicKey(), "git", now))
+
+	// Certificates are allowed by the CA for the principals of the
+	// certificate only.
+	for _, principal := range []string{"carol@example.com", "mallory@example.com"} {
+		cert := &ssh.Certificate{
+			Key:             newTestSigner(t).PublicKey(),
+			CertType:        ssh.UserCert,
+			ValidPrincipals: []string{principal},
+			ValidBefore:     ssh.CertTimeInfinity,
+		}
+		require.NoError(t, cert.SignCert(rand.Reader, ca))
+		assert.Equal(t, principal == "carol@example.com", f.Allowed(principal, cert, "git", now))
+		assert.False(t, f.Allowed("dave@example.com", cert, "git", now))
+	}
+	// The plain key of CA is not allowed.
+	assert.Empty(t, f.Principals(ca.PublicKey(), "git", now))
+}
+
+func TestParseTime(t *testing.T) {
+	got, err := ParseTime("20240229Z")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), got)
+	got, err = ParseTime("202402291530")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 2, 29, 15, 30, 0, 0, time.Local), got)
+	_, err = ParseTime("2024-02-29")
+	assert.Error(t, err)
+}
+
+func TestMatchList(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		value    string
+		want     bool
+	}{
+		{[]string{"*@example.com"}, "dev/team@example.com", true},
+		{[]string{"?ev/team@example.com"}, "dev/team@example.com", true},
+		{[]string{"[d]ev/team@example.com"}, "dev/team@example.com", false},
+		{[]string{"[d]ev@example.com"}, "[d]ev@example.com", true},
+		{[]string{`\*@example.com`}, "me@example.com", false},
+		{[]string{"Dev@example.com"}, "dev@example.com", false},
+		{[]string{"*@example.com", "!root@*"}, "root@example.com", false},
+		{[]string{"git", "file"}, "file", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matchList(tt.patterns, tt.value), "%v %s", tt.patterns, tt.value)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".ssh", "allowed_signers")
+	first, second := newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey()
+
+	f, err := Load(path)
+	require.NoError(t, err)
+	assert.Empty(t, f.Entries())
+
+	_, err = f.Add([]string{"me@example.com"}, first, []string{"git", "file"}, "laptop")
+	require.NoError(t, err)
+	_, err = f.Add([]string{"me@example.com"}, first, nil, "")
+	assert.ErrorIs(t, err, ErrDuplicate)
+	_, err = f.Add([]string{"me@work.example.com"}, first, nil, "")
+	require.NoError(t, err)
+	_, err = f.Add(nil, second, nil, "")
+	assert.Error(t, err)
+	_, err = f.Add([]string{"other@example.com"}, second, nil, "")
+	require.NoError(t, err)
+	require.NoError(t, f.Save())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Append a comment, a duplicate, an expired and a broken line by hand.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data = append(data, "# old laptop\n"...)
+	data = append(data, "other@example.com "+authorizedKey(second)+"\n"...)
+	data = append(data, `old@example.com valid-before="20200101" `+authorizedKey(second)+"\n"...)
+	data = append(data, "me@example.com ssh-ed25519 broken\n"...)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	f, err = Load(path)
+	require.NoError(t, err)
+	require.Len(t, f.Entries(), 5)
+	assert.Equal(t, []string{"git", "file"}, f.Entries()[0].Namespaces())
+	assert.True(t, f.Allowed("me@example.com", first, "git", time.Now()))
+
+	problems := f.Validate(time.Now())
+	require.Len(t, problems, 3)
+	assert.Equal(t, Problem{Line: 5, Text: "duplicate of line 3"}, problems[0])
+	assert.Equal(t, 6, problems[1].Line)
+	assert.Contains(t, problems[1].Text, "expired")
+	assert.Equal(t, 7, problems[2].Line)
+
+	assert.True(t, f.RemoveLine(1))
+	assert.False(t, f.RemoveLine(100))
+	assert.Equal(t, 3, f.Remove(ssh.FingerprintSHA256(second)))
+	require.NoError(t, f.Save())
+
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "me@work.example.com "+authorizedKey(first)+"\n# old laptop\nme@example.com ssh-ed25519 broken\n", string(data))
+}
@@ -0,0 +1,266 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sshconfig reads the host sections of ssh_config(5) files. Include
+// directives are not followed and Match sections never apply.
+package sshconfig
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Option is a keyword with its value. The keyword is lowercased, as the
+// keywords are case insensitive.
+type Option struct {
+	Key   string
+	Value string
+}
+
+// Section is a Host section with its options.
+type Section struct {
+	// Patterns are the host patterns, nil for Match sections.
+	Patterns []string
+	// Options are the options of the section in file order.
+	Options []Option
+}
+
+// Match reports whether the section applies to the host alias.
+func (s *Section) Match(alias string) bool {
+	var matched bool
+	for _, pattern := range s.Patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		ok, _ := path.Match(strings.ToLower(strings.TrimPrefix(pattern, "!")), strings.ToLower(alias))
+		if !ok {
+			continue
+		}
+		if negate {
+			return false
+		}
+		matched = true
+	}
+
+	return matched
+}
+
+// Config is a parsed ssh_config file.
+type Config struct {
+	Sections []*Section
+}
+
+// Load reads the ssh_config file. A missing file is treated as empty.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read ssh config: %v", err)
+	}
+
+	return Parse(data)
+}
+
+// Parse parses the ssh_config file data. Options before the first Host
+// section apply to all hosts.
+func Parse(data []byte) (*Config, error) {
+	global := &Section{Patterns: []string{"*"}}
+	c := &Config{Sections: []*Section{global}}
+	current := global
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, err := splitOption(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		switch key {
+		case "host":
+			current = &Section{Patterns: strings.Fields(value)}
+			c.Sections = append(c.Sections, current)
+		case "match":
+			current = &Section{}
+			c.Sections = append(c.Sections, current)
+		default:
+			current.Options = append(current.Options, Option{Key: key, Value: value})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read ssh config: %v", err)
+	}
+
+	return c, nil
+}
+
+// splitOption splits the "Keyword value" or "Keyword=value" line. Quotes
+// around the value are removed.
+func splitOption(line string) (string, string, error) {
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return "", "", fmt.Errorf("missing value of %s", line)
+	}
+	key := strings.ToLower(line[:i])
+	value := strings.TrimSpace(line[i:])
+	value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	if value == "" {
+		return "", "", fmt.Errorf("missing value of %s", key)
+	}
+
+	return key, value, nil
+}
+
+// Get returns the first value of the option for the host alias, like
+// ssh(1) does for most options.
+func (c *Config) Get(alias, key string) string {
+	if values := c.GetAll(alias, key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// GetAll returns all values of the option for the host alias, like
+// IdentityFile which accumulates.
+func (c *Config) GetAll(alias, key string) []string {
+	key = strings.ToLower(key)
+	var values []string
+	for _, s := range c.Sections {
+		if !s.Match(alias) {
+			continue
+		}
+		for _, opt := range s.Options {
+			if opt.Key == key {
+				values = append(values, opt.Value)
+			}
+		}
+	}
+
+	return values
+}
+
+// Aliases returns the host aliases named in the Host sections without
+// wildcards, in file order.
+func (c *Config) Aliases() []string {
+	var aliases []string
+	for _, s := range c.Sections {
+		for _, pattern := range s.Patterns {
+			if strings.ContainsAny(pattern, "*?!") || slices.Contains(aliases, pattern) {
+				continue
+			}
+			aliases = append(aliases, pattern)
+		}
+	}
+
+	return aliases
+}
+
+// IdentityFiles returns the expanded paths of identity files of the host
+// alias. The ~ prefix and %d, %h, %r, %u and %% tokens are expanded.
+func (c *Config) IdentityFiles(alias string) ([]string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("get user home dir: %v", err)
+	}
+	u, err := user.Current()
+	if err != nil {
+		return nil, fmt.Errorf("get current user: %v", err)
+	}
+	remoteUser := c.Get(alias, "user")
+	if remoteUser == "" {
+		remoteUser = u.Username
+	}
+	hostname := c.Get(alias, "hostname")
+	if hostname == "" {
+		hostname = alias
+	}
+
+	replacer := strings.NewReplacer("%%", "%", "%d", home, "%h", hostname, "%r", remoteUser, "%u", u.Username)
+	var files []string
+	for _, f := range c.GetAll(alias, "identityfile") {
+		if f == "~" || strings.HasPrefix(f, "~/") {
+			f = home + f[1:]
+		}
+		files = append(files, filepath.Clean(replacer.Replace(f)))
+	}
+
+	return files, nil
+}
+
+// HostsWithIdentity returns the host aliases which use the identity file.
+func (c *Config) HostsWithIdentity(file string) ([]string, error) {
+	file = filepath.Clean(file)
+	var aliases []string
+	for _, alias := range c.Aliases() {
+		files, err := c.IdentityFiles(alias)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(files, file) {
+			aliases = append(aliases, alias)
+		}
+	}
+
+	return aliases, nil
+}
+
+// IdentityAgents returns the expanded agent sockets of IdentityAgent options
+// of all sections, in file order without repeats. The values none and
+// SSH_AUTH_SOCK, which do not name a socket, are skipped. The ~ prefix, %d,
+// %u and %% tokens and environment variables are expanded.
+func (c *Config) IdentityAgents() ([]string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("get user home dir: %v", err)
+	}
+	u, err := user.Current()
+	if err != nil {
+		return nil, fmt.Errorf("get current user: %v", err)
+	}
+
+	replacer := strings.NewReplacer("%%", "%", "%d", home, "%u", u.Username)
+	var sockets []string
+	for _, s := range c.Sections {
+		for _, opt := range s.Options {
+			if opt.Key != "identityagent" || opt.Value == "none" || opt.Value == "SSH_AUTH_SOCK" {
+				continue
+			}
+			socket := os.ExpandEnv(opt.Value)
+			if socket == "~" || strings.HasPrefix(socket, "~/") {
+				socket = home + socket[1:]
+			}
+			socket = filepath.Clean(replacer.Replace(socket))
+			if !slices.Contains(sockets, socket) {
+				sockets = append(sockets, socket)
+			}
+		}
+	}
+
+	return sockets, nil
+}
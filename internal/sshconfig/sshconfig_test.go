@@ -0,0 +1,95 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `# personal settings
+IdentityFile ~/.ssh/id_default
+
+Host web db
+    HostName %h.example.com
+    User deploy
+    IdentityFile ~/.ssh/id_work
+
+Host *.example.com !legacy.example.com
+	Port=2222
+	IdentityFile "%d/.ssh/id_%r"
+
+Match host backup
+	IdentityFile ~/.ssh/id_work
+
+Host backup
+	User root
+	Port 22
+	IdentityAgent none
+
+Host work
+	IdentityAgent ~/.gnupg/S.gpg-agent.ssh
+
+Host *
+	IdentityAgent ${SSH_KEYS_TEST_SOCK}
+	IdentityAgent %d/.gnupg/S.gpg-agent.ssh
+`
+
+func TestConfig(t *testing.T) {
+	c, err := Parse([]byte(testConfig))
+	require.NoError(t, err)
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"web", "db", "backup", "work"}, c.Aliases())
+	assert.Equal(t, "deploy", c.Get("web", "User"))
+	assert.Equal(t, "2222", c.Get("git.example.com", "port"))
+	assert.Empty(t, c.Get("legacy.example.com", "port"))
+	assert.Equal(t, "22", c.Get("backup", "port"))
+
+	files, err := c.IdentityFiles("web")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(home, ".ssh", "id_default"),
+		filepath.Join(home, ".ssh", "id_work"),
+	}, files)
+
+	files, err = c.IdentityFiles("git.example.com")
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, filepath.Dir(files[0]), filepath.Dir(files[1]))
+
+	hosts, err := c.HostsWithIdentity(filepath.Join(home, ".ssh", "id_work"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"web", "db"}, hosts)
+
+	t.Setenv("SSH_KEYS_TEST_SOCK", "/tmp/agent.sock")
+	sockets, err := c.IdentityAgents()
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(home, ".gnupg", "S.gpg-agent.ssh"), "/tmp/agent.sock"}, sockets)
+
+	_, err = Parse([]byte("Host\n"))
+	assert.Error(t, err)
+
+	c, err = Load(filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, c.Aliases())
+}
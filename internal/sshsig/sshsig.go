@@ -0,0 +1,240 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sshsig signs and verifies data with SSH keys in the SSHSIG format
+// of ssh-keygen(1) -Y sign, which Git and other tools use.
+package sshsig
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// DefaultHash is the hash algorithm of new signatures, the same as
+	// ssh-keygen(1) uses.
+	DefaultHash = "sha512"
+	// DefaultNamespace is the namespace of signatures of files.
+	DefaultNamespace = "file"
+
+	magic       = "SSHSIG"
+	version     = 1
+	armorBegin  = "-----BEGIN SSH SIGNATURE-----"
+	armorEnd    = "-----END SSH SIGNATURE-----"
+	armorLength = 70
+)
+
+// ErrNamespace is returned when the signature was made for another
+// namespace.
+var ErrNamespace = errors.New("signature namespace mismatch")
+
+// Signature is a SSHSIG signature.
+type Signature struct {
+	// PublicKey is the key or certificate the signature was made with.
+	PublicKey ssh.PublicKey
+	// Namespace is the purpose of the signature, like git or file, so that
+	// signatures of one domain are not valid in another.
+	Namespace     string
+	HashAlgorithm string
+	Signature     *ssh.Signature
+}
+
+// signedData is the data which is actually signed, preceded by the magic.
+type signedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// wireSignature is the binary signature, preceded by the magic.
+type wireSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// Sign signs the message in the namespace. RSA keys sign with SHA-512, as
+// SHA-1 signatures are not accepted by ssh-keygen(1).
+func Sign(signer ssh.Signer, message io.Reader, namespace string) (*Signature, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("namespace is required")
+	}
+	data, err := dataToSign(message, namespace, DefaultHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig *ssh.Signature
+	as, ok := signer.(ssh.AlgorithmSigner)
+	if ok && isRSA(signer.PublicKey()) {
+		sig, err = as.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sign: %w", err)
+	}
+
+	return &Signature{
+		PublicKey:     signer.PublicKey(),
+		Namespace:     namespace,
+		HashAlgorithm: DefaultHash,
+		Signature:     sig,
+	}, nil
+}
+
+// Verify checks that the signature of the message was made in the namespace
+// by the key of the signature. It does not tell whether the key is trusted,
+// see the signers package for that.
+func Verify(sig *Signature, message io.Reader, namespace string) error {
+	if sig.Namespace != namespace {
+		return fmt.Errorf("%w: got %q, want %q", ErrNamespace, sig.Namespace, namespace)
+	}
+	if sig.Signature.Format == ssh.KeyAlgoRSA {
+		return fmt.Errorf("RSA signature with SHA-1 is not allowed")
+	}
+	data, err := dataToSign(message, namespace, sig.HashAlgorithm)
+	if err != nil {
+		return err
+	}
+	if err := sig.PublicKey.Verify(data, sig.Signature); err != nil {
+		return fmt.Errorf("verify signature: %w", err)
+	}
+
+	return nil
+}
+
+// Marshal returns the binary form of the signature.
+func (s *Signature) Marshal() []byte {
+	return append([]byte(magic), ssh.Marshal(wireSignature{
+		Version:       version,
+		PublicKey:     s.PublicKey.Marshal(),
+		Namespace:     s.Namespace,
+		HashAlgorithm: s.HashAlgorithm,
+		Signature:     ssh.Marshal(s.Signature),
+	})...)
+}
+
+// Armor returns the signature in the PEM-like armored form, which is written
+// to .sig files.
+func (s *Signature) Armor() []byte {
+	encoded := base64.StdEncoding.EncodeToString(s.Marshal())
+
+	var b bytes.Buffer
+	b.WriteString(armorBegin + "\n")
+	for len(encoded) > armorLength {
+		b.WriteString(encoded[:armorLength] + "\n")
+		encoded = encoded[armorLength:]
+	}
+	b.WriteString(encoded + "\n")
+	b.WriteString(armorEnd + "\n")
+
+	return b.Bytes()
+}
+
+// Parse parses the armored signature.
+func Parse(data []byte) (*Signature, error) {
+	text := strings.TrimSpace(string(data))
+	body, ok := strings.CutPrefix(text, armorBegin)
+	if !ok {
+		return nil, fmt.Errorf("missing %s", armorBegin)
+	}
+	body, ok = strings.CutSuffix(body, armorEnd)
+	if !ok {
+		return nil, fmt.Errorf("missing %s", armorEnd)
+	}
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return nil, fmt.Errorf("decode signature: %v", err)
+	}
+
+	return ParseBinary(blob)
+}
+
+// ParseBinary parses the binary signature.
+func ParseBinary(blob []byte) (*Signature, error) {
+	rest, ok := bytes.CutPrefix(blob, []byte(magic))
+	if !ok {
+		return nil, fmt.Errorf("not a SSHSIG signature")
+	}
+	var w wireSignature
+	if err := ssh.Unmarshal(rest, &w); err != nil {
+		return nil, fmt.Errorf("parse signature: %v", err)
+	}
+	if w.Version != version {
+		return nil, fmt.Errorf("unsupported signature version %d", w.Version)
+	}
+	pub, err := ssh.ParsePublicKey(w.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse signature key: %v", err)
+	}
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(w.Signature, &sig); err != nil {
+		return nil, fmt.Errorf("parse signature blob: %v", err)
+	}
+
+	return &Signature{
+		PublicKey:     pub,
+		Namespace:     w.Namespace,
+		HashAlgorithm: w.HashAlgorithm,
+		Signature:     &sig,
+	}, nil
+}
+
+// dataToSign hashes the message and returns the data to sign.
+func dataToSign(message io.Reader, namespace, algorithm string) ([]byte, error) {
+	var h hash.Hash
+	switch algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm %q", algorithm)
+	}
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, fmt.Errorf("read message: %v", err)
+	}
+
+	return append([]byte(magic), ssh.Marshal(signedData{
+		Namespace:     namespace,
+		HashAlgorithm: algorithm,
+		Hash:          h.Sum(nil),
+	})...), nil
+}
+
+// isRSA reports whether the key or the key of the certificate is RSA.
+func isRSA(pub ssh.PublicKey) bool {
+	if cert, ok := pub.(*ssh.Certificate); ok {
+		pub = cert.Key
+	}
+
+	return pub.Type() == ssh.KeyAlgoRSA
+}
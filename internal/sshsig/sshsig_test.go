@@ -0,0 +1,99 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sshsig
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+
+	"github.com/mixanemca/ssh-keys/internal/agents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// signature of "hello\n" in file namespace made by ssh-keygen -Y sign.
+const testSignature = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgjnr9WkNf8oFp9YQmWS4BHOEzZ7
+BPUvG0Zpiwlcei7FIAAAAEZmlsZQAAAAAAAAAGc2hhNTEyAAAAUwAAAAtzc2gtZWQyNTUx
+OQAAAEAPz8+UVR7LIcjQR3m7LgjzVFKbOHG63KB6mTx7ot9sD6ZojIp/tvKzkRSrGZ3Iu2
+PyOP5ylBa377VUTGtaS+sO
+-----END SSH SIGNATURE-----
+`
+
+func TestSignVerify(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	for _, key := range []any{edKey, rsaKey, ecKey} {
+		signer, err := ssh.NewSignerFromKey(key)
+		require.NoError(t, err)
+		t.Run(signer.PublicKey().Type(), func(t *testing.T) {
+			sig, err := Sign(signer, strings.NewReader("hello\n"), "git")
+			require.NoError(t, err)
+			if signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+				assert.Equal(t, ssh.KeyAlgoRSASHA512, sig.Signature.Format)
+			}
+
+			parsed, err := Parse(sig.Armor())
+			require.NoError(t, err)
+			assert.Equal(t, "git", parsed.Namespace)
+			assert.Equal(t, signer.PublicKey().Marshal(), parsed.PublicKey.Marshal())
+			require.NoError(t, Verify(parsed, strings.NewReader("hello\n"), "git"))
+
+			assert.Error(t, Verify(parsed, strings.NewReader("hello!\n"), "git"))
+			assert.ErrorIs(t, Verify(parsed, strings.NewReader("hello\n"), "file"), ErrNamespace)
+		})
+	}
+}
+
+func TestSignWithAgent(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyring := agent.NewKeyring().(agent.ExtendedAgent)
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: rsaKey}))
+	pub, err := ssh.NewPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+
+	sig, err := Sign(agents.NewSigner(keyring, pub), strings.NewReader("hello\n"), "file")
+	require.NoError(t, err)
+	assert.Equal(t, ssh.KeyAlgoRSASHA512, sig.Signature.Format)
+	assert.NoError(t, Verify(sig, strings.NewReader("hello\n"), "file"))
+}
+
+func TestParse(t *testing.T) {
+	sig, err := Parse([]byte(testSignature))
+	require.NoError(t, err)
+	assert.Equal(t, "file", sig.Namespace)
+	assert.Equal(t, "sha512", sig.HashAlgorithm)
+	assert.Equal(t, ssh.KeyAlgoED25519, sig.PublicKey.Type())
+	assert.NoError(t, Verify(sig, strings.NewReader("hello\n"), "file"))
+	assert.Equal(t, testSignature, string(sig.Armor()))
+
+	_, err = Parse([]byte("garbage"))
+	assert.Error(t, err)
+}
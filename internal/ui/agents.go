@@ -0,0 +1,219 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/fatih/color"
+	"github.com/mixanemca/ssh-keys/internal/agents"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentEndpoint is an SSH agent managed by the model with the keys loaded
+// to it.
+type agentEndpoint struct {
+	agents.Endpoint
+	// client is the client of the agent, nil until the agent is listed.
+	client agent.ExtendedAgent
+	// keys are the public keys loaded to the agent.
+	keys [][]byte
+	// identities are the keys listed by the agent with comments.
+	identities []*agent.Key
+}
+
+// holds reports whether the public key is loaded to the agent.
+func (e *agentEndpoint) holds(blob []byte) bool {
+	return slices.ContainsFunc(e.keys, func(data []byte) bool {
+		return bytes.Equal(data, blob)
+	})
+}
+
+// setClient replaces the client of the agent and closes the previous one,
+// so the refreshed agent does not keep the old connection open.
+func (e *agentEndpoint) setClient(client agent.ExtendedAgent) {
+	if c, ok := e.client.(io.Closer); ok && e.client != client {
+		c.Close()
+	}
+	e.client = client
+}
+
+// add marks the public keys as loaded to the agent.
+func (e *agentEndpoint) add(blobs [][]byte) {
+	e.keys = append(e.keys, blobs...)
+}
+
+// remove marks the public keys as removed from the agent.
+func (e *agentEndpoint) remove(blobs [][]byte) {
+	e.keys = slices.DeleteFunc(e.keys, func(data []byte) bool {
+		return slices.ContainsFunc(blobs, func(blob []byte) bool {
+			return bytes.Equal(data, blob)
+		})
+	})
+}
+
+// keyMovedMsg reports that the key was copied to another SSH agent and
+// removed from the current one when moved.
+type keyMovedMsg struct {
+	loaded keyLoadedMsg
+	// unloaded is set when the key was removed from the source agent.
+	unloaded *keyUnloadedMsg
+}
+
+// moveKeyToAgent loads the key to the target SSH agent and unloads it from
+// the source agent, if the key is moved and certLoaded is set.
+func moveKeyToAgent(from, to agent.ExtendedAgent, fromIndex, toIndex int, key *models.Key, opts loadOptions, unload, certLoaded bool) tea.Cmd {
+	return func() tea.Msg {
+		msg := loadKeyToAgent(to, toIndex, key, opts)()
+		loaded, ok := msg.(keyLoadedMsg)
+		if !ok {
+			return msg
+		}
+		if !unload {
+			return keyMovedMsg{loaded: loaded}
+		}
+
+		msg = unloadKeyFromAgent(from, fromIndex, key, certLoaded)()
+		unloaded, ok := msg.(keyUnloadedMsg)
+		if !ok {
+			return msg
+		}
+
+		return keyMovedMsg{loaded: loaded, unloaded: &unloaded}
+	}
+}
+
+// currentAgent returns the SSH agent the keys are loaded to.
+func (m *Model) currentAgent() *agentEndpoint {
+	return m.endpoints[m.agentIndex]
+}
+
+// syncAgent exposes the current SSH agent and marks the keys loaded to it.
+func (m *Model) syncAgent() {
+	e := m.currentAgent()
+	m.AgentClient, m.AgentKeys = e.client, e.keys
+	m.syncLoadedToAgent()
+}
+
+// updateMoved applies the copy or the move of the key between the agents.
+func (m *Model) updateMoved(msg keyMovedMsg) {
+	to := m.endpoints[msg.loaded.agent]
+	to.add(msg.loaded.blobs)
+	action := "copied"
+	if msg.unloaded != nil {
+		m.endpoints[msg.unloaded.agent].remove(msg.unloaded.blobs)
+		action = "moved"
+	}
+	m.syncAgent()
+	m.err, m.status = nil, fmt.Sprintf("Key was %s to ssh-agent %s", action, to.Name)
+}
+
+// handleSwitchAgent makes the next SSH agent current.
+func (m *Model) handleSwitchAgent() {
+	if len(m.endpoints) < 2 {
+		return
+	}
+	m.agentIndex = (m.agentIndex + 1) % len(m.endpoints)
+	m.syncAgent()
+	m.err, m.status = nil, fmt.Sprintf("Keys are loaded to ssh-agent %s", m.currentAgent().Name)
+}
+
+// handleMoveToAgent copies the selected key to another SSH agent and removes
+// it from the current one when move is set. The target agent is asked when
+// there are more than two agents.
+func (m *Model) handleMoveToAgent(move bool) tea.Cmd {
+	key := m.selectedKey()
+	if key == nil || len(m.endpoints) < 2 {
+		return nil
+	}
+	next := (m.agentIndex + 1) % len(m.endpoints)
+	if len(m.endpoints) == 2 {
+		return m.moveToAgent(key, next, move)
+	}
+
+	verb := "Copy"
+	if move {
+		verb = "Move"
+	}
+	m.prompt = &prompt{
+		label: fmt.Sprintf("%s %s to ssh-agent: ", verb, key.Name),
+		value: m.endpoints[next].Name,
+		submit: func(value string) tea.Cmd {
+			i := slices.IndexFunc(m.endpoints, func(e *agentEndpoint) bool { return e.Name == value })
+			if i < 0 {
+				m.err, m.status = fmt.Errorf("unknown ssh-agent %q", value), ""
+				return nil
+			}
+			return m.moveToAgent(key, i, move)
+		},
+	}
+
+	return nil
+}
+
+// moveToAgent returns the command to copy or move the key from the current
+// SSH agent to the agent with the index.
+func (m *Model) moveToAgent(key *models.Key, index int, move bool) tea.Cmd {
+	from, to := m.currentAgent(), m.endpoints[index]
+	if index == m.agentIndex {
+		return nil
+	}
+	if to.client == nil {
+		m.err, m.status = fmt.Errorf("ssh-agent %s is not available", to.Name), ""
+		return nil
+	}
+	unload := move && from.client != nil && from.holds(key.Public.Marshal())
+
+	return moveKeyToAgent(from.client, to.client, m.agentIndex, index, key, loadOptions{
+		certLifetime: m.certLifetime,
+		now:          m.now(),
+	}, unload, m.certLoaded(key))
+}
+
+// agentsHolding returns the names of SSH agents the key is loaded to.
+func (m *Model) agentsHolding(k *models.Key) []string {
+	blob := k.Public.Marshal()
+	var names []string
+	for _, e := range m.endpoints {
+		if e.holds(blob) {
+			names = append(names, e.Name)
+		}
+	}
+
+	return names
+}
+
+// renderAgents renders the list of SSH agents with the current one
+// highlighted.
+func (m *Model) renderAgents() string {
+	names := make([]string, 0, len(m.endpoints))
+	for i, e := range m.endpoints {
+		if i == m.agentIndex {
+			names = append(names, color.New(color.Bold).Sprintf("[%s]", e.Name))
+		} else {
+			names = append(names, e.Name)
+		}
+	}
+
+	return "Agents: " + strings.Join(names, " ")
+}
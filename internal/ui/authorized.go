@@ -0,0 +1,144 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/fatih/color"
+	"github.com/mixanemca/ssh-keys/internal/authorized"
+	"golang.org/x/crypto/ssh"
+)
+
+// authorizedKeysMsg carries the parsed authorized_keys file.
+type authorizedKeysMsg struct {
+	file *authorized.File
+}
+
+// loadAuthorizedKeys reads the authorized_keys file.
+func loadAuthorizedKeys(path string) tea.Cmd {
+	return func() tea.Msg {
+		f, err := authorized.Load(path)
+		if err != nil {
+			return errMsg{err}
+		}
+
+		return authorizedKeysMsg{file: f}
+	}
+}
+
+// authorizeKey appends the public key to the authorized_keys file.
+func authorizeKey(path string, pub ssh.PublicKey, comment string) tea.Cmd {
+	return func() tea.Msg {
+		f, err := authorized.Load(path)
+		if err != nil {
+			return errMsg{err}
+		}
+		if _, err := f.Add(pub, comment, nil); err != nil {
+			return errMsg{err}
+		}
+		if err := f.Save(); err != nil {
+			return errMsg{err}
+		}
+
+		return authorizedKeysMsg{file: f}
+	}
+}
+
+// unauthorizeKey removes the key with the fingerprint from the
+// authorized_keys file.
+func unauthorizeKey(path, fingerprint string) tea.Cmd {
+	return func() tea.Msg {
+		f, err := authorized.Load(path)
+		if err != nil {
+			return errMsg{err}
+		}
+		if f.Remove(fingerprint) == 0 {
+			return errMsg{fmt.Errorf("no entries with fingerprint %s", fingerprint)}
+		}
+		if err := f.Save(); err != nil {
+			return errMsg{err}
+		}
+
+		return authorizedKeysMsg{file: f}
+	}
+}
+
+// handleAuthorize authorizes the selected key.
+func (m *Model) handleAuthorize() tea.Cmd {
+	key := m.selectedKey()
+	if key == nil || m.authorizedPath == "" {
+		return nil
+	}
+
+	return authorizeKey(m.authorizedPath, key.Public, key.Comment)
+}
+
+// handleUnauthorize removes the selected authorized key.
+func (m *Model) handleUnauthorize() tea.Cmd {
+	entries := m.authorizedEntries()
+	if len(entries) == 0 {
+		return nil
+	}
+
+	return unauthorizeKey(m.authorizedPath, entries[m.authorizedIndex].Fingerprint())
+}
+
+// authorizedEntries returns the entries of authorized_keys file.
+func (m *Model) authorizedEntries() []*authorized.Entry {
+	if m.authorized == nil {
+		return nil
+	}
+
+	return m.authorized.Entries()
+}
+
+// authorizedView renders the tab with authorized keys.
+func (m *Model) authorizedView() ([]string, string) {
+	lines := []string{fmt.Sprintf("Authorized keys in %s:", m.authorizedPath)}
+
+	duplicates := map[*authorized.Entry]bool{}
+	if m.authorized != nil {
+		for _, group := range m.authorized.Duplicates() {
+			for _, e := range group {
+				duplicates[e] = true
+			}
+		}
+	}
+
+	for i, e := range m.authorizedEntries() {
+		cursor := "   "
+		if i == m.authorizedIndex {
+			cursor = "-> "
+		}
+		line := fmt.Sprintf("%s %s %s", e.Key.Type(), e.Fingerprint(), e.Comment)
+		if len(e.Options) > 0 {
+			line += " [" + strings.Join(e.Options, ",") + "]"
+		}
+		if duplicates[e] {
+			line += " " + color.YellowString("[duplicate]")
+		}
+		if e.Expired(m.now()) {
+			line += " " + color.RedString("[expired]")
+		}
+		lines = append(lines, cursor+line)
+	}
+
+	return lines, "Press d or delete to remove a key"
+}
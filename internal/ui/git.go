@@ -0,0 +1,71 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ui
+
+import (
+	"bytes"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mixanemca/ssh-keys/internal/gitconfig"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// gitSigningKeyMsg carries the key git signs commits with, nil if none.
+type gitSigningKeyMsg struct {
+	key ssh.PublicKey
+	// name is the name of the key which was just configured, if any.
+	name string
+}
+
+// loadGitSigningKey reads the signing key from git config.
+func loadGitSigningKey(g *gitconfig.Git) tea.Cmd {
+	return func() tea.Msg {
+		key, err := g.SigningKey()
+		if err != nil {
+			return errMsg{err}
+		}
+
+		return gitSigningKeyMsg{key: key}
+	}
+}
+
+// setGitSigningKey configures git globally to sign commits with the key.
+func setGitSigningKey(g *gitconfig.Git, key *models.Key, allowedSigners string) tea.Cmd {
+	return func() tea.Msg {
+		if err := g.Setup(gitconfig.ScopeGlobal, key, allowedSigners); err != nil {
+			return errMsg{err}
+		}
+
+		return gitSigningKeyMsg{key: key.Public, name: key.Name}
+	}
+}
+
+// handleGitSigningKey makes the selected key the git signing key.
+func (m *Model) handleGitSigningKey() tea.Cmd {
+	key := m.selectedKey()
+	if key == nil || m.git == nil {
+		return nil
+	}
+
+	return setGitSigningKey(m.git, key, m.signersPath)
+}
+
+// isGitSigningKey reports whether git signs commits with the key.
+func (m *Model) isGitSigningKey(k *models.Key) bool {
+	return m.gitSigningKey != nil && bytes.Equal(m.gitSigningKey.Marshal(), k.Public.Marshal())
+}
@@ -16,12 +16,37 @@ limitations under the License.
 
 package ui
 
-import tea "github.com/charmbracelet/bubbletea"
+import (
+	"bytes"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mixanemca/ssh-keys/internal/models"
+)
 
 // handleEnter handler for Enter/Return keypresses.
 func (m *Model) handleEnter(msg tea.Msg) tea.Cmd {
-	if m.Keys[m.selectedIndex].LoadedToAgent {
-		return unloadKeyFromAgent(m)
+	key := m.selectedKey()
+	if key == nil || m.AgentClient == nil {
+		return nil
+	}
+	if key.LoadedToAgent {
+		return unloadKeyFromAgent(m.AgentClient, m.agentIndex, key, m.certLoaded(key))
+	}
+	return loadKeyToAgent(m.AgentClient, m.agentIndex, key, loadOptions{
+		certLifetime: m.certLifetime,
+		now:          m.now(),
+	})
+}
+
+// certLoaded reports whether the certificate of the key is loaded to agent.
+func (m *Model) certLoaded(key *models.Key) bool {
+	if key.Certificate == nil {
+		return false
 	}
-	return loadKeyToAgent(m)
+	blob := key.Certificate.Marshal()
+
+	return slices.ContainsFunc(m.AgentKeys, func(data []byte) bool {
+		return bytes.Equal(data, blob)
+	})
 }
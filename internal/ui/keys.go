@@ -17,94 +17,209 @@ limitations under the License.
 package ui
 
 import (
-	"bytes"
-	"log"
-	"net"
-	"os"
-	"path/filepath"
+	"fmt"
+	"math"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mixanemca/ssh-keys/internal/agents"
 	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 )
 
-// findPrivateKeys finds the SSH private keys in user's home directory.
-func findPrivateKeys(m *Model) tea.Cmd {
+// privateKeysMsg carries the private keys found on disk.
+type privateKeysMsg struct {
+	keys []*models.Key
+}
+
+// vaultKeysMsg carries the private keys kept in the vault.
+type vaultKeysMsg struct {
+	keys []*models.Key
+}
+
+// agentKeysMsg carries the SSH agent client and the public keys loaded to it.
+type agentKeysMsg struct {
+	// agent is the index of the agent endpoint.
+	agent  int
+	client agent.ExtendedAgent
+	keys   [][]byte
+	// identities are the listed keys with their comments.
+	identities []*agent.Key
+}
+
+// keyLoadedMsg reports that the public keys and certificates were added to
+// the SSH agent.
+type keyLoadedMsg struct {
+	agent int
+	key   ssh.PublicKey
+	blobs [][]byte
+	// restricted are the destinations the key may be used for, if any.
+	restricted []string
+}
+
+// keyUnloadedMsg reports that the public keys and certificates were removed
+// from the SSH agent.
+type keyUnloadedMsg struct {
+	agent int
+	key   ssh.PublicKey
+	blobs [][]byte
+}
+
+// loadOptions holds the settings of adding keys to SSH agent.
+type loadOptions struct {
+	// certLifetime limits the key lifetime in agent by the certificate validity.
+	certLifetime bool
+	// now is the moment of loading.
+	now time.Time
+	// destinations restrict the use of the key to the hosts, if any.
+	destinations []agents.Destination
+}
+
+// errMsg reports a failure of a command.
+type errMsg struct {
+	err error
+}
+
+// Error implements error interface
+func (e errMsg) Error() string {
+	return e.err.Error()
+}
+
+// findPrivateKeys finds the SSH private keys in the key store.
+func findPrivateKeys(store keys.KeyStore) tea.Cmd {
 	return func() tea.Msg {
-		home, err := os.UserHomeDir()
+		found, err := store.List()
 		if err != nil {
-			log.Fatal("Failed to get user home dir: ", err)
+			return errMsg{fmt.Errorf("load private keys: %w", err)}
 		}
 
-		sshDir := filepath.Join(home, ".ssh")
+		return privateKeysMsg{keys: found}
+	}
+}
 
-		m.Keys, err = keys.LoadPrivateKeys(sshDir)
+// findVaultKeys finds the SSH private keys in the encrypted vault.
+func findVaultKeys(vault keys.KeyStore) tea.Cmd {
+	return func() tea.Msg {
+		found, err := vault.List()
 		if err != nil {
-			log.Fatal("Failed to load private keys: ", err)
+			return errMsg{fmt.Errorf("load vault keys: %w", err)}
 		}
 
-		return m
+		return vaultKeysMsg{keys: found}
 	}
 }
 
-// findAgentKeys finds the SSH keys, added to SSH agent.
-func findAgentKeys(m *Model) tea.Cmd {
+// findAgentKeys finds the SSH keys, added to SSH agent with the index.
+func findAgentKeys(e agents.Endpoint, client agent.ExtendedAgent, index int) tea.Cmd {
 	return func() tea.Msg {
-		// ssh-agent(1) provides a UNIX socket at $SSH_AUTH_SOCK.
-		socket := os.Getenv("SSH_AUTH_SOCK")
-		conn, err := net.Dial("unix", socket)
+		msg, err := listAgentKeys(e, client, index)
 		if err != nil {
-			log.Fatal("Failed to open SSH_AUTH_SOCK: ", err)
+			return errMsg{err}
 		}
 
-		m.AgentClient = agent.NewClient(conn)
-		keys, err := m.AgentClient.List()
+		return msg
+	}
+}
+
+// listAgentKeys lists the keys added to SSH agent. The client is reused when
+// set, otherwise the agent is connected.
+func listAgentKeys(e agents.Endpoint, client agent.ExtendedAgent, index int) (agentKeysMsg, error) {
+	if client == nil {
+		var err error
+		client, err = e.Provider.Connect()
 		if err != nil {
-			log.Fatal("Failed to get list of ssh keys from agent: ", err)
+			return agentKeysMsg{}, fmt.Errorf("connect to ssh-agent %s: %w", e.Name, err)
 		}
+	}
 
-		for _, k := range keys {
-			m.AgentKeys = append(m.AgentKeys, k.Blob)
-		}
+	list, err := client.List()
+	if err != nil {
+		return agentKeysMsg{}, fmt.Errorf("get list of ssh keys from agent %s: %w", e.Name, err)
+	}
 
-		return m
+	blobs := make([][]byte, 0, len(list))
+	for _, k := range list {
+		blobs = append(blobs, k.Blob)
 	}
+
+	return agentKeysMsg{agent: index, client: client, keys: blobs, identities: list}, nil
 }
 
-// loadKeyToAgent loads selected key to SSH agent and updates Model.
-func loadKeyToAgent(m *Model) tea.Cmd {
+// loadKeyToAgent loads the key to SSH agent. Like ssh-add(1), a valid
+// certificate of the key is added as well, as a separate identity.
+func loadKeyToAgent(client agent.ExtendedAgent, index int, key *models.Key, opts loadOptions) tea.Cmd {
 	return func() tea.Msg {
-		if err := m.AgentClient.Add(agent.AddedKey{
-			PrivateKey: m.Keys[m.selectedIndex].Private,
-			Comment:    m.Keys[m.selectedIndex].Comment,
-		}); err != nil {
-			log.Fatal("Failed to load key to ssh-agent: ", err)
+		if key.SecurityKey != nil {
+			// The agent needs the token to add the key, only ssh-add can do it.
+			return errMsg{fmt.Errorf("load key to ssh-agent: %s: %w, add it with ssh-add", key.Name, keys.ErrSecurityKey)}
+		}
+		added := agent.AddedKey{
+			PrivateKey: key.Private,
+			Comment:    key.Comment,
+		}
+
+		cert := key.Certificate
+		if cert != nil && keys.CertificateStatus(cert, opts.now) == keys.CertExpired {
+			cert = nil
+		}
+		var restricted []string
+		if len(opts.destinations) > 0 {
+			added.ConstraintExtensions = []agent.ConstraintExtension{agents.RestrictDestination(opts.destinations)}
+			for _, d := range opts.destinations {
+				restricted = append(restricted, d.String())
+			}
+		}
+
+		if err := client.Add(added); err != nil {
+			return errMsg{fmt.Errorf("load key to ssh-agent: %w", err)}
 		}
-		// Add the key to Model.
-		m.AgentKeys = append(m.AgentKeys, m.Keys[m.selectedIndex].Public.Marshal())
+		blobs := [][]byte{key.Public.Marshal()}
 
-		return m
+		if cert != nil {
+			added.Certificate = cert
+			// Only the certificate expires, the key itself stays usable.
+			if opts.certLifetime {
+				added.LifetimeSecs = certLifetime(cert, opts.now)
+			}
+			if err := client.Add(added); err != nil {
+				return errMsg{fmt.Errorf("load certificate to ssh-agent: %w", err)}
+			}
+			blobs = append(blobs, cert.Marshal())
+		}
+
+		return keyLoadedMsg{agent: index, key: key.Public, blobs: blobs, restricted: restricted}
+	}
+}
+
+// certLifetime returns the remaining validity of the certificate in seconds,
+// clamped to the agent limit. Certificates valid forever have no lifetime.
+func certLifetime(cert *ssh.Certificate, now time.Time) uint32 {
+	unix := uint64(now.Unix())
+	if cert.ValidBefore == ssh.CertTimeInfinity || cert.ValidBefore <= unix {
+		return 0
 	}
+
+	return uint32(min(cert.ValidBefore-unix, math.MaxUint32))
 }
 
-// unloadKeyFromAgent removes selected key from SSH agent and updates Model.
-func unloadKeyFromAgent(m *Model) tea.Cmd {
+// unloadKeyFromAgent removes the key from SSH agent. The certificate of the
+// key is removed too when certLoaded is set.
+func unloadKeyFromAgent(client agent.ExtendedAgent, index int, key *models.Key, certLoaded bool) tea.Cmd {
 	return func() tea.Msg {
-		// Unload the key from agent.
-		err := m.AgentClient.Remove(m.Keys[m.selectedIndex].Public)
-		if err != nil {
-			log.Fatal("Failed to unload key from ssh-agent: ", err)
+		if err := client.Remove(key.Public); err != nil {
+			return errMsg{fmt.Errorf("unload key from ssh-agent: %w", err)}
 		}
+		blobs := [][]byte{key.Public.Marshal()}
 
-		m.Keys[m.selectedIndex].LoadedToAgent = false
-
-		// Remove the key from Model.
-		for i, ak := range m.AgentKeys {
-			if bytes.Equal(ak, m.Keys[m.selectedIndex].Public.Marshal()) {
-				m.AgentKeys = append(m.AgentKeys[:i], m.AgentKeys[i+1:]...)
+		if certLoaded {
+			if err := client.Remove(key.Certificate); err != nil {
+				return errMsg{fmt.Errorf("unload certificate from ssh-agent: %w", err)}
 			}
+			blobs = append(blobs, key.Certificate.Marshal())
 		}
 
-		return m
+		return keyUnloadedMsg{agent: index, key: key.Public, blobs: blobs}
 	}
 }
@@ -0,0 +1,132 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/fatih/color"
+	"github.com/mixanemca/ssh-keys/internal/hosts"
+)
+
+// knownHostsMsg carries the parsed known_hosts file.
+type knownHostsMsg struct {
+	file *hosts.File
+}
+
+// loadKnownHosts reads the known_hosts file.
+func loadKnownHosts(path string) tea.Cmd {
+	return func() tea.Msg {
+		f, err := hosts.Load(path)
+		if err != nil {
+			return errMsg{err}
+		}
+
+		return knownHostsMsg{file: f}
+	}
+}
+
+// removeKnownHost removes the entry at the line from the known_hosts file.
+// The fingerprint guards against removing a wrong entry when the file was
+// changed since it was loaded.
+func removeKnownHost(path string, line int, fingerprint string) tea.Cmd {
+	return func() tea.Msg {
+		f, err := hosts.Load(path)
+		if err != nil {
+			return errMsg{err}
+		}
+		i := slices.IndexFunc(f.Entries(), func(e *hosts.Entry) bool {
+			return e.Line == line && e.Fingerprint() == fingerprint
+		})
+		if i < 0 || !f.RemoveLine(line) {
+			return errMsg{fmt.Errorf("%s changed, refresh and try again", path)}
+		}
+		if err := f.Save(); err != nil {
+			return errMsg{err}
+		}
+
+		return knownHostsMsg{file: f}
+	}
+}
+
+// handleRemoveKnownHost removes the selected known_hosts entry.
+func (m *Model) handleRemoveKnownHost() tea.Cmd {
+	entries := m.knownHostsEntries()
+	if len(entries) == 0 {
+		return nil
+	}
+	e := entries[m.knownHostsIndex]
+
+	return removeKnownHost(m.knownHostsPath, e.Line, e.Fingerprint())
+}
+
+// handleSearchHost opens the prompt to filter known hosts by hostname.
+func (m *Model) handleSearchHost() {
+	m.prompt = &prompt{
+		label: "Search host: ",
+		value: m.hostsQuery,
+		change: func(value string) {
+			m.hostsQuery = value
+			m.clampCursor()
+		},
+	}
+}
+
+// knownHostsEntries returns the entries of known_hosts file matching the
+// search query, or all of them when there is no query.
+func (m *Model) knownHostsEntries() []*hosts.Entry {
+	if m.knownHosts == nil {
+		return nil
+	}
+	if m.hostsQuery == "" {
+		return m.knownHosts.Entries()
+	}
+
+	return m.knownHosts.Search(m.hostsQuery)
+}
+
+// knownHostsView renders the tab with known hosts.
+func (m *Model) knownHostsView() ([]string, string) {
+	lines := []string{fmt.Sprintf("Known hosts in %s:", m.knownHostsPath)}
+	if m.hostsQuery != "" && m.prompt == nil {
+		lines = append(lines, "Search: "+m.hostsQuery)
+	}
+
+	for i, e := range m.knownHostsEntries() {
+		cursor := "   "
+		if i == m.knownHostsIndex {
+			cursor = "-> "
+		}
+		names := strings.Join(e.Hosts, ",")
+		if e.Hashed() {
+			names = "(hashed)"
+		}
+		line := fmt.Sprintf("%s %s %s", names, e.Key.Type(), e.Fingerprint())
+		switch e.Marker {
+		case hosts.MarkerRevoked:
+			line = color.RedString("@%s ", e.Marker) + line
+		case hosts.MarkerCertAuthority:
+			line = color.YellowString("@%s ", e.Marker) + line
+		}
+		lines = append(lines, cursor+line)
+	}
+
+	return lines, "Press / to search a host, d or delete to remove an entry"
+}
@@ -0,0 +1,146 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/fatih/color"
+	"github.com/mixanemca/ssh-keys/internal/metadata"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// metadataMsg carries the metadata file.
+type metadataMsg struct {
+	store *metadata.Store
+}
+
+// loadMetadata reads the metadata file.
+func loadMetadata(path string) tea.Cmd {
+	return func() tea.Msg {
+		s, err := metadata.Load(path)
+		if err != nil {
+			return errMsg{err}
+		}
+
+		return metadataMsg{store: s}
+	}
+}
+
+// saveMetadata replaces the metadata of the key with the fingerprint.
+func saveMetadata(path, fingerprint string, md models.Metadata) tea.Cmd {
+	return func() tea.Msg {
+		s, err := metadata.Load(path)
+		if err != nil {
+			return errMsg{err}
+		}
+		s.Set(fingerprint, md)
+		if err := s.Save(); err != nil {
+			return errMsg{err}
+		}
+
+		return metadataMsg{store: s}
+	}
+}
+
+// syncMetadata fills the metadata of the keys.
+func (m *Model) syncMetadata() {
+	if m.metadata == nil {
+		return
+	}
+	m.metadata.Apply(m.Keys)
+	m.metadata.Apply(m.VaultKeys)
+}
+
+// handleEditMetadata asks for the metadata fields of the selected key one
+// by one and saves them after the last one.
+func (m *Model) handleEditMetadata() {
+	key := m.selectedKey()
+	if key == nil || m.metadataPath == "" {
+		return
+	}
+	fp := ssh.FingerprintSHA256(key.Public)
+	md := key.Metadata
+	md.Tags = append([]string(nil), md.Tags...)
+
+	var expires string
+	if !md.Expires.IsZero() {
+		expires = md.Expires.Format(metadata.DateLayout)
+	}
+	fields := []struct {
+		label string
+		value string
+		set   func(value string) error
+	}{
+		{"Tags (comma separated)", strings.Join(md.Tags, ", "), func(v string) error {
+			md.Tags = metadata.ParseTags(v)
+			return nil
+		}},
+		{"Owner", md.Owner, func(v string) error {
+			md.Owner = strings.TrimSpace(v)
+			return nil
+		}},
+		{"Purpose", md.Purpose, func(v string) error {
+			md.Purpose = strings.TrimSpace(v)
+			return nil
+		}},
+		{"Notes", md.Notes, func(v string) error {
+			md.Notes = strings.TrimSpace(v)
+			return nil
+		}},
+		{"Expires (YYYY-MM-DD)", expires, func(v string) (err error) {
+			md.Expires, err = metadata.ParseDate(strings.TrimSpace(v))
+			return err
+		}},
+	}
+
+	var next func(i int)
+	next = func(i int) {
+		f := fields[i]
+		m.prompt = &prompt{
+			label: fmt.Sprintf("%s of %s: ", f.label, key.Name),
+			value: f.value,
+			submit: func(value string) tea.Cmd {
+				if err := f.set(value); err != nil {
+					return func() tea.Msg { return errMsg{err} }
+				}
+				if i+1 < len(fields) {
+					next(i + 1)
+					return nil
+				}
+				return saveMetadata(m.metadataPath, fp, md)
+			},
+		}
+	}
+	next(0)
+}
+
+// renderMetadata renders the tags and the expiry of the key for the list.
+func (m *Model) renderMetadata(md models.Metadata) string {
+	var line string
+	if len(md.Tags) > 0 {
+		line += " " + color.CyanString("[%s]", strings.Join(md.Tags, ", "))
+	}
+	if md.Expired(m.now()) {
+		line += " " + color.RedString("[expired %s]", md.Expires.Format(metadata.DateLayout))
+	}
+
+	return line
+}
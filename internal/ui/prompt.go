@@ -0,0 +1,81 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// prompt is a single line text input shown below the current tab. While
+// it is open, it takes all keypresses.
+type prompt struct {
+	// label is shown before the value.
+	label string
+	// value is the text typed so far.
+	value string
+	// secret hides the value, like a PIN.
+	secret bool
+	// change is called after each edit of the value. Optional.
+	change func(value string)
+	// submit returns the command to run with the entered value. Optional.
+	submit func(value string) tea.Cmd
+}
+
+// handlePromptKey edits the value of the open prompt. Enter submits the
+// value and Esc cancels the prompt.
+func (m *Model) handlePromptKey(msg tea.KeyMsg) tea.Cmd {
+	p := m.prompt
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return tea.Quit
+	case tea.KeyEsc:
+		m.prompt = nil
+		return nil
+	case tea.KeyEnter:
+		m.prompt = nil
+		if p.submit != nil {
+			return p.submit(p.value)
+		}
+		return nil
+	case tea.KeyBackspace:
+		if runes := []rune(p.value); len(runes) > 0 {
+			p.value = string(runes[:len(runes)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		p.value += string(msg.Runes)
+	default:
+		return nil
+	}
+	if p.change != nil {
+		p.change(p.value)
+	}
+
+	return nil
+}
+
+// promptView renders the open prompt with a cursor. Secret values are
+// masked.
+func (m *Model) promptView() string {
+	value := m.prompt.value
+	if m.prompt.secret {
+		value = strings.Repeat("*", len([]rune(value)))
+	}
+
+	return m.prompt.label + value + "_"
+}
@@ -0,0 +1,156 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mixanemca/ssh-keys/internal/agents"
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/mixanemca/ssh-keys/internal/remote"
+	"golang.org/x/crypto/ssh"
+)
+
+// keyCopiedMsg is sent when the key is deployed to a remote host.
+type keyCopiedMsg struct {
+	name   string
+	key    ssh.PublicKey
+	target remote.Target
+	added  bool
+}
+
+// copyKeyID adds the public key to authorized_keys on the remote host.
+func copyKeyID(d *remote.Dialer, name string, pub ssh.PublicKey, comment, destination string) tea.Cmd {
+	return func() tea.Msg {
+		target, err := remote.ParseTarget(destination)
+		if err != nil {
+			return errMsg{err}
+		}
+		client, err := d.Dial(target)
+		if err != nil {
+			return errMsg{err}
+		}
+		defer client.Close()
+
+		added, err := remote.CopyID(client, pub, comment)
+		if err != nil {
+			return errMsg{err}
+		}
+
+		return keyCopiedMsg{name: name, key: pub, target: target, added: added}
+	}
+}
+
+// handleCopyID asks for the destination to copy the selected key to.
+func (m *Model) handleCopyID() {
+	key := m.selectedKey()
+	if key == nil || m.dialer == nil {
+		return
+	}
+	name, pub, comment := key.Name, key.Public, key.Comment
+
+	m.prompt = &prompt{
+		label: fmt.Sprintf("Copy %s to (user@host[:port]): ", name),
+		submit: func(value string) tea.Cmd {
+			return copyKeyID(m.agentDialer(), name, pub, comment, value)
+		},
+	}
+}
+
+// agentDialer returns the dialer authenticating with the keys of the current
+// SSH agent, the one the user has selected.
+func (m *Model) agentDialer() *remote.Dialer {
+	d := *m.dialer
+	d.Signers = nil
+	if client := m.currentAgent().client; client != nil {
+		d.Signers = client.Signers
+	}
+
+	return &d
+}
+
+// keySigner returns the signer of the key. The key signs through the SSH
+// agent holding it, the current one first, and directly otherwise.
+func (m *Model) keySigner(key *models.Key) (ssh.Signer, error) {
+	blob := key.Public.Marshal()
+	for _, e := range append([]*agentEndpoint{m.currentAgent()}, m.endpoints...) {
+		if e.client != nil && e.holds(blob) {
+			return agents.NewSigner(e.client, key.Public), nil
+		}
+	}
+
+	return keys.NewSigner(key)
+}
+
+// keyTestedMsg is sent when the key was tested against a remote host.
+type keyTestedMsg struct {
+	name   string
+	key    ssh.PublicKey
+	target remote.Target
+	result *remote.TestResult
+}
+
+// testKey tries to log in to the remote host with the key alone.
+func testKey(d *remote.Dialer, name string, signer ssh.Signer, destination string) tea.Cmd {
+	return func() tea.Msg {
+		target, err := remote.ParseTarget(destination)
+		if err != nil {
+			return errMsg{err}
+		}
+		result, err := d.TestKey(target, signer)
+		if err != nil {
+			return errMsg{err}
+		}
+
+		return keyTestedMsg{name: name, key: signer.PublicKey(), target: target, result: result}
+	}
+}
+
+// handleTestKey asks for the destination to test the selected key against.
+func (m *Model) handleTestKey() {
+	key := m.selectedKey()
+	if key == nil || m.dialer == nil {
+		return
+	}
+	signer, err := m.keySigner(key)
+	if err != nil {
+		m.err, m.status = err, ""
+		return
+	}
+	name := key.Name
+
+	m.prompt = &prompt{
+		label: fmt.Sprintf("Test %s against (user@host[:port]): ", name),
+		submit: func(value string) tea.Cmd {
+			return testKey(m.agentDialer(), name, signer, value)
+		},
+	}
+}
+
+// describeTest describes the result of the key test.
+func describeTest(msg keyTestedMsg) string {
+	verdict := "is not accepted by"
+	if msg.result.Accepted {
+		verdict = "is accepted by"
+	}
+
+	return fmt.Sprintf("Key %s %s %s (host key %s, offered methods: %s)",
+		msg.name, verdict, msg.target, ssh.FingerprintSHA256(msg.result.HostKey), strings.Join(msg.result.Methods, ", "))
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mixanemca/ssh-keys/internal/agents"
+	"github.com/mixanemca/ssh-keys/internal/hosts"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// loadRestrictedKey looks up the host keys of the destinations in the
+// known_hosts file and loads the key to SSH agent, allowing to use it only
+// for the destinations.
+func loadRestrictedKey(client agent.ExtendedAgent, index int, key *models.Key, opts loadOptions, knownHosts string, specs []string) tea.Cmd {
+	return func() tea.Msg {
+		f, err := hosts.Load(knownHosts)
+		if err != nil {
+			return errMsg{err}
+		}
+		for _, spec := range specs {
+			d, err := agents.ParseDestination(spec, knownHostKeys(f))
+			if err != nil {
+				return errMsg{fmt.Errorf("restrict %s: %w", key.Name, err)}
+			}
+			opts.destinations = append(opts.destinations, d)
+		}
+
+		return loadKeyToAgent(client, index, key, opts)()
+	}
+}
+
+// knownHostKeys returns the lookup of the host keys and authorities in the
+// known_hosts file. Revoked keys are skipped.
+func knownHostKeys(f *hosts.File) func(host string) ([]agents.HostKey, error) {
+	return func(host string) ([]agents.HostKey, error) {
+		var keys []agents.HostKey
+		for _, e := range f.Search(host) {
+			if e.Marker == hosts.MarkerRevoked {
+				continue
+			}
+			keys = append(keys, agents.HostKey{Key: e.Key, CA: e.Marker == hosts.MarkerCertAuthority})
+		}
+
+		return keys, nil
+	}
+}
+
+// handleLoadRestricted asks for the destinations and loads the selected key
+// to SSH agent restricted to them, like ssh-add -h.
+func (m *Model) handleLoadRestricted() {
+	key := m.selectedKey()
+	if key == nil || m.AgentClient == nil || m.knownHostsPath == "" {
+		return
+	}
+	client, index := m.AgentClient, m.agentIndex
+
+	m.prompt = &prompt{
+		label: fmt.Sprintf("Load %s for hosts (host, user@host or jump>host, comma separated): ", key.Name),
+		submit: func(value string) tea.Cmd {
+			specs := splitList(value)
+			if len(specs) == 0 {
+				return nil
+			}
+			return loadRestrictedKey(client, index, key, loadOptions{
+				certLifetime: m.certLifetime,
+				now:          m.now(),
+			}, m.knownHostsPath, specs)
+		},
+	}
+}
+
+// describeRestricted describes the destinations the key was loaded for.
+func describeRestricted(destinations []string) string {
+	return fmt.Sprintf("Key may be used only for %s", strings.Join(destinations, ", "))
+}
@@ -0,0 +1,186 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/fatih/color"
+	"github.com/mixanemca/ssh-keys/internal/signers"
+	"golang.org/x/crypto/ssh"
+)
+
+// allowedSignersMsg carries the parsed allowed_signers file.
+type allowedSignersMsg struct {
+	file *signers.File
+}
+
+// loadAllowedSigners reads the allowed_signers file.
+func loadAllowedSigners(path string) tea.Cmd {
+	return func() tea.Msg {
+		f, err := signers.Load(path)
+		if err != nil {
+			return errMsg{err}
+		}
+
+		return allowedSignersMsg{file: f}
+	}
+}
+
+// allowSigner appends the key for the principals to the allowed_signers
+// file.
+func allowSigner(path string, principals []string, pub ssh.PublicKey, namespaces []string, comment string) tea.Cmd {
+	return func() tea.Msg {
+		f, err := signers.Load(path)
+		if err != nil {
+			return errMsg{err}
+		}
+		if _, err := f.Add(principals, pub, namespaces, comment); err != nil {
+			return errMsg{err}
+		}
+		if err := f.Save(); err != nil {
+			return errMsg{err}
+		}
+
+		return allowedSignersMsg{file: f}
+	}
+}
+
+// removeSigner removes the entry at the line from the allowed_signers file.
+// The fingerprint guards against removing a wrong entry when the file was
+// changed since it was loaded.
+func removeSigner(path string, line int, fingerprint string) tea.Cmd {
+	return func() tea.Msg {
+		f, err := signers.Load(path)
+		if err != nil {
+			return errMsg{err}
+		}
+		i := slices.IndexFunc(f.Entries(), func(e *signers.Entry) bool {
+			return e.Line == line && e.Fingerprint() == fingerprint
+		})
+		if i < 0 || !f.RemoveLine(line) {
+			return errMsg{fmt.Errorf("%s changed, refresh and try again", path)}
+		}
+		if err := f.Save(); err != nil {
+			return errMsg{err}
+		}
+
+		return allowedSignersMsg{file: f}
+	}
+}
+
+// handleAllowSigner asks for the principals and the namespaces of the
+// selected key and adds it to the allowed_signers file.
+func (m *Model) handleAllowSigner() {
+	key := m.selectedKey()
+	if key == nil || m.signersPath == "" {
+		return
+	}
+	pub, comment := key.Public, key.Comment
+
+	m.prompt = &prompt{
+		label: fmt.Sprintf("Principals of %s (comma separated emails): ", key.Name),
+		submit: func(value string) tea.Cmd {
+			principals := splitList(value)
+			m.prompt = &prompt{
+				label: fmt.Sprintf("Namespaces of %s (comma separated, empty for any): ", key.Name),
+				value: "git",
+				submit: func(value string) tea.Cmd {
+					return allowSigner(m.signersPath, principals, pub, splitList(value), comment)
+				},
+			}
+			return nil
+		},
+	}
+}
+
+// handleRemoveSigner removes the selected allowed signer.
+func (m *Model) handleRemoveSigner() tea.Cmd {
+	entries := m.signersEntries()
+	if len(entries) == 0 {
+		return nil
+	}
+	e := entries[m.signersIndex]
+
+	return removeSigner(m.signersPath, e.Line, e.Fingerprint())
+}
+
+// signersEntries returns the entries of allowed_signers file.
+func (m *Model) signersEntries() []*signers.Entry {
+	if m.signers == nil {
+		return nil
+	}
+
+	return m.signers.Entries()
+}
+
+// signersView renders the tab with allowed signers.
+func (m *Model) signersView() ([]string, string) {
+	lines := []string{fmt.Sprintf("Allowed signers in %s:", m.signersPath)}
+
+	names := map[string]string{}
+	for _, k := range append(slices.Clone(m.Keys), m.VaultKeys...) {
+		names[ssh.FingerprintSHA256(k.Public)] = k.Name
+	}
+
+	for i, e := range m.signersEntries() {
+		cursor := "   "
+		if i == m.signersIndex {
+			cursor = "-> "
+		}
+		line := fmt.Sprintf("%s %s %s", strings.Join(e.Principals, ","), e.Key.Type(), e.Fingerprint())
+		if name, ok := names[e.Fingerprint()]; ok {
+			line += " (" + name + ")"
+		}
+		if namespaces := e.Namespaces(); namespaces != nil {
+			line += " [" + strings.Join(namespaces, ",") + "]"
+		}
+		if e.CertAuthority() {
+			line += " " + color.YellowString("[cert-authority]")
+		}
+		if !e.Valid(m.now()) {
+			line += " " + color.RedString("[invalid now]")
+		}
+		lines = append(lines, cursor+line)
+	}
+
+	if m.signers != nil {
+		if problems := m.signers.Validate(m.now()); len(problems) > 0 {
+			lines = append(lines, "", "Problems:")
+			for _, p := range problems {
+				lines = append(lines, "   "+color.RedString("line %d: %s", p.Line, p.Text))
+			}
+		}
+	}
+
+	return lines, "Press d or delete to remove an entry"
+}
+
+// splitList splits the comma separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
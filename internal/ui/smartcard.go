@@ -0,0 +1,199 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mixanemca/ssh-keys/internal/agents"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// smartcardMsg reports that the keys of the PKCS#11 provider were added to
+// or removed from SSH agent. It carries the keys of the agent after the
+// change.
+type smartcardMsg struct {
+	provider string
+	added    bool
+	agent    agentKeysMsg
+}
+
+// addSmartcard adds the keys of the PKCS#11 provider to SSH agent with the
+// index.
+func addSmartcard(e agents.Endpoint, client agent.ExtendedAgent, index int, provider, pin string) tea.Cmd {
+	return func() tea.Msg {
+		sp, ok := e.Provider.(agents.SmartcardProvider)
+		if !ok {
+			return errMsg{fmt.Errorf("ssh-agent %s does not support PKCS#11 providers", e.Name)}
+		}
+		if err := sp.AddSmartcardKey(provider, pin); err != nil {
+			return errMsg{fmt.Errorf("add PKCS#11 provider: %w", err)}
+		}
+		msg, err := listAgentKeys(e, client, index)
+		if err != nil {
+			return errMsg{err}
+		}
+
+		return smartcardMsg{provider: provider, added: true, agent: msg}
+	}
+}
+
+// removeSmartcard removes the keys of the PKCS#11 provider from SSH agent
+// with the index.
+func removeSmartcard(e agents.Endpoint, client agent.ExtendedAgent, index int, provider string) tea.Cmd {
+	return func() tea.Msg {
+		sp, ok := e.Provider.(agents.SmartcardProvider)
+		if !ok {
+			return errMsg{fmt.Errorf("ssh-agent %s does not support PKCS#11 providers", e.Name)}
+		}
+		if err := sp.RemoveSmartcardKey(provider); err != nil {
+			return errMsg{fmt.Errorf("remove PKCS#11 provider: %w", err)}
+		}
+		msg, err := listAgentKeys(e, client, index)
+		if err != nil {
+			return errMsg{err}
+		}
+
+		return smartcardMsg{provider: provider, agent: msg}
+	}
+}
+
+// updateSmartcard applies the change of the agent keys. The keys which
+// appeared in the agent are attributed to the added provider.
+func (m *Model) updateSmartcard(msg smartcardMsg) {
+	if m.smartcards == nil {
+		m.smartcards = make(map[string]string)
+	}
+	e := m.endpoints[msg.agent.agent]
+	if msg.added {
+		var added int
+		for _, k := range msg.agent.identities {
+			if !e.holds(k.Blob) {
+				m.smartcards[string(k.Blob)] = msg.provider
+				added++
+			}
+		}
+		m.err, m.status = nil, fmt.Sprintf("Added %d keys of %s to ssh-agent %s", added, msg.provider, e.Name)
+	} else {
+		for blob, provider := range m.smartcards {
+			if provider == msg.provider {
+				delete(m.smartcards, blob)
+			}
+		}
+		m.err, m.status = nil, fmt.Sprintf("Removed keys of %s from ssh-agent %s", msg.provider, e.Name)
+	}
+
+	e.setClient(msg.agent.client)
+	e.keys, e.identities = msg.agent.keys, msg.agent.identities
+	m.syncAgent()
+}
+
+// handleAddSmartcard asks for the PKCS#11 provider library and its PIN and
+// adds the keys of the provider to SSH agent, like ssh-add -s.
+func (m *Model) handleAddSmartcard() {
+	if !m.supportsSmartcards() {
+		return
+	}
+	e, index := m.currentAgent().Endpoint, m.agentIndex
+
+	m.prompt = &prompt{
+		label: "PKCS#11 provider to add: ",
+		value: m.lastSmartcard,
+		submit: func(provider string) tea.Cmd {
+			if provider == "" {
+				return nil
+			}
+			m.lastSmartcard = provider
+			m.prompt = &prompt{
+				label:  fmt.Sprintf("PIN for %s: ", provider),
+				secret: true,
+				submit: func(pin string) tea.Cmd {
+					return addSmartcard(e, m.endpoints[index].client, index, provider, pin)
+				},
+			}
+			return nil
+		},
+	}
+}
+
+// handleRemoveSmartcard asks for the PKCS#11 provider library and removes
+// its keys from SSH agent, like ssh-add -e.
+func (m *Model) handleRemoveSmartcard() {
+	if !m.supportsSmartcards() {
+		return
+	}
+	e, index := m.currentAgent().Endpoint, m.agentIndex
+
+	m.prompt = &prompt{
+		label: "PKCS#11 provider to remove: ",
+		value: m.lastSmartcard,
+		submit: func(provider string) tea.Cmd {
+			if provider == "" {
+				return nil
+			}
+			m.lastSmartcard = provider
+			return removeSmartcard(e, m.endpoints[index].client, index, provider)
+		},
+	}
+}
+
+// smartcardKeys returns the keys of SSH agent which do not belong to the
+// private keys or the vault, like the keys of PKCS#11 providers.
+func (m *Model) smartcardKeys() []*agent.Key {
+	var blobs [][]byte
+	for _, k := range slices.Concat(m.Keys, m.VaultKeys) {
+		blobs = append(blobs, k.Public.Marshal())
+		if k.Certificate != nil {
+			blobs = append(blobs, k.Certificate.Marshal())
+		}
+	}
+
+	var list []*agent.Key
+	for _, k := range m.currentAgent().identities {
+		loaded := m.currentAgent().holds(k.Blob)
+		known := slices.ContainsFunc(blobs, func(data []byte) bool { return bytes.Equal(data, k.Blob) })
+		if loaded && !known {
+			list = append(list, k)
+		}
+	}
+
+	return list
+}
+
+// renderSmartcardKey renders the line of the agent key with the PKCS#11
+// provider it was added from, when known.
+func (m *Model) renderSmartcardKey(k *agent.Key) string {
+	line := fmt.Sprintf("   %s %s", k.Type(), ssh.FingerprintSHA256(k))
+	if k.Comment != "" {
+		line += " " + k.Comment
+	}
+	if provider, ok := m.smartcards[string(k.Blob)]; ok {
+		line += " [" + provider + "]"
+	}
+
+	return line
+}
+
+// supportsSmartcards reports whether the agent can load PKCS#11 providers.
+func (m *Model) supportsSmartcards() bool {
+	_, ok := m.currentAgent().Provider.(agents.SmartcardProvider)
+	return ok
+}
@@ -0,0 +1,129 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ui
+
+import (
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/fatih/color"
+)
+
+// tab is a page of the TUI.
+type tab int
+
+const (
+	tabKeys tab = iota
+	tabAuthorized
+	tabKnownHosts
+	tabSigners
+)
+
+// String implements fmt.Stringer interface
+func (t tab) String() string {
+	switch t {
+	case tabKeys:
+		return "Keys"
+	case tabAuthorized:
+		return "Authorized keys"
+	case tabKnownHosts:
+		return "Known hosts"
+	case tabSigners:
+		return "Allowed signers"
+	default:
+		return "Unknown"
+	}
+}
+
+// renderTabs renders the tabs bar. Nothing is rendered when there is only
+// one tab.
+func (m *Model) renderTabs() string {
+	if len(m.tabs) < 2 {
+		return ""
+	}
+
+	titles := make([]string, 0, len(m.tabs))
+	for _, t := range m.tabs {
+		if t == m.tab {
+			titles = append(titles, color.New(color.Bold, color.Underline).Sprint(t.String()))
+		} else {
+			titles = append(titles, t.String())
+		}
+	}
+
+	return strings.Join(titles, " | ") + "\n\n"
+}
+
+// nextTab switches to the next enabled tab.
+func (m *Model) nextTab() {
+	i := slices.Index(m.tabs, m.tab)
+	m.tab = m.tabs[(i+1)%len(m.tabs)]
+}
+
+// handleTabKey handles the keypresses specific to the current tab. It
+// returns nil if the key is not handled.
+func (m *Model) handleTabKey(msg tea.KeyMsg) tea.Cmd {
+	switch m.tab {
+	case tabKeys:
+		switch msg.String() {
+		case "a":
+			return m.handleAuthorize()
+		case "c":
+			m.handleCopyID()
+		case "t":
+			m.handleTestKey()
+		case "e":
+			m.handleEditMetadata()
+		case "s":
+			m.handleAllowSigner()
+		case "g":
+			return m.handleGitSigningKey()
+		case "p":
+			m.handleAddSmartcard()
+		case "P":
+			m.handleRemoveSmartcard()
+		case "L":
+			m.handleLoadRestricted()
+		case "A":
+			m.handleSwitchAgent()
+		case "m":
+			return m.handleMoveToAgent(true)
+		case "M":
+			return m.handleMoveToAgent(false)
+		}
+	case tabAuthorized:
+		switch msg.String() {
+		case "d", "delete":
+			return m.handleUnauthorize()
+		}
+	case tabKnownHosts:
+		switch msg.String() {
+		case "/":
+			m.handleSearchHost()
+		case "d", "delete":
+			return m.handleRemoveKnownHost()
+		}
+	case tabSigners:
+		switch msg.String() {
+		case "d", "delete":
+			return m.handleRemoveSigner()
+		}
+	}
+
+	return nil
+}
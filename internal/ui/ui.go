@@ -18,31 +18,221 @@ package ui
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"slices"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/fatih/color"
+	"github.com/mixanemca/ssh-keys/internal/agents"
+	"github.com/mixanemca/ssh-keys/internal/authorized"
+	"github.com/mixanemca/ssh-keys/internal/gitconfig"
+	"github.com/mixanemca/ssh-keys/internal/hosts"
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/metadata"
 	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/mixanemca/ssh-keys/internal/remote"
+	"github.com/mixanemca/ssh-keys/internal/signers"
+	"github.com/mixanemca/ssh-keys/internal/usage"
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 )
 
 type Model struct {
 	// Keys stores the keys.
 	Keys []*models.Key
-	// AgentClient store the SSH agent client.
+	// AgentClient store the client of the current SSH agent.
 	AgentClient agent.ExtendedAgent
-	// AgentKeys stores the public keys loaded to SSH agent.
+	// AgentKeys stores the public keys loaded to the current SSH agent.
 	AgentKeys [][]byte
+	// smartcards stores the PKCS#11 providers of agent keys by key blob,
+	// for the providers added since start.
+	smartcards map[string]string
+	// lastSmartcard stores the last entered PKCS#11 provider.
+	lastSmartcard string
+	// VaultKeys stores the keys kept in the encrypted vault.
+	VaultKeys []*models.Key
+	// store stores the backend the private keys are kept in.
+	store keys.KeyStore
+	// vault stores the encrypted vault backend, if enabled.
+	vault keys.KeyStore
+	// endpoints stores the SSH agents, keys are loaded to the current one.
+	endpoints []*agentEndpoint
+	// agentIndex stores index of the current SSH agent.
+	agentIndex int
 	// selectedIndex stores index of current selected private key.
 	selectedIndex int
+	// tabs stores the enabled tabs in display order.
+	tabs []tab
+	// tab stores the current tab.
+	tab tab
+	// authorizedPath stores the path of authorized_keys file, if enabled.
+	authorizedPath string
+	// authorized stores the parsed authorized_keys file.
+	authorized *authorized.File
+	// authorizedIndex stores index of current selected authorized key.
+	authorizedIndex int
+	// knownHostsPath stores the path of known_hosts file, if enabled.
+	knownHostsPath string
+	// knownHosts stores the parsed known_hosts file.
+	knownHosts *hosts.File
+	// knownHostsIndex stores index of current selected known host.
+	knownHostsIndex int
+	// hostsQuery stores the hostname to filter known hosts by.
+	hostsQuery string
+	// signersPath stores the path of allowed_signers file, if enabled.
+	signersPath string
+	// signers stores the parsed allowed_signers file.
+	signers *signers.File
+	// signersIndex stores index of current selected allowed signer.
+	signersIndex int
+	// metadataPath stores the path of the keys metadata file, if enabled.
+	metadataPath string
+	// metadata stores the keys metadata.
+	metadata *metadata.Store
+	// usagePath stores the path of the usage log, if enabled.
+	usagePath string
+	// lastUsed stores the time of the latest use of keys by fingerprint.
+	lastUsed map[string]time.Time
+	// git configures git commit signing, if enabled.
+	git *gitconfig.Git
+	// gitSigningKey stores the key git signs commits with.
+	gitSigningKey ssh.PublicKey
+	// prompt stores the open text input, if any.
+	prompt *prompt
+	// dialer connects to remote hosts, if enabled.
+	dialer *remote.Dialer
+	// status stores the result of the last command.
+	status string
+	// err stores the last error returned by a command.
+	err error
+	// certLifetime limits the lifetime of loaded certificates by their validity.
+	certLifetime bool
+	// maxAge is the rotation period, older keys are highlighted.
+	maxAge time.Duration
+	// now returns the current time, used to check certificates validity.
+	now func() time.Time
+}
+
+// Option configures optional parts of the Model.
+type Option func(*Model)
+
+// WithVault adds a section with the keys from the encrypted vault.
+func WithVault(vault keys.KeyStore) Option {
+	return func(m *Model) {
+		m.vault = vault
+	}
+}
+
+// WithCertificateLifetime limits the lifetime of certificates in SSH agent by
+// their remaining validity. The plain keys are loaded without a lifetime.
+func WithCertificateLifetime() Option {
+	return func(m *Model) {
+		m.certLifetime = true
+	}
+}
+
+// WithAuthorizedKeys adds a tab to manage the authorized_keys file.
+func WithAuthorizedKeys(path string) Option {
+	return func(m *Model) {
+		m.authorizedPath = path
+		m.tabs = append(m.tabs, tabAuthorized)
+	}
+}
+
+// WithKnownHosts adds a tab to view and edit the known_hosts file.
+func WithKnownHosts(path string) Option {
+	return func(m *Model) {
+		m.knownHostsPath = path
+		m.tabs = append(m.tabs, tabKnownHosts)
+	}
+}
+
+// WithAllowedSigners adds a tab to manage the allowed_signers file.
+func WithAllowedSigners(path string) Option {
+	return func(m *Model) {
+		m.signersPath = path
+		m.tabs = append(m.tabs, tabSigners)
+	}
+}
+
+// WithGit marks the key git signs commits with and allows to choose it.
+func WithGit(g *gitconfig.Git) Option {
+	return func(m *Model) {
+		m.git = g
+	}
+}
+
+// WithAgents sets the SSH agents to manage, like the local, the forwarded
+// and gpg-agent ones. They replace the agent provider passed to NewModel and
+// the first one is the current agent at start.
+func WithAgents(endpoints ...agents.Endpoint) Option {
+	return func(m *Model) {
+		if len(endpoints) == 0 {
+			return
+		}
+		m.endpoints = nil
+		for _, e := range endpoints {
+			m.endpoints = append(m.endpoints, &agentEndpoint{Endpoint: e})
+		}
+	}
+}
+
+// WithDialer enables the actions on remote hosts, like copying a key.
+func WithDialer(d *remote.Dialer) Option {
+	return func(m *Model) {
+		m.dialer = d
+	}
+}
+
+// WithMetadata shows and edits the keys metadata kept in the file.
+func WithMetadata(path string) Option {
+	return func(m *Model) {
+		m.metadataPath = path
+	}
+}
+
+// WithUsageLog records loading, unloading and remote use of keys to the
+// log file and shows when every key was used last time.
+func WithUsageLog(path string) Option {
+	return func(m *Model) {
+		m.usagePath = path
+	}
+}
+
+// WithMaxAge sets the rotation period of keys, older keys are highlighted.
+// Zero disables the highlighting.
+func WithMaxAge(d time.Duration) Option {
+	return func(m *Model) {
+		m.maxAge = d
+	}
 }
 
 // NewModel is an initializer which creates a new model for rendering
-// our Bubbletea app.
-func NewModel() (*Model, error) {
-	return &Model{}, nil
+// our Bubbletea app. Private keys are listed from store and the SSH agent
+// is reached through provider.
+func NewModel(store keys.KeyStore, provider agents.Provider, opts ...Option) (*Model, error) {
+	if store == nil {
+		return nil, fmt.Errorf("key store is required")
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("agent provider is required")
+	}
+	m := &Model{
+		store:     store,
+		endpoints: []*agentEndpoint{{Endpoint: agents.Endpoint{Name: "default", Provider: provider}}},
+		tabs:      []tab{tabKeys},
+		tab:       tabKeys,
+		maxAge:    keys.DefaultMaxAge,
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m, nil
 }
 
 // Ensure that model fulfils the tea.Model interface at compile time.
@@ -50,33 +240,113 @@ var _ tea.Model = (*Model)(nil)
 
 // View renders output to the CLI.
 func (m *Model) View() string {
-	var keys []string
+	var lines []string
+	var help string
+	switch m.tab {
+	case tabAuthorized:
+		lines, help = m.authorizedView()
+	case tabKnownHosts:
+		lines, help = m.knownHostsView()
+	case tabSigners:
+		lines, help = m.signersView()
+	default:
+		lines, help = m.keysView()
+	}
+
+	var errLine string
+	switch {
+	case m.err != nil:
+		errLine = "\n" + color.RedString("Error: %v", m.err) + "\n"
+	case m.status != "":
+		errLine = "\n" + color.GreenString(m.status) + "\n"
+	}
+
+	if m.prompt != nil {
+		return fmt.Sprintf(`%s%s
+%s
+%s
+Press enter to confirm, esc to cancel.`,
+			m.renderTabs(), strings.Join(lines, "\n"), errLine, m.promptView())
+	}
+
+	if len(m.tabs) > 1 {
+		help += ", tab to switch tabs"
+	}
+
+	return fmt.Sprintf(`%s%s
+%s
+%s, arrow keys to move, r to refresh, Ctrl+C or q to exit.`,
+		m.renderTabs(), strings.Join(lines, "\n"), errLine, help)
+}
+
+// keysView renders the tab with private keys.
+func (m *Model) keysView() ([]string, string) {
+	var lines []string
+	if len(m.endpoints) > 1 {
+		lines = append(lines, m.renderAgents(), "")
+	}
+	lines = append(lines, "Found private keys:")
 	for i, k := range m.Keys {
-		if slices.ContainsFunc(m.AgentKeys, func(data []byte) bool {
-			return bytes.Equal(data, k.Public.Marshal())
-		}) {
-			k.LoadedToAgent = true
-		}
-		if i == m.selectedIndex {
-			if k.LoadedToAgent {
-				keys = append(keys, fmt.Sprintf("-> %s", color.GreenString(k.String())))
-			} else {
-				keys = append(keys, fmt.Sprintf("-> %s", k))
-			}
-		} else {
-			if k.LoadedToAgent {
-				keys = append(keys, fmt.Sprintf("   %s", color.GreenString(k.String())))
-			} else {
-				keys = append(keys, fmt.Sprintf("   %s", k))
-			}
+		lines = append(lines, m.renderKey(k, i == m.selectedIndex))
+	}
+	if m.vault != nil {
+		lines = append(lines, "", "Vault keys:")
+		for i, k := range m.VaultKeys {
+			lines = append(lines, m.renderKey(k, len(m.Keys)+i == m.selectedIndex))
+		}
+	}
+	if list := m.smartcardKeys(); len(list) > 0 {
+		lines = append(lines, "", "Smartcard and other agent keys:")
+		for _, k := range list {
+			lines = append(lines, m.renderSmartcardKey(k))
+		}
+	}
+	if k := m.selectedKey(); k != nil && !k.Metadata.IsZero() {
+		lines = append(lines, "", fmt.Sprintf("Metadata of %s:", k.Name))
+		for _, line := range metadata.Describe(k.Metadata) {
+			lines = append(lines, "   "+line)
+		}
+	}
+	if k := m.selectedKey(); k != nil && k.SecurityKey != nil {
+		lines = append(lines, "", fmt.Sprintf("Security key %s:", k.Name))
+		for _, line := range keys.DescribeSecurityKey(k.SecurityKey) {
+			lines = append(lines, "   "+line)
+		}
+	}
+	if k := m.selectedKey(); k != nil && k.Certificate != nil {
+		lines = append(lines, "", fmt.Sprintf("Certificate of %s (%s):", k.Name, keys.CertificateStatus(k.Certificate, m.now())))
+		for _, line := range keys.DescribeCertificate(k.Certificate) {
+			lines = append(lines, "   "+line)
 		}
 	}
 
-	return fmt.Sprintf(`Found private keys:
-%s
+	help := "Press enter/return or space to load or unload a key from the ssh-agent"
+	if m.knownHostsPath != "" {
+		help += ", L to load a key only for some hosts"
+	}
+	if m.authorizedPath != "" {
+		help += ", a to authorize a key"
+	}
+	if m.metadataPath != "" {
+		help += ", e to edit metadata"
+	}
+	if m.signersPath != "" {
+		help += ", s to allow a key to sign"
+	}
+	if m.git != nil {
+		help += ", g to sign git commits with a key"
+	}
+	if len(m.endpoints) > 1 {
+		help += ", A to switch the agent, m/M to move/copy a key to another agent"
+	}
+	if m.supportsSmartcards() {
+		help += ", p/P to add/remove a PKCS#11 provider"
+	}
+	if m.dialer != nil {
+		help += ", c to copy a key to a host, t to test a key against a host"
+	}
 
-Press enter/return or space to load or unload a key from the ssh-agent, arrow keys to move, Ctrl+C or q to exit.`,
-		strings.Join(keys, "\n"))
+	return lines, help
 }
 
 // Update is called with a tea.Msg, representing something that happened within
@@ -86,10 +356,96 @@ Press enter/return or space to load or unload a key from the ssh-agent, arrow ke
 func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// Let's figure out what is in tea.Msg, and what we need to do.
 	switch msg := msg.(type) {
+	case privateKeysMsg:
+		m.Keys = msg.keys
+		m.clampCursor()
+		m.syncLoadedToAgent()
+		m.syncMetadata()
+		m.syncUsage()
+	case vaultKeysMsg:
+		m.VaultKeys = msg.keys
+		m.clampCursor()
+		m.syncLoadedToAgent()
+		m.syncMetadata()
+		m.syncUsage()
+	case metadataMsg:
+		m.err = nil
+		m.metadata = msg.store
+		m.syncMetadata()
+	case usageMsg:
+		m.lastUsed = msg.lastUsed
+		m.syncUsage()
+	case usageRecordedMsg:
+		if m.lastUsed == nil {
+			m.lastUsed = make(map[string]time.Time)
+		}
+		if e := msg.event; e.Time.After(m.lastUsed[e.Fingerprint]) {
+			m.lastUsed[e.Fingerprint] = e.Time
+		}
+		m.syncUsage()
+	case agentKeysMsg:
+		e := m.endpoints[msg.agent]
+		e.setClient(msg.client)
+		e.keys, e.identities = msg.keys, msg.identities
+		m.syncAgent()
+	case smartcardMsg:
+		m.updateSmartcard(msg)
+	case keyLoadedMsg:
+		m.err = nil
+		if len(msg.restricted) > 0 {
+			m.status = describeRestricted(msg.restricted)
+		}
+		m.endpoints[msg.agent].add(msg.blobs)
+		m.syncAgent()
+		return m, m.trackUsage(msg.key, usage.ActionLoad, "")
+	case keyUnloadedMsg:
+		m.err = nil
+		m.endpoints[msg.agent].remove(msg.blobs)
+		m.syncAgent()
+		return m, m.trackUsage(msg.key, usage.ActionUnload, "")
+	case keyMovedMsg:
+		m.updateMoved(msg)
+		return m, m.trackUsage(msg.loaded.key, usage.ActionLoad, "")
+	case authorizedKeysMsg:
+		m.authorized = msg.file
+		m.clampCursor()
+	case knownHostsMsg:
+		m.knownHosts = msg.file
+		m.clampCursor()
+	case gitSigningKeyMsg:
+		m.gitSigningKey = msg.key
+		if msg.name != "" {
+			m.err, m.status = nil, fmt.Sprintf("Git signs commits with %s", msg.name)
+		}
+	case allowedSignersMsg:
+		m.signers = msg.file
+		m.clampCursor()
+	case keyCopiedMsg:
+		m.err = nil
+		if msg.added {
+			m.status = fmt.Sprintf("Key %s was added to %s", msg.name, msg.target)
+		} else {
+			m.status = fmt.Sprintf("Key %s is already authorized on %s", msg.name, msg.target)
+		}
+		return m, m.trackUsage(msg.key, usage.ActionCopyID, msg.target.String())
+	case keyTestedMsg:
+		if msg.result.Accepted {
+			m.err, m.status = nil, describeTest(msg)
+		} else {
+			m.err, m.status = errors.New(describeTest(msg)), ""
+		}
+		return m, m.trackUsage(msg.key, usage.ActionTest, msg.target.String())
+	case errMsg:
+		m.err = msg.err
+		m.status = ""
 	case tea.WindowSizeMsg:
 		// The terminal was resized.  We can access the new size with:
 		_, _ = msg.Width, msg.Height
 	case tea.KeyMsg:
+		if m.prompt != nil {
+			// The prompt takes all keys until it is closed.
+			return m, m.handlePromptKey(msg)
+		}
 		// msg is a keypress. We can handle each key combo uniquely, and update
 		// our state:
 		switch msg.String() {
@@ -97,11 +453,22 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		case "up", "down":
 			return m.moveCursor(msg), nil
+		case "r":
+			// Reload keys from disk and agent.
+			return m, m.Init()
+		case "tab":
+			m.nextTab()
+			return m, nil
+		}
+		if cmd := m.handleTabKey(msg); cmd != nil {
+			return m, cmd
 		}
 		switch msg.Type {
 		case tea.KeyEnter, tea.KeySpace:
 			// Load and unload key from agent.
-			return m, m.handleEnter(msg)
+			if m.tab == tabKeys {
+				return m, m.handleEnter(msg)
+			}
 		case tea.KeyCtrlC:
 			// In this case, ctrl+c quits the app by sending a
 			// tea.Quit cmd. This is a Bubbletea builtin which terminates the
@@ -131,26 +498,144 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 // to update the model's state.
 func (m *Model) Init() tea.Cmd {
 	var cmds []tea.Cmd
-	cmds = append(cmds, findPrivateKeys(m))
-	cmds = append(cmds, findAgentKeys(m))
+	cmds = append(cmds, findPrivateKeys(m.store))
+	for i, e := range m.endpoints {
+		cmds = append(cmds, findAgentKeys(e.Endpoint, e.client, i))
+	}
+	if m.vault != nil {
+		cmds = append(cmds, findVaultKeys(m.vault))
+	}
+	if m.authorizedPath != "" {
+		cmds = append(cmds, loadAuthorizedKeys(m.authorizedPath))
+	}
+	if m.knownHostsPath != "" {
+		cmds = append(cmds, loadKnownHosts(m.knownHostsPath))
+	}
+	if m.signersPath != "" {
+		cmds = append(cmds, loadAllowedSigners(m.signersPath))
+	}
+	if m.metadataPath != "" {
+		cmds = append(cmds, loadMetadata(m.metadataPath))
+	}
+	if m.usagePath != "" {
+		cmds = append(cmds, loadUsage(m.usagePath))
+	}
+	if m.git != nil {
+		cmds = append(cmds, loadGitSigningKey(m.git))
+	}
 
 	return tea.Batch(cmds...)
 }
 
 func (m *Model) moveCursor(msg tea.KeyMsg) *Model {
+	var delta int
 	switch msg.String() {
 	case "up":
-		m.selectedIndex--
+		delta = -1
 	case "down":
-		m.selectedIndex++
+		delta = 1
 	default:
 		// do nothing
 	}
 
-	keysCount := len(m.Keys)
-	if keysCount != 0 {
-		m.selectedIndex = (m.selectedIndex + keysCount) % keysCount
+	switch m.tab {
+	case tabAuthorized:
+		m.authorizedIndex += delta
+	case tabKnownHosts:
+		m.knownHostsIndex += delta
+	case tabSigners:
+		m.signersIndex += delta
+	default:
+		m.selectedIndex += delta
 	}
+	m.clampCursor()
 
 	return m
 }
+
+// clampCursor wraps the cursors around the lists bounds.
+func (m *Model) clampCursor() {
+	m.selectedIndex = wrap(m.selectedIndex, len(m.Keys)+len(m.VaultKeys))
+	m.authorizedIndex = wrap(m.authorizedIndex, len(m.authorizedEntries()))
+	m.knownHostsIndex = wrap(m.knownHostsIndex, len(m.knownHostsEntries()))
+	m.signersIndex = wrap(m.signersIndex, len(m.signersEntries()))
+}
+
+// wrap wraps the index around the list length.
+func wrap(index, length int) int {
+	if length == 0 {
+		return index
+	}
+
+	return (index%length + length) % length
+}
+
+// selectedKey returns the key under cursor or nil if there are no keys.
+func (m *Model) selectedKey() *models.Key {
+	switch {
+	case m.selectedIndex < len(m.Keys):
+		return m.Keys[m.selectedIndex]
+	case m.selectedIndex < len(m.Keys)+len(m.VaultKeys):
+		return m.VaultKeys[m.selectedIndex-len(m.Keys)]
+	default:
+		return nil
+	}
+}
+
+// syncLoadedToAgent marks the keys which public part is loaded to SSH agent.
+func (m *Model) syncLoadedToAgent() {
+	for _, k := range slices.Concat(m.Keys, m.VaultKeys) {
+		blob := k.Public.Marshal()
+		k.LoadedToAgent = slices.ContainsFunc(m.AgentKeys, func(data []byte) bool {
+			return bytes.Equal(data, blob)
+		})
+	}
+}
+
+// renderKey renders the key line of the list. Keys with certificate are
+// marked, expired or soon to expire certificates are highlighted. Tags and
+// passed expiry date of the key follow the age, which is highlighted when
+// the key is older than the rotation period.
+func (m *Model) renderKey(k *models.Key, selected bool) string {
+	cursor := "   "
+	if selected {
+		cursor = "-> "
+	}
+	line := k.String()
+	if k.LoadedToAgent {
+		line = color.GreenString(line)
+	}
+	if k.SecurityKey != nil {
+		line += " " + color.CyanString("[security key]")
+	}
+	if len(m.endpoints) > 1 {
+		if names := m.agentsHolding(k); len(names) > 0 {
+			line += " [in " + strings.Join(names, ", ") + "]"
+		}
+	}
+	if k.Certificate != nil {
+		switch status := keys.CertificateStatus(k.Certificate, m.now()); status {
+		case keys.CertExpired, keys.CertNotYetValid:
+			line += " " + color.RedString("[cert %s]", status)
+		case keys.CertExpiringSoon:
+			line += " " + color.YellowString("[cert %s]", status)
+		default:
+			line += " [cert]"
+		}
+	}
+	if !k.Created.IsZero() {
+		age := keys.FormatAge(k.Age(m.now()))
+		if keys.Overdue(k, m.maxAge, m.now()) {
+			line += " " + color.YellowString("[%s old, rotation due]", age)
+		} else {
+			line += " (" + age + ")"
+		}
+	}
+	if m.isGitSigningKey(k) {
+		line += " " + color.MagentaString("[git signing]")
+	}
+	line += m.renderLastUsed(k)
+	line += m.renderMetadata(k.Metadata)
+
+	return cursor + line
+}
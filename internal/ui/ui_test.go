@@ -0,0 +1,861 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ui
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"math"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mixanemca/ssh-keys/internal/agents"
+	"github.com/mixanemca/ssh-keys/internal/gitconfig"
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/mixanemca/ssh-keys/internal/remote"
+	"github.com/mixanemca/ssh-keys/internal/remote/remotetest"
+	"github.com/mixanemca/ssh-keys/internal/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// newTestModel creates a model with two generated keys and an in-memory agent.
+func newTestModel(t *testing.T) (*Model, agent.ExtendedAgent) {
+	dir := t.TempDir()
+	for _, name := range []string{"id_first", "id_second"} {
+		writeTestKey(t, dir, name)
+	}
+
+	provider := agents.NewKeyringProvider()
+	m, err := NewModel(keys.NewFSStore(dir), provider)
+	require.NoError(t, err)
+
+	client, err := provider.Connect()
+	require.NoError(t, err)
+
+	return m, client
+}
+
+// writeTestKey generates a new Ed25519 key and writes it in OpenSSH format.
+func writeTestKey(t *testing.T, dir, name string) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, name)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0600))
+}
+
+// run executes cmd and feeds the resulting messages to the model, the same
+// way the Bubbletea runtime does.
+func run(t *testing.T, m *Model, cmd tea.Cmd) {
+	if cmd == nil {
+		return
+	}
+	switch msg := cmd().(type) {
+	case tea.BatchMsg:
+		for _, c := range msg {
+			run(t, m, c)
+		}
+	default:
+		_, next := m.Update(msg)
+		run(t, m, next)
+	}
+}
+
+// runConcurrently executes cmd and the commands it batches in goroutines and
+// feeds their messages to the model from the calling goroutine, the way the
+// Bubbletea runtime does. The model is rendered and keys are pressed while
+// the commands run, so go test -race catches commands touching the model.
+func runConcurrently(t *testing.T, m *Model, cmd tea.Cmd, keys ...tea.KeyMsg) {
+	msgs := make(chan tea.Msg)
+	pending := 0
+	start := func(c tea.Cmd) {
+		if c == nil {
+			return
+		}
+		pending++
+		go func() { msgs <- c() }()
+	}
+
+	start(cmd)
+	for pending > 0 {
+		if len(keys) > 0 {
+			_, next := m.Update(keys[0])
+			start(next)
+			keys = keys[1:]
+		}
+		_ = m.View()
+
+		select {
+		case msg := <-msgs:
+			pending--
+			if batch, ok := msg.(tea.BatchMsg); ok {
+				for _, c := range batch {
+					start(c)
+				}
+				continue
+			}
+			_, next := m.Update(msg)
+			start(next)
+		case <-time.After(10 * time.Second):
+			t.Fatal("commands did not finish")
+		}
+	}
+}
+
+func press(t *testing.T, m *Model, key tea.KeyMsg) {
+	_, cmd := m.Update(key)
+	run(t, m, cmd)
+}
+
+func TestModelInit(t *testing.T) {
+	m, _ := newTestModel(t)
+	run(t, m, m.Init())
+
+	require.NoError(t, m.err)
+	assert.Len(t, m.Keys, 2)
+	assert.NotNil(t, m.AgentClient)
+	assert.Empty(t, m.AgentKeys)
+	assert.Contains(t, m.View(), "id_first")
+	assert.Contains(t, m.View(), "id_second")
+}
+
+func TestModelInitConcurrently(t *testing.T) {
+	m, _ := newTestModel(t)
+	dir := t.TempDir()
+	WithAgents(
+		agents.Endpoint{Name: "local", Provider: m.currentAgent().Provider},
+		agents.Endpoint{Name: "forwarded", Provider: agents.NewKeyringProvider()},
+	)(m)
+	WithAuthorizedKeys(filepath.Join(dir, "authorized_keys"))(m)
+	WithKnownHosts(filepath.Join(dir, "known_hosts"))(m)
+	WithAllowedSigners(filepath.Join(dir, "allowed_signers"))(m)
+	WithMetadata(filepath.Join(dir, "metadata.json"))(m)
+	WithUsageLog(filepath.Join(dir, "usage.log"))(m)
+
+	down := tea.KeyMsg{Type: tea.KeyDown}
+	refresh := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")}
+	runConcurrently(t, m, m.Init(), down, refresh, down, refresh)
+
+	require.NoError(t, m.err)
+	assert.Len(t, m.Keys, 2)
+	assert.NotNil(t, m.AgentClient)
+}
+
+func TestModelLoadUnload(t *testing.T) {
+	m, client := newTestModel(t)
+	run(t, m, m.Init())
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+	assert.True(t, m.Keys[0].LoadedToAgent)
+	assert.False(t, m.Keys[1].LoadedToAgent)
+
+	loaded, err := client.List()
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	assert.Equal(t, m.Keys[0].Public.Marshal(), loaded[0].Blob)
+
+	press(t, m, tea.KeyMsg{Type: tea.KeySpace})
+	require.NoError(t, m.err)
+	assert.False(t, m.Keys[0].LoadedToAgent)
+	assert.Empty(t, m.AgentKeys)
+
+	loaded, err = client.List()
+	require.NoError(t, err)
+	assert.Empty(t, loaded)
+}
+
+func TestModelRefresh(t *testing.T) {
+	m, client := newTestModel(t)
+	run(t, m, m.Init())
+
+	// Load the second key bypassing the UI.
+	require.NoError(t, client.Add(agent.AddedKey{PrivateKey: m.Keys[1].Private}))
+	writeTestKey(t, m.store.(*keys.FSStore).Root(), "id_third")
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	require.NoError(t, m.err)
+	assert.Len(t, m.Keys, 3)
+	assert.Len(t, m.AgentKeys, 1)
+	assert.True(t, m.Keys[1].LoadedToAgent)
+}
+
+func TestModelRefreshSocketAgent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	var connections atomic.Int32
+	keyring := agent.NewKeyring()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			connections.Add(1)
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+
+	m, err := NewModel(keys.NewFSStore(t.TempDir()), agents.NewSocketProvider(path))
+	require.NoError(t, err)
+	run(t, m, m.Init())
+	require.NoError(t, m.err)
+
+	for range 3 {
+		press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+		require.NoError(t, m.err)
+	}
+	assert.Equal(t, int32(1), connections.Load())
+}
+
+func TestCertLifetime(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for _, tt := range []struct {
+		validBefore uint64
+		want        uint32
+	}{
+		{uint64(now.Add(time.Hour).Unix()), 3600},
+		{ssh.CertTimeInfinity, 0},
+		{ssh.CertTimeInfinity - 1, math.MaxUint32},
+		{uint64(now.Unix()) + math.MaxUint32 + 10, math.MaxUint32},
+	} {
+		assert.Equal(t, tt.want, certLifetime(&ssh.Certificate{ValidBefore: tt.validBefore}, now), tt.validBefore)
+	}
+}
+
+func TestModelMoveCursor(t *testing.T) {
+	m, _ := newTestModel(t)
+	run(t, m, m.Init())
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyDown})
+	assert.Equal(t, 1, m.selectedIndex)
+	press(t, m, tea.KeyMsg{Type: tea.KeyDown})
+	assert.Equal(t, 0, m.selectedIndex)
+	press(t, m, tea.KeyMsg{Type: tea.KeyUp})
+	assert.Equal(t, 1, m.selectedIndex)
+}
+
+func TestModelAgentError(t *testing.T) {
+	m, err := NewModel(keys.NewFSStore(t.TempDir()), agents.NewSocketProvider(""))
+	require.NoError(t, err)
+	run(t, m, m.Init())
+
+	assert.Error(t, m.err)
+	assert.Nil(t, m.AgentClient)
+	assert.Nil(t, m.handleEnter(tea.KeyMsg{Type: tea.KeyEnter}))
+	assert.Contains(t, m.View(), "Error:")
+}
+
+func TestModelLoadCertificate(t *testing.T) {
+	dir := t.TempDir()
+	writeTestKey(t, dir, "id_first")
+	provider := &recordingProvider{KeyringProvider: agents.NewKeyringProvider()}
+	m, err := NewModel(keys.NewFSStore(dir), provider, WithCertificateLifetime())
+	require.NoError(t, err)
+	client, err := provider.Connect()
+	require.NoError(t, err)
+	run(t, m, m.Init())
+
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ca, err := ssh.NewSignerFromKey(caKey)
+	require.NoError(t, err)
+	cert := &ssh.Certificate{
+		Key:         m.Keys[0].Public,
+		CertType:    ssh.UserCert,
+		KeyId:       "me",
+		ValidAfter:  uint64(time.Now().Add(-time.Minute).Unix()),
+		ValidBefore: uint64(time.Now().Add(time.Hour).Unix()),
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	require.NoError(t, os.WriteFile(m.Keys[0].Path+keys.CertSuffix, ssh.MarshalAuthorizedKey(cert), 0644))
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	require.NotNil(t, m.Keys[0].Certificate)
+	assert.Contains(t, m.View(), "Key ID: \"me\"")
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+	assert.True(t, m.Keys[0].LoadedToAgent)
+	loaded, err := client.List()
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+	assert.Equal(t, cert.Marshal(), loaded[1].Blob)
+	// Only the certificate expires, the plain key stays in the agent.
+	require.Len(t, provider.added, 2)
+	assert.Nil(t, provider.added[0].Certificate)
+	assert.Zero(t, provider.added[0].LifetimeSecs)
+	assert.NotNil(t, provider.added[1].Certificate)
+	assert.InDelta(t, time.Hour.Seconds(), provider.added[1].LifetimeSecs, 5)
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+	loaded, err = client.List()
+	require.NoError(t, err)
+	assert.Empty(t, loaded)
+	assert.Empty(t, m.AgentKeys)
+}
+
+func TestModelAuthorizedKeys(t *testing.T) {
+	m, _ := newTestModel(t)
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	WithAuthorizedKeys(path)(m)
+	run(t, m, m.Init())
+
+	// Authorize both keys, the second attempt for the same key fails.
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	require.NoError(t, m.err)
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	assert.Error(t, m.err)
+	press(t, m, tea.KeyMsg{Type: tea.KeyDown})
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	require.Len(t, m.authorizedEntries(), 2)
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyTab})
+	assert.Equal(t, tabAuthorized, m.tab)
+	assert.Contains(t, m.View(), ssh.FingerprintSHA256(m.Keys[1].Public))
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("d")})
+	require.Len(t, m.authorizedEntries(), 1)
+	assert.Equal(t, m.Keys[1].Public.Marshal(), m.authorizedEntries()[0].Key.Marshal())
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyTab})
+	assert.Equal(t, tabKeys, m.tab)
+}
+
+func TestModelKnownHosts(t *testing.T) {
+	m, _ := newTestModel(t)
+	run(t, m, m.Init())
+
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	var data []byte
+	for i, host := range []string{"alpha.example.com", "beta.example.com"} {
+		data = append(data, []byte(host+" ")...)
+		data = append(data, ssh.MarshalAuthorizedKey(m.Keys[i].Public)...)
+	}
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	WithKnownHosts(path)(m)
+	run(t, m, m.Init())
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyTab})
+	assert.Equal(t, tabKnownHosts, m.tab)
+	require.Len(t, m.knownHostsEntries(), 2)
+
+	// The query takes keys which are otherwise commands, like q and d.
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("/")})
+	typeText(t, m, "beta.example.com")
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	assert.Nil(t, m.prompt)
+	require.Len(t, m.knownHostsEntries(), 1)
+	assert.Contains(t, m.View(), "beta.example.com")
+	assert.NotContains(t, m.View(), "alpha.example.com")
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("d")})
+	require.NoError(t, m.err)
+	assert.Empty(t, m.knownHostsEntries())
+	require.Len(t, m.knownHosts.Entries(), 1)
+	assert.Equal(t, []string{"alpha.example.com"}, m.knownHosts.Entries()[0].Hosts)
+}
+
+// typeText presses the keys of the text one by one.
+func typeText(t *testing.T, m *Model, text string) {
+	for _, r := range text {
+		press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+}
+
+func TestModelRemoteActions(t *testing.T) {
+	srv := remotetest.NewServer(t)
+	srv.SetPassword("secret")
+
+	m, _ := newTestModel(t)
+	WithDialer(&remote.Dialer{
+		Password:        func(remote.Target) (string, error) { return "secret", nil },
+		HostKeyCallback: srv.HostKeyCallback(),
+	})(m)
+	run(t, m, m.Init())
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("c")})
+	require.NotNil(t, m.prompt)
+	typeText(t, m, srv.Target())
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+	assert.Contains(t, m.View(), "Key id_first was added to")
+
+	data, err := os.ReadFile(srv.AuthorizedKeys())
+	require.NoError(t, err)
+	assert.Contains(t, string(data), strings.TrimSpace(string(ssh.MarshalAuthorizedKey(m.Keys[0].Public))))
+
+	// Only the copied key is accepted.
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("t")})
+	typeText(t, m, srv.Target())
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+	assert.Contains(t, m.View(), "Key id_first is accepted by")
+	press(t, m, tea.KeyMsg{Type: tea.KeyDown})
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("t")})
+	typeText(t, m, srv.Target())
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.Error(t, m.err)
+	assert.Contains(t, m.err.Error(), "Key id_second is not accepted by")
+
+	// Esc cancels the prompt.
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("c")})
+	press(t, m, tea.KeyMsg{Type: tea.KeyEsc})
+	assert.Nil(t, m.prompt)
+}
+
+func TestModelRemoteActionsAgent(t *testing.T) {
+	srv := remotetest.NewServer(t)
+	m, _ := newTestModel(t)
+	forwarded := agents.NewKeyringProvider()
+	WithAgents(
+		agents.Endpoint{Name: "local", Provider: m.currentAgent().Provider},
+		agents.Endpoint{Name: "forwarded", Provider: forwarded},
+	)(m)
+	WithDialer(&remote.Dialer{HostKeyCallback: srv.HostKeyCallback()})(m)
+	run(t, m, m.Init())
+
+	// Only the forwarded agent holds the key authorized on the server.
+	require.NoError(t, os.MkdirAll(filepath.Dir(srv.AuthorizedKeys()), 0700))
+	require.NoError(t, os.WriteFile(srv.AuthorizedKeys(), ssh.MarshalAuthorizedKey(m.Keys[1].Public), 0600))
+	client, err := forwarded.Connect()
+	require.NoError(t, err)
+	require.NoError(t, client.Add(agent.AddedKey{PrivateKey: m.Keys[1].Private}))
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+
+	copyID := func() {
+		press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("c")})
+		typeText(t, m, srv.Target())
+		press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	}
+	copyID()
+	assert.Error(t, m.err)
+
+	// The selected agent authenticates.
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("A")})
+	copyID()
+	require.NoError(t, m.err)
+	assert.Contains(t, m.View(), "Key id_first was added to")
+
+	// The key signs through the agent holding it, even without the private
+	// key at hand.
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("A")})
+	press(t, m, tea.KeyMsg{Type: tea.KeyDown})
+	m.Keys[1].Private = nil
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("t")})
+	typeText(t, m, srv.Target())
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+	assert.Contains(t, m.View(), "Key id_second is accepted by")
+}
+
+func TestModelEditMetadata(t *testing.T) {
+	m, _ := newTestModel(t)
+	path := filepath.Join(t.TempDir(), "metadata.json")
+	WithMetadata(path)(m)
+	m.now = func() time.Time { return time.Date(2030, 1, 1, 0, 0, 0, 0, time.Local) }
+	run(t, m, m.Init())
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	for _, value := range []string{"prod, ci", "platform", "deploy", "", "2029-12-31"} {
+		require.NotNil(t, m.prompt)
+		typeText(t, m, value)
+		press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	}
+	require.NoError(t, m.err)
+	assert.Nil(t, m.prompt)
+	assert.Equal(t, []string{"prod", "ci"}, m.Keys[0].Metadata.Tags)
+	assert.Equal(t, "platform", m.Keys[0].Metadata.Owner)
+	assert.Contains(t, m.View(), "[prod, ci]")
+	assert.Contains(t, m.View(), "[expired 2029-12-31]")
+	assert.Contains(t, m.View(), "Purpose: deploy")
+
+	// Metadata follows the key after rename, as it is keyed by fingerprint.
+	require.NoError(t, m.store.Rename(m.Keys[0].Name, "id_renamed"))
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	i := slices.IndexFunc(m.Keys, func(k *models.Key) bool { return k.Name == "id_renamed" })
+	require.GreaterOrEqual(t, i, 0)
+	assert.Equal(t, "platform", m.Keys[i].Metadata.Owner)
+
+	// An invalid date is reported and nothing is saved.
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	for range 4 {
+		press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	}
+	typeText(t, m, "soon")
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	assert.Error(t, m.err)
+}
+
+func TestModelKeyAge(t *testing.T) {
+	m, _ := newTestModel(t)
+	WithMaxAge(30 * 24 * time.Hour)(m)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	run(t, m, m.Init())
+	require.Len(t, m.Keys, 2)
+
+	old := now.Add(-40 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(m.Keys[0].Path, old, old))
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	assert.Contains(t, m.View(), "[40d old, rotation due]")
+	assert.Contains(t, m.View(), "(0d)")
+
+	WithMaxAge(0)(m)
+	assert.NotContains(t, m.View(), "rotation due")
+}
+
+func TestModelUsageLog(t *testing.T) {
+	m, _ := newTestModel(t)
+	path := filepath.Join(t.TempDir(), "usage.log")
+	WithUsageLog(path)(m)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	run(t, m, m.Init())
+	require.NoError(t, m.err)
+	assert.Contains(t, m.View(), "[never used]")
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+	assert.True(t, m.Keys[0].LastUsed.Equal(now))
+	assert.Contains(t, m.View(), "(used today)")
+
+	events, err := usage.Read(path)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, usage.ActionLoad, events[0].Action)
+	assert.Equal(t, usage.ActionUnload, events[1].Action)
+	assert.Equal(t, ssh.FingerprintSHA256(m.Keys[0].Public), events[0].Fingerprint)
+
+	// The last use survives restart.
+	m.now = func() time.Time { return now.Add(72 * time.Hour) }
+	m.lastUsed = nil
+	run(t, m, m.Init())
+	assert.Contains(t, m.View(), "(used 3d ago)")
+}
+
+func TestModelAllowedSigners(t *testing.T) {
+	m, _ := newTestModel(t)
+	path := filepath.Join(t.TempDir(), "allowed_signers")
+	WithAllowedSigners(path)(m)
+	run(t, m, m.Init())
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("s")})
+	typeText(t, m, "me@example.com, me@home")
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NotNil(t, m.prompt)
+	// The namespace defaults to git.
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyTab})
+	assert.Equal(t, tabSigners, m.tab)
+	require.Len(t, m.signersEntries(), 1)
+	e := m.signersEntries()[0]
+	assert.Equal(t, []string{"me@example.com", "me@home"}, e.Principals)
+	assert.Equal(t, []string{"git"}, e.Namespaces())
+	assert.Contains(t, m.View(), "(id_first) [git]")
+
+	// Broken lines are reported.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, append(data, "broken\n"...), 0600))
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	assert.Contains(t, m.View(), "line 2: key is missing")
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("d")})
+	require.NoError(t, m.err)
+	assert.Empty(t, m.signersEntries())
+}
+
+func TestModelGitSigningKey(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	g := &gitconfig.Git{Dir: dir, Env: []string{
+		"GIT_CONFIG_GLOBAL=" + filepath.Join(dir, ".gitconfig"),
+		"GIT_CONFIG_NOSYSTEM=1",
+	}}
+
+	m, _ := newTestModel(t)
+	WithGit(g)(m)
+	run(t, m, m.Init())
+	require.NoError(t, m.err)
+	assert.NotContains(t, m.View(), "[git signing]")
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyDown})
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("g")})
+	require.NoError(t, m.err)
+	assert.Contains(t, m.View(), "Git signs commits with id_second")
+	assert.True(t, m.isGitSigningKey(m.Keys[1]))
+	assert.False(t, m.isGitSigningKey(m.Keys[0]))
+
+	// The signing key is read from git config on refresh.
+	m.gitSigningKey = nil
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	assert.True(t, m.isGitSigningKey(m.Keys[1]))
+	assert.Contains(t, m.View(), "id_second  (0d) [git signing]")
+}
+
+func TestModelSecurityKey(t *testing.T) {
+	m, client := newTestModel(t)
+	run(t, m, m.Init())
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	skPub, err := ssh.ParsePublicKey(ssh.Marshal(struct {
+		Type        string
+		Key         []byte
+		Application string
+	}{keys.KeyAlgoSKED25519, pub, "ssh:"}))
+	require.NoError(t, err)
+	sk := &models.Key{
+		Name:        "id_ed25519_sk",
+		Format:      skPub.Type(),
+		Public:      skPub,
+		SecurityKey: &models.SecurityKey{Application: "ssh:", Flags: models.SKUserPresenceRequired},
+	}
+	m.Update(privateKeysMsg{keys: []*models.Key{sk}})
+	assert.Contains(t, m.View(), "id_ed25519_sk  [security key]")
+	assert.Contains(t, m.View(), "User presence: required")
+
+	// Only ssh-add can load the key, but the loaded key is recognized.
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	assert.ErrorIs(t, m.err, keys.ErrSecurityKey)
+	m.Update(agentKeysMsg{client: client, keys: [][]byte{skPub.Marshal()}})
+	assert.True(t, sk.LoadedToAgent)
+}
+
+// smartcardProvider is an in-memory agent which adds a generated key for
+// every PKCS#11 provider with PIN 1234.
+type smartcardProvider struct {
+	*agents.KeyringProvider
+	keys map[string]ed25519.PrivateKey
+}
+
+// AddSmartcardKey implements agents.SmartcardProvider interface
+func (p *smartcardProvider) AddSmartcardKey(provider, pin string) error {
+	if pin != "1234" {
+		return agents.ErrSmartcardRefused
+	}
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	p.keys[provider] = priv
+	client, _ := p.Connect()
+
+	return client.Add(agent.AddedKey{PrivateKey: priv, Comment: "PIV AUTH key"})
+}
+
+// RemoveSmartcardKey implements agents.SmartcardProvider interface
+func (p *smartcardProvider) RemoveSmartcardKey(provider string) error {
+	priv, ok := p.keys[provider]
+	if !ok {
+		return agents.ErrSmartcardRefused
+	}
+	pub, err := ssh.NewPublicKey(priv.Public())
+	if err != nil {
+		return err
+	}
+	client, _ := p.Connect()
+
+	return client.Remove(pub)
+}
+
+func TestModelSmartcard(t *testing.T) {
+	dir := t.TempDir()
+	writeTestKey(t, dir, "id_first")
+	provider := &smartcardProvider{KeyringProvider: agents.NewKeyringProvider(), keys: map[string]ed25519.PrivateKey{}}
+	m, err := NewModel(keys.NewFSStore(dir), provider)
+	require.NoError(t, err)
+	run(t, m, m.Init())
+	assert.Contains(t, m.View(), "p/P to add/remove a PKCS#11 provider")
+
+	// A wrong PIN is reported.
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("p")})
+	typeText(t, m, "/usr/lib/opensc-pkcs11.so")
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	typeText(t, m, "0000")
+	assert.Contains(t, m.View(), "PIN for /usr/lib/opensc-pkcs11.so: ****_")
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	assert.ErrorIs(t, m.err, agents.ErrSmartcardRefused)
+
+	// The last provider is suggested.
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("p")})
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NotNil(t, m.prompt)
+	typeText(t, m, "1234")
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+	assert.Contains(t, m.View(), "Added 1 keys of /usr/lib/opensc-pkcs11.so to ssh-agent default")
+	assert.Contains(t, m.View(), "Smartcard and other agent keys:")
+	assert.Contains(t, m.View(), "PIV AUTH key [/usr/lib/opensc-pkcs11.so]")
+	// Local keys are not listed as smartcard keys.
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.True(t, m.Keys[0].LoadedToAgent)
+	assert.Len(t, m.smartcardKeys(), 1)
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("P")})
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+	assert.Empty(t, m.smartcardKeys())
+	assert.NotContains(t, m.View(), "Smartcard and other agent keys:")
+	assert.True(t, m.Keys[0].LoadedToAgent)
+}
+
+func TestModelAgents(t *testing.T) {
+	m, local := newTestModel(t)
+	forwarded, gpg := agents.NewKeyringProvider(), agents.NewKeyringProvider()
+	WithAgents(
+		agents.Endpoint{Name: "local", Provider: m.currentAgent().Provider},
+		agents.Endpoint{Name: "forwarded", Provider: forwarded},
+		agents.Endpoint{Name: "gpg-agent", Provider: gpg},
+	)(m)
+	run(t, m, m.Init())
+	require.NoError(t, m.err)
+	assert.Contains(t, m.View(), "Agents: [local] forwarded gpg-agent")
+
+	// The key is loaded to the current agent.
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+	assert.Contains(t, m.View(), "id_first  [in local]")
+
+	// Copy to the next agent by default.
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("M")})
+	require.NotNil(t, m.prompt)
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+	assert.Contains(t, m.View(), "id_first  [in local, forwarded]")
+	client, err := forwarded.Connect()
+	require.NoError(t, err)
+	list, err := client.List()
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	// Move to the named agent.
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("m")})
+	for range "forwarded" {
+		press(t, m, tea.KeyMsg{Type: tea.KeyBackspace})
+	}
+	typeText(t, m, "gpg-agent")
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+	assert.Contains(t, m.View(), "Key was moved to ssh-agent gpg-agent")
+	assert.Contains(t, m.View(), "id_first  [in forwarded, gpg-agent]")
+	assert.False(t, m.Keys[0].LoadedToAgent)
+	list, err = local.List()
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	// Keys are loaded to the agent switched to.
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("A")})
+	assert.Contains(t, m.View(), "Agents: local [forwarded] gpg-agent")
+	assert.True(t, m.Keys[0].LoadedToAgent)
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+	assert.Contains(t, m.View(), "id_first  [in gpg-agent]")
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("m")})
+	typeText(t, m, "x")
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	assert.EqualError(t, m.err, `unknown ssh-agent "gpg-agentx"`)
+}
+
+// recordingProvider is an in-memory agent which records the added keys.
+type recordingProvider struct {
+	*agents.KeyringProvider
+	added []agent.AddedKey
+}
+
+// Connect implements agents.Provider interface
+func (p *recordingProvider) Connect() (agent.ExtendedAgent, error) {
+	client, err := p.KeyringProvider.Connect()
+	return &recordingAgent{ExtendedAgent: client, provider: p}, err
+}
+
+// recordingAgent records the added keys to its provider.
+type recordingAgent struct {
+	agent.ExtendedAgent
+	provider *recordingProvider
+}
+
+// Add implements agent.Agent interface
+func (a *recordingAgent) Add(key agent.AddedKey) error {
+	a.provider.added = append(a.provider.added, key)
+	return a.ExtendedAgent.Add(key)
+}
+
+func TestModelLoadRestricted(t *testing.T) {
+	dir := t.TempDir()
+	writeTestKey(t, dir, "id_first")
+	provider := &recordingProvider{KeyringProvider: agents.NewKeyringProvider()}
+	m, err := NewModel(keys.NewFSStore(dir), provider)
+	require.NoError(t, err)
+	run(t, m, m.Init())
+
+	// Host keys come from known_hosts.
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	data := append([]byte("git.example.com,jump.example.com "), ssh.MarshalAuthorizedKey(hostKey.PublicKey())...)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	WithKnownHosts(path)(m)
+	run(t, m, m.Init())
+	assert.Contains(t, m.View(), "L to load a key only for some hosts")
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("L")})
+	typeText(t, m, "unknown.example.com")
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	assert.ErrorContains(t, m.err, "no host keys found for unknown.example.com")
+	assert.Empty(t, provider.added)
+
+	press(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("L")})
+	typeText(t, m, "git@git.example.com, jump.example.com>git.example.com")
+	press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NoError(t, m.err)
+	assert.True(t, m.Keys[0].LoadedToAgent)
+	assert.Contains(t, m.View(), "Key may be used only for git@git.example.com, jump.example.com>git.example.com")
+
+	require.Len(t, provider.added, 1)
+	require.Len(t, provider.added[0].ConstraintExtensions, 1)
+	assert.Equal(t, agents.RestrictDestinationExtension, provider.added[0].ConstraintExtensions[0].ExtensionName)
+}
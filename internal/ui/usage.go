@@ -0,0 +1,94 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ui
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/mixanemca/ssh-keys/internal/usage"
+	"golang.org/x/crypto/ssh"
+)
+
+// usageMsg carries the time of the latest use of every key by fingerprint.
+type usageMsg struct {
+	lastUsed map[string]time.Time
+}
+
+// usageRecordedMsg reports that the event was added to the usage log.
+type usageRecordedMsg struct {
+	event usage.Event
+}
+
+// loadUsage reads the usage log.
+func loadUsage(path string) tea.Cmd {
+	return func() tea.Msg {
+		events, err := usage.Read(path)
+		if err != nil {
+			return errMsg{err}
+		}
+
+		return usageMsg{lastUsed: usage.LastUsed(events)}
+	}
+}
+
+// recordUsage appends the event to the usage log.
+func recordUsage(path string, e usage.Event) tea.Cmd {
+	return func() tea.Msg {
+		if err := usage.Append(path, e); err != nil {
+			return errMsg{err}
+		}
+
+		return usageRecordedMsg{event: e}
+	}
+}
+
+// trackUsage records the use of the key when the usage log is enabled.
+func (m *Model) trackUsage(key ssh.PublicKey, action, host string) tea.Cmd {
+	if m.usagePath == "" {
+		return nil
+	}
+
+	return recordUsage(m.usagePath, usage.NewEvent(m.now(), key, action, host))
+}
+
+// syncUsage fills the last use time of the keys.
+func (m *Model) syncUsage() {
+	for _, list := range [][]*models.Key{m.Keys, m.VaultKeys} {
+		for _, k := range list {
+			k.LastUsed = m.lastUsed[ssh.FingerprintSHA256(k.Public)]
+		}
+	}
+}
+
+// renderLastUsed renders when the key was used last time.
+func (m *Model) renderLastUsed(k *models.Key) string {
+	if m.usagePath == "" {
+		return ""
+	}
+	if k.LastUsed.IsZero() {
+		return " [never used]"
+	}
+	since := m.now().Sub(k.LastUsed)
+	if since < 24*time.Hour {
+		return " (used today)"
+	}
+
+	return " (used " + keys.FormatAge(since) + " ago)"
+}
@@ -0,0 +1,123 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package usage keeps the opt-in log of key usage. Every event is a JSON
+// object on its own line, so the log is only appended to and is easy to
+// process with other tools.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The actions of usage events.
+const (
+	ActionLoad   = "load"
+	ActionUnload = "unload"
+	ActionCopyID = "copy-id"
+	ActionTest   = "test"
+	ActionSign   = "sign"
+)
+
+// Event is a single use of a key.
+type Event struct {
+	Time        time.Time `json:"time"`
+	Fingerprint string    `json:"fingerprint"`
+	Action      string    `json:"action"`
+	// Host is the user@host the key was used with, if any.
+	Host string `json:"host,omitempty"`
+}
+
+// NewEvent creates the event of the key at the time.
+func NewEvent(now time.Time, key ssh.PublicKey, action, host string) Event {
+	return Event{
+		Time:        now.UTC(),
+		Fingerprint: ssh.FingerprintSHA256(key),
+		Action:      action,
+		Host:        host,
+	}
+}
+
+// Append adds the event to the end of the log file, creating the file with
+// 0600 permissions if needed.
+func Append(path string, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal usage event: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("create usage log dir: %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("open usage log: %v", err)
+	}
+	// The line is written at once, so concurrent writers do not mix events.
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("write usage log: %v", err)
+	}
+
+	return f.Close()
+}
+
+// Read returns the events of the log file. A missing file has no events.
+// Malformed lines, such as the ones left by interrupted writes, are skipped.
+func Read(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open usage log: %v", err)
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read usage log: %v", err)
+	}
+
+	return events, nil
+}
+
+// LastUsed returns the time of the latest event of every fingerprint.
+func LastUsed(events []Event) map[string]time.Time {
+	last := make(map[string]time.Time)
+	for _, e := range events {
+		if t, ok := last[e.Fingerprint]; !ok || e.Time.After(t) {
+			last[e.Fingerprint] = e.Time
+		}
+	}
+
+	return last
+}
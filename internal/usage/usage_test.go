@@ -0,0 +1,78 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package usage
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ssh-keys", "usage.log")
+	events, err := Read(path)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, Append(path, NewEvent(now, key, ActionLoad, "")))
+	require.NoError(t, Append(path, NewEvent(now.Add(time.Hour), key, ActionCopyID, "root@example.com")))
+	require.NoError(t, Append(path, NewEvent(now.Add(-time.Hour), key, ActionTest, "root@example.com")))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	events, err = Read(path)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, ActionCopyID, events[1].Action)
+	assert.Equal(t, "root@example.com", events[1].Host)
+	assert.Equal(t, ssh.FingerprintSHA256(key), events[1].Fingerprint)
+
+	last := LastUsed(events)
+	assert.Len(t, last, 1)
+	assert.True(t, last[ssh.FingerprintSHA256(key)].Equal(now.Add(time.Hour)))
+}
+
+func TestReadMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.log")
+	data := `{"time":"2026-03-01T12:00:00Z","fingerprint":"SHA256:a","action":"load"}
+
+not json
+{"time":"2026-03-01T13:00:00Z","fingerprint":"SHA256:b","action":"test"}
+{"time":"2026-03-01T14:00:00Z","finger`
+	require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+
+	events, err := Read(path)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "SHA256:a", events[0].Fingerprint)
+	assert.Equal(t, "SHA256:b", events[1].Fingerprint)
+}
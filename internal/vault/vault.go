@@ -0,0 +1,401 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package vault implements an encrypted file holding many SSH private keys.
+//
+// The file is a JSON document with the key derivation parameters and the
+// sealed payload. The encryption key is derived from the master passphrase
+// with Argon2id and the payload is sealed with XChaCha20-Poly1305.
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// formatVersion is the version of the vault file format.
+	formatVersion = 1
+	// kdfArgon2id is the name of the key derivation function.
+	kdfArgon2id = "argon2id"
+	// additionalData binds the sealed payload to the file format.
+	additionalData = "ssh-keys vault v1"
+	// maxKDFTime and maxKDFMemory limit the Argon2id parameters read from
+	// the file, so a crafted vault can't exhaust the CPU or memory before
+	// the passphrase is checked.
+	maxKDFTime   = 64
+	maxKDFMemory = 4 * 1024 * 1024
+)
+
+// ErrWrongPassphrase is returned when the vault can't be decrypted with the
+// given passphrase.
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted vault")
+
+// KDFParams holds the Argon2id parameters.
+type KDFParams struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// DefaultKDFParams returns the Argon2id parameters recommended by RFC 9106
+// for memory constrained environments, with a fresh random salt.
+func DefaultKDFParams() (KDFParams, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return KDFParams{}, fmt.Errorf("generate salt: %v", err)
+	}
+
+	return KDFParams{
+		Name:    kdfArgon2id,
+		Salt:    salt,
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+	}, nil
+}
+
+// validate checks the parameters are usable and within the limits.
+func (p KDFParams) validate() error {
+	if p.Time < 1 || p.Time > maxKDFTime {
+		return fmt.Errorf("invalid key derivation time %d, want 1 to %d", p.Time, maxKDFTime)
+	}
+	if p.Memory < 8*uint32(p.Threads) || p.Memory > maxKDFMemory {
+		return fmt.Errorf("invalid key derivation memory %d KiB, want up to %d KiB", p.Memory, maxKDFMemory)
+	}
+	if p.Threads < 1 {
+		return fmt.Errorf("invalid key derivation threads %d", p.Threads)
+	}
+
+	return nil
+}
+
+// file is the on-disk representation of the vault.
+type file struct {
+	Version    int       `json:"version"`
+	KDF        KDFParams `json:"kdf"`
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+// entry is a private key kept in the vault.
+type entry struct {
+	Name    string    `json:"name"`
+	Comment string    `json:"comment"`
+	Private string    `json:"private"`
+	Created time.Time `json:"created"`
+}
+
+// Vault is an encrypted key store. It implements keys.KeyStore, every change
+// is written to the file immediately.
+type Vault struct {
+	path    string
+	kdf     KDFParams
+	key     []byte
+	entries []entry
+}
+
+// Ensure that Vault fulfils the keys.KeyStore interface at compile time.
+var _ keys.KeyStore = (*Vault)(nil)
+
+// Create creates a new empty vault file protected by the passphrase.
+func Create(path string, passphrase []byte) (*Vault, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("vault %s already exists", path)
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase is empty")
+	}
+	params, err := DefaultKDFParams()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Vault{
+		path: path,
+		kdf:  params,
+		key:  deriveKey(passphrase, params),
+	}
+	if err := v.save(nil); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// Open reads and decrypts the vault file.
+func Open(path string, passphrase []byte) (*Vault, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read vault: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse vault: %v", err)
+	}
+	if f.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported vault version %d", f.Version)
+	}
+	if f.KDF.Name != kdfArgon2id {
+		return nil, fmt.Errorf("unsupported key derivation function %q", f.KDF.Name)
+	}
+	if err := f.KDF.validate(); err != nil {
+		return nil, err
+	}
+
+	key := deriveKey(passphrase, f.KDF)
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %v", err)
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(f.Nonce))
+	}
+	plaintext, err := aead.Open(nil, f.Nonce, f.Ciphertext, []byte(additionalData))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	v := &Vault{
+		path: path,
+		kdf:  f.KDF,
+		key:  key,
+	}
+	if err := json.Unmarshal(plaintext, &v.entries); err != nil {
+		return nil, fmt.Errorf("parse vault payload: %v", err)
+	}
+
+	return v, nil
+}
+
+// Path returns the vault file path.
+func (v *Vault) Path() string {
+	return v.path
+}
+
+// List implements keys.KeyStore interface
+func (v *Vault) List() ([]*models.Key, error) {
+	list := make([]*models.Key, 0, len(v.entries))
+	for _, e := range v.entries {
+		key, err := v.toKey(e)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, key)
+	}
+
+	return list, nil
+}
+
+// Get implements keys.KeyStore interface
+func (v *Vault) Get(name string) (*models.Key, error) {
+	i := v.index(name)
+	if i < 0 {
+		return nil, fmt.Errorf("%s: %w", name, keys.ErrKeyNotFound)
+	}
+
+	return v.toKey(v.entries[i])
+}
+
+// Create implements keys.KeyStore interface
+func (v *Vault) Create(key *models.Key) error {
+	if err := validateName(key.Name); err != nil {
+		return err
+	}
+	if v.index(key.Name) >= 0 {
+		return fmt.Errorf("%s: %w", key.Name, keys.ErrKeyExists)
+	}
+
+	block, err := ssh.MarshalPrivateKey(keys.NormalizePrivateKey(key.Private), key.Comment)
+	if err != nil {
+		return fmt.Errorf("marshal private key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key.Private)
+	if err != nil {
+		return fmt.Errorf("create signer: %v", err)
+	}
+	// Imported keys keep their age.
+	created := key.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	entries := append(slices.Clone(v.entries), entry{
+		Name:    key.Name,
+		Comment: key.Comment,
+		Private: string(pem.EncodeToMemory(block)),
+		Created: created.UTC(),
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	if err := v.save(entries); err != nil {
+		return err
+	}
+
+	key.Path = v.keyPath(key.Name)
+	key.Format = signer.PublicKey().Type()
+	key.Public = signer.PublicKey()
+
+	return nil
+}
+
+// Delete implements keys.KeyStore interface
+func (v *Vault) Delete(name string) error {
+	i := v.index(name)
+	if i < 0 {
+		return fmt.Errorf("%s: %w", name, keys.ErrKeyNotFound)
+	}
+
+	return v.save(slices.Delete(slices.Clone(v.entries), i, i+1))
+}
+
+// Rename implements keys.KeyStore interface
+func (v *Vault) Rename(oldName, newName string) error {
+	if err := validateName(newName); err != nil {
+		return err
+	}
+	i := v.index(oldName)
+	if i < 0 {
+		return fmt.Errorf("%s: %w", oldName, keys.ErrKeyNotFound)
+	}
+	if v.index(newName) >= 0 {
+		return fmt.Errorf("%s: %w", newName, keys.ErrKeyExists)
+	}
+	entries := slices.Clone(v.entries)
+	entries[i].Name = newName
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	return v.save(entries)
+}
+
+// index returns the index of the named entry or -1.
+func (v *Vault) index(name string) int {
+	return slices.IndexFunc(v.entries, func(e entry) bool {
+		return e.Name == name
+	})
+}
+
+// keyPath returns the pseudo path of the key inside the vault.
+func (v *Vault) keyPath(name string) string {
+	return v.path + "#" + name
+}
+
+// toKey converts the vault entry to models.Key.
+func (v *Vault) toKey(e entry) (*models.Key, error) {
+	privKey, err := ssh.ParseRawPrivateKey([]byte(e.Private))
+	if err != nil {
+		return nil, fmt.Errorf("parse vault key %s: %v", e.Name, err)
+	}
+	signer, err := ssh.NewSignerFromKey(privKey)
+	if err != nil {
+		return nil, fmt.Errorf("create signer for vault key %s: %v", e.Name, err)
+	}
+
+	return &models.Key{
+		Name:    e.Name,
+		Path:    v.keyPath(e.Name),
+		Format:  signer.PublicKey().Type(),
+		Comment: e.Comment,
+		Private: privKey,
+		Public:  signer.PublicKey(),
+		Created: e.Created,
+	}, nil
+}
+
+// save encrypts the entries with a fresh nonce and atomically replaces the
+// vault file. The entries of the vault are updated only when the file is
+// written.
+func (v *Vault) save(entries []entry) error {
+	plaintext, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("marshal vault payload: %v", err)
+	}
+	aead, err := chacha20poly1305.NewX(v.key)
+	if err != nil {
+		return fmt.Errorf("create cipher: %v", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("generate nonce: %v", err)
+	}
+
+	data, err := json.MarshalIndent(file{
+		Version:    formatVersion,
+		KDF:        v.kdf,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, []byte(additionalData)),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal vault: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(v.path), 0700); err != nil {
+		return fmt.Errorf("create vault dir: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(v.path), ".vault-*")
+	if err != nil {
+		return fmt.Errorf("create vault temp file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write vault: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close vault: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), v.path); err != nil {
+		return fmt.Errorf("replace vault: %v", err)
+	}
+	v.entries = entries
+
+	return nil
+}
+
+// deriveKey derives the encryption key from the passphrase.
+func deriveKey(passphrase []byte, p KDFParams) []byte {
+	return argon2.IDKey(passphrase, p.Salt, p.Time, p.Memory, p.Threads, chacha20poly1305.KeySize)
+}
+
+// validateName checks the key name is acceptable by the vault.
+func validateName(name string) error {
+	if strings.TrimSpace(name) == "" || strings.ContainsAny(name, "#\n") {
+		return fmt.Errorf("%q: %w", name, keys.ErrInvalidName)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright © 2023 Michael Bruskov <mixanemca@yandex.ru>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mixanemca/ssh-keys/internal/keys"
+	"github.com/mixanemca/ssh-keys/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault")
+	passphrase := []byte("correct horse battery staple")
+
+	v, err := Create(path, passphrase)
+	require.NoError(t, err)
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key := &models.Key{Name: "id_work", Comment: "me@work", Private: priv}
+	require.NoError(t, v.Create(key))
+	assert.ErrorIs(t, v.Create(key), keys.ErrKeyExists)
+
+	// The key material must not be stored in plaintext.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "me@work")
+	assert.NotContains(t, string(data), "OPENSSH PRIVATE KEY")
+
+	_, err = Open(path, []byte("wrong"))
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+
+	v, err = Open(path, passphrase)
+	require.NoError(t, err)
+	got, err := v.Get("id_work")
+	require.NoError(t, err)
+	assert.Equal(t, "me@work", got.Comment)
+	assert.Equal(t, key.Public.Marshal(), got.Public.Marshal())
+
+	require.NoError(t, v.Rename("id_work", "id_home"))
+	require.NoError(t, v.Delete("id_home"))
+	list, err := v.List()
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	_, err = Create(path, passphrase)
+	assert.Error(t, err)
+}
+
+func TestOpenKDFParams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault")
+	salt := make([]byte, 16)
+	for name, params := range map[string]KDFParams{
+		"no threads":  {Name: kdfArgon2id, Salt: salt, Time: 1, Memory: 64 * 1024},
+		"no passes":   {Name: kdfArgon2id, Salt: salt, Memory: 64 * 1024, Threads: 1},
+		"huge memory": {Name: kdfArgon2id, Salt: salt, Time: 1, Memory: math.MaxUint32, Threads: 1},
+		"many passes": {Name: kdfArgon2id, Salt: salt, Time: math.MaxUint32, Memory: 64 * 1024, Threads: 1},
+	} {
+		data, err := json.Marshal(file{Version: formatVersion, KDF: params, Nonce: make([]byte, 24)})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, data, 0600))
+
+		_, err = Open(path, []byte("secret"))
+		assert.ErrorContains(t, err, "invalid key derivation", name)
+	}
+}
+
+func TestVaultSaveFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault")
+	v, err := Create(path, []byte("secret"))
+	require.NoError(t, err)
+
+	// The vault file can't be replaced by a directory.
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.MkdirAll(filepath.Join(path, "dir"), 0700))
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	assert.Error(t, v.Create(&models.Key{Name: "id_work", Private: priv}))
+	list, err := v.List()
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}